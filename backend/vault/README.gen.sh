@@ -258,6 +258,26 @@ and will add a section for Vault. Rclone uses a single configuration file,
 located by default under your [HOME
 directory](https://en.wikipedia.org/wiki/Home_directory).
 
+The password is stored [obscured](https://rclone.org/commands/rclone_obscure/)
+in the configuration file. If you edit the file by hand, use `rclone obscure`
+to generate the value for the `password` field.
+
+Older rclone versions stored the password in plain text. With such a
+configuration, rclone stops with "password in config is not obscured";
+re-enter the password with `rclone config`, or replace the value with the
+output of `rclone obscure`. A plain text password, which happens to look
+like an obscured one, cannot be told apart and makes the login fail.
+
+Alternatively, set `use_keyring = true` and leave the password out of the
+configuration file. Rclone will then look up the password in the system
+keyring (secret-tool on Linux, Keychain on macOS, Credential Manager on
+Windows) under the service `rclone-vault` and the account
+`<remote>/password`, e.g.:
+
+```
+$ secret-tool store --label="rclone vault" service rclone-vault account vault/password
+```
+
 You can always ask Rclone to show you where your configuration file is located:
 
 ```
@@ -0,0 +1,121 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+)
+
+// userRoles are the roles a user can have, cf. RoleEnum.
+var userRoles = []string{"ADMIN", "USER", "VIEWER", "READ_ONLY"}
+
+// CollectionAccess is a user and whether the user is authorized for a
+// collection.
+type CollectionAccess struct {
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	Authorized bool   `json:"authorized"`
+}
+
+// accessCommand lists the users of the organization and whether they are
+// authorized for the collection of the remote root.
+func (f *Fs) accessCommand(ctx context.Context) (out interface{}, err error) {
+	c, err := f.rootCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users, err := f.api.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*CollectionAccess, 0, len(users))
+	for _, u := range users {
+		result = append(result, &CollectionAccess{
+			Username:   u.Username,
+			Role:       u.Role,
+			Authorized: authorizedFor(u, c),
+		})
+	}
+	return result, nil
+}
+
+// grantCommand authorizes users for the collection of the remote root and
+// optionally sets their role; revoke removes the authorization instead.
+func (f *Fs) grantCommand(ctx context.Context, args []string, opt map[string]string, revoke bool) (out interface{}, err error) {
+	if len(args) == 0 {
+		return nil, errors.New("at least one username required")
+	}
+	role := strings.ToUpper(opt["role"])
+	if role != "" && !isUserRole(role) {
+		return nil, fmt.Errorf("invalid role %q, must be one of %v", opt["role"], strings.Join(userRoles, ", "))
+	}
+	c, err := f.rootCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users, err := f.api.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*api.User)
+	for _, u := range users {
+		byName[u.Username] = u
+	}
+	for _, name := range args {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("user not found: %v", name)
+		}
+	}
+	for _, name := range args {
+		var (
+			u           = byName[name]
+			collections []string
+		)
+		for _, v := range u.AuthorizedCollections {
+			if !sameCollection(v, c) {
+				collections = append(collections, v)
+			}
+		}
+		if !revoke {
+			collections = append(collections, c.URL)
+		}
+		if err := f.api.SetUserAccess(ctx, u, collections, role); err != nil {
+			return nil, fmt.Errorf("failed to update %v: %w", name, err)
+		}
+		if revoke {
+			fs.Infof(f, "revoked access to %v for %v", c.Name, name)
+		} else {
+			fs.Infof(f, "granted access to %v for %v", c.Name, name)
+		}
+	}
+	return nil, nil
+}
+
+// authorizedFor returns true, if the user is authorized for collection c.
+func authorizedFor(u *api.User, c *api.Collection) bool {
+	for _, v := range u.AuthorizedCollections {
+		if sameCollection(v, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameCollection returns true, if collection url v refers to c.
+func sameCollection(v string, c *api.Collection) bool {
+	other := &api.Collection{URL: v}
+	return v == c.URL || (other.Identifier() != 0 && other.Identifier() == c.Identifier())
+}
+
+func isUserRole(role string) bool {
+	for _, v := range userRoles {
+		if v == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package vault
+
+import (
+	"context"
+	"net/url"
+	"sort"
+
+	"github.com/rclone/rclone/backend/vault/api"
+)
+
+// OrganizationUser is a user of the organization with the names of the
+// collections the user is authorized for.
+type OrganizationUser struct {
+	Username    string   `json:"username"`
+	FirstName   string   `json:"first_name"`
+	LastName    string   `json:"last_name"`
+	Role        string   `json:"role"`
+	Active      bool     `json:"active"`
+	LastLogin   string   `json:"last_login"`
+	Collections []string `json:"collections"`
+}
+
+// Usage is the storage used by the organization, per collection.
+type Usage struct {
+	QuotaBytes  int64              `json:"quota_bytes"`
+	UsedBytes   int64              `json:"used_bytes"`
+	FreeBytes   int64              `json:"free_bytes"`
+	Files       int64              `json:"files"`
+	Collections []*CollectionUsage `json:"collections"`
+}
+
+// CollectionUsage is the storage used by a single collection. Share is the
+// percentage of the bytes used by the organization.
+type CollectionUsage struct {
+	Name      string  `json:"name"`
+	Files     int64   `json:"files"`
+	Bytes     int64   `json:"bytes"`
+	Share     float64 `json:"share"`
+	StatsTime string  `json:"stats_time"`
+}
+
+// usersCommand lists the users of the organization.
+func (f *Fs) usersCommand(ctx context.Context) (out interface{}, err error) {
+	users, err := f.api.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := f.api.FindCollections(ctx, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*OrganizationUser, 0, len(users))
+	for _, u := range users {
+		ou := &OrganizationUser{
+			Username:    u.Username,
+			FirstName:   u.FirstName,
+			LastName:    u.LastName,
+			Role:        u.Role,
+			Active:      u.IsActive,
+			LastLogin:   u.LastLogin,
+			Collections: []string{},
+		}
+		for _, c := range collections {
+			if authorizedFor(u, c) {
+				ou.Collections = append(ou.Collections, c.Name)
+			}
+		}
+		sort.Strings(ou.Collections)
+		result = append(result, ou)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Username < result[j].Username })
+	return result, nil
+}
+
+// usageCommand reports the storage used per collection, largest first.
+// Vault records no usage per user.
+func (f *Fs) usageCommand(ctx context.Context) (out interface{}, err error) {
+	organization, err := f.api.Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := f.api.GetCollectionStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := f.api.FindCollections(ctx, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	usage := &Usage{
+		QuotaBytes:  organization.QuotaBytes,
+		UsedBytes:   stats.TotalSize(),
+		FreeBytes:   organization.QuotaBytes - stats.TotalSize(),
+		Files:       stats.NumFiles(),
+		Collections: []*CollectionUsage{},
+	}
+	for _, c := range collections {
+		cu := collectionUsage(c, stats)
+		if usage.UsedBytes > 0 {
+			cu.Share = 100 * float64(cu.Bytes) / float64(usage.UsedBytes)
+		}
+		usage.Collections = append(usage.Collections, cu)
+	}
+	sort.SliceStable(usage.Collections, func(i, j int) bool {
+		a, b := usage.Collections[i], usage.Collections[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Name < b.Name
+	})
+	return usage, nil
+}
+
+// collectionUsage returns files and bytes of a collection from the stats.
+func collectionUsage(c *api.Collection, stats *api.CollectionStats) *CollectionUsage {
+	cu := &CollectionUsage{Name: c.Name}
+	for _, s := range stats.Collections {
+		if s.ID == c.Identifier() {
+			cu.Files, cu.Bytes, cu.StatsTime = s.FileCount, s.TotalSize, s.Time
+		}
+	}
+	return cu
+}
@@ -469,34 +469,6 @@ func (api *API) List(t *TreeNode) ([]*TreeNode, error) {
 	})
 }
 
-// RegisterDeposit sends a RegisterDepositRequest to the API and returns the deposit id.
-func (api *API) RegisterDeposit(ctx context.Context, rdr *RegisterDepositRequest) (id int64, err error) {
-	opts := rest.Opts{
-		Method: "POST",
-		Path:   "/register_deposit",
-	}
-	var depositResp RegisterDepositResponse
-	resp, err := api.client.CallJSON(ctx, &opts, rdr, &depositResp)
-	if err != nil {
-		// Refs. WT-1841, "It will return resp if at all possible, even if err
-		// is set", but it may be nil, still.
-		if resp != nil && resp.StatusCode == 500 {
-			// This may happen, if after a successful, but not yet assembled
-			// deposit the same (e.g. sync) command is executed again. This
-			// leads to various integrity errors. However, once the files are
-			// assembled and in place, the command will work fine again.
-			fs.Debugf(api, "got an HTTP 500 while registering a deposit (may be clashing filenames)")
-			return 0, &Error{fmt.Errorf("cannot create deposit (probably name clashes); try to use --ignore-existing flag when uploading")}
-		}
-		// TODO: we need warning deposit here to check whether files already
-		// exist; do some kind of "--force" by default
-		return 0, &Error{err}
-	}
-	defer resp.Body.Close() // nolint:errcheck
-	fs.Logf(api, "deposit registered: %v", depositResp.ID)
-	return depositResp.ID, nil
-}
-
 // TreeNodeToCollection turns a treenode to a collection.
 func (api *API) TreeNodeToCollection(t *TreeNode) (*Collection, error) {
 	result, err := api.FindCollections(url.Values{
@@ -592,12 +564,3 @@ func (api *API) root() (*TreeNode, error) {
 	api.cache.SetGroup("root", "default", t)
 	return t, nil
 }
-
-// TODO(martin): do two, then pass on
-
-// func (api *API) depositV2...
-
-// resp, err := f.depositsV2Client.VaultDepositApiRegisterDepositWithResponse(ctx, body)
-// resp, err = f.depositsV2Client.VaultDepositApiSendChunkWithBody(ctx, w.FormDataContentType(), &wbuf)
-// resp, err := f.depositsV2Client.VaultDepositApiTerminateDeposit(ctx, body)
-// resp, err := f.depositsV2Client.VaultDepositApiFinalizeDepositWithResponse(ctx, body)
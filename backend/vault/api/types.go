@@ -42,6 +42,9 @@ type User struct {
 	Organization string `json:"organization"`
 	URL          string `json:"url"`
 	Username     string `json:"username"`
+	Role         string `json:"role"`
+	// AuthorizedCollections are collection urls, the user has access to.
+	AuthorizedCollections []string `json:"authorized_collections"`
 }
 
 // Collection payload.
@@ -58,6 +61,25 @@ type Collection struct {
 	URL               string `json:"url"`       // http://127.0.0.1:8000/api/collections/1/
 }
 
+// CollectionSummary is the size of a collection and where its copies are
+// stored.
+type CollectionSummary struct {
+	Name                   string             `json:"name"`
+	FixityFrequency        string             `json:"fixity_frequency"`
+	SizeBytes              int64              `json:"size_bytes"`
+	TargetReplicaLocations []*ReplicaLocation `json:"target_replica_locations"`
+}
+
+// ReplicaLocation is a storage location with the number of copies kept
+// there.
+type ReplicaLocation struct {
+	Abbreviation      string `json:"abbreviation"`
+	DisplayName       string `json:"display_name"`
+	NumCopies         int64  `json:"num_copies"`
+	PhysicalLocation  string `json:"physical_location"`
+	SystemDescription string `json:"system_description"`
+}
+
 // TreeNode is node in the filesystem tree.
 type TreeNode struct {
 	Comment              interface{} `json:"comment"`
@@ -79,6 +101,101 @@ type TreeNode struct {
 	URL                  string      `json:"url"`
 }
 
+// DepositState is the state of a deposit. A deposit is registered, takes
+// uploads until finalized, then is processed by the server, until all files
+// are replicated.
+type DepositState string
+
+// States of a deposit, in the order a deposit passes them.
+const (
+	DepositRegistered         DepositState = "REGISTERED"
+	DepositUploaded           DepositState = "UPLOADED"
+	DepositHashed             DepositState = "HASHED"
+	DepositReplicated         DepositState = "REPLICATED"
+	DepositCompleteWithErrors DepositState = "COMPLETE_WITH_ERRORS"
+	DepositTerminatedByUser   DepositState = "TERMINATED_BY_USER"
+)
+
+// DepositStates are all known states of a deposit.
+var DepositStates = []DepositState{
+	DepositRegistered,
+	DepositUploaded,
+	DepositHashed,
+	DepositReplicated,
+	DepositCompleteWithErrors,
+	DepositTerminatedByUser,
+}
+
+// Known returns true, if the state is one of DepositStates.
+func (s DepositState) Known() bool {
+	for _, v := range DepositStates {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpen returns true, if the deposit accepts uploads.
+func (s DepositState) IsOpen() bool { return s == DepositRegistered }
+
+// IsProcessing returns true, if the deposit is finalized and its files are
+// being hashed and replicated.
+func (s DepositState) IsProcessing() bool {
+	return s == DepositUploaded || s == DepositHashed
+}
+
+// IsDone returns true, if the server is done with the deposit, successfully
+// or not.
+func (s DepositState) IsDone() bool {
+	return s == DepositReplicated || s == DepositCompleteWithErrors || s == DepositTerminatedByUser
+}
+
+// IsFailed returns true, if the deposit ended without all files stored.
+func (s DepositState) IsFailed() bool {
+	return s == DepositCompleteWithErrors || s == DepositTerminatedByUser
+}
+
+// Deposit is a single deposit, with its current state.
+type Deposit struct {
+	ID           int64        `json:"id"`
+	State        DepositState `json:"state"`
+	Collection   string       `json:"collection"`
+	ParentNode   string       `json:"parent_node"`
+	Username     string       `json:"username"`
+	RegisteredAt string       `json:"registered_at"`
+	UploadedAt   string       `json:"uploaded_at"`
+	HashedAt     string       `json:"hashed_at"`
+	ReplicatedAt string       `json:"replicated_at"`
+}
+
+// Event is a deposit or fixity check of a collection.
+type Event struct {
+	ID          int64  `json:"id"`
+	Type        string `json:"type"` // DEPOSIT or FIXITY
+	Collection  string `json:"collection"`
+	UploadState string `json:"upload_state"`
+	StartedAt   string `json:"started_at"`
+	EndedAt     string `json:"ended_at"`
+	FileCount   int64  `json:"file_count"`
+	ErrorCount  int64  `json:"error_count"`
+}
+
+// Report is the report of a deposit or fixity check of a collection, with
+// the files and bytes of the collection when the report was made.
+type Report struct {
+	ID              int64  `json:"id"`
+	Type            string `json:"report_type"` // DEPOSIT or FIXITY
+	Collection      string `json:"collection"`
+	StartedAt       string `json:"started_at"`
+	EndedAt         string `json:"ended_at"`
+	FileCount       int64  `json:"file_count"`
+	TotalSize       int64  `json:"total_size"`
+	ErrorCount      int64  `json:"error_count"`
+	CollectionFiles int64  `json:"collection_file_count"`
+	CollectionBytes int64  `json:"collection_total_size"`
+}
+
 // DepositStatus response data.
 type DepositStatus struct {
 	AssembledFiles int64 `json:"assembled_files"`
@@ -92,40 +209,6 @@ type DepositStatus struct {
 // Auxiliary structures
 // --------------------
 
-// File passed e.g. in deposit requests.
-type File struct {
-	FlowIdentifier       string `json:"flow_identifier"`
-	Name                 string `json:"name"`
-	PreDepositModifiedAt string `json:"pre_deposit_modified_at"` // e.g. 2018-04-13T08:06:48.000Z
-	RelativePath         string `json:"relative_path"`
-	Size                 int64  `json:"size"`
-	Type                 string `json:"type"`
-}
-
-// RegisterDepositRequest payload.
-type RegisterDepositRequest struct {
-	CollectionID int64   `json:"collection_id,omitempty"`
-	Files        []*File `json:"files"`
-	ParentNodeID int64   `json:"parent_node_id,omitempty"`
-	TotalSize    int64   `json:"total_size"`
-}
-
-// RegisterDepositResponse is the response to a successful RegisterDepositRequest.
-type RegisterDepositResponse struct {
-	ID int64 `json:"deposit_id"`
-}
-
-// WarningDepositResponse is returned by warning_deposit check.
-type WarningDepositResponse struct {
-	Objects []struct {
-		ID         int64  `json:"id"`
-		Name       string `json:"name"`
-		Parent     int64  `json:"parent"`
-		ParentName string `json:"parent_name"`
-	} `json:"objects"`
-	RelativePath []interface{} `json:"relative_path"`
-}
-
 // PathInfo can be obtained from an absolute path.
 type PathInfo struct {
 	CollectionTreeNode *TreeNode
@@ -133,20 +216,6 @@ type PathInfo struct {
 	RelativePath       string
 }
 
-// FlowChunk is used to post data to the server, like FlowChunkGet or
-// FlowChunkPost in vault.
-type FlowChunk struct {
-	DepositIdentifier string
-	FileIdentifier    string
-	Filename          string
-	RelativePath      string
-	Number            int
-	Size              int64
-	TotalSize         int64
-	NumChunks         int
-	TargetChunkSize   int64
-}
-
 // CollectionStats from api/collections_stats.
 type CollectionStats struct {
 	Collections []struct {
@@ -354,6 +423,20 @@ func (o *Organization) PlanIdentifier() string {
 	}
 }
 
+// Identifier returns the user identifier.
+func (u *User) Identifier() int64 {
+	re := regexp.MustCompile(`^http.*/api/users/([0-9]{1,})/?$`)
+	matches := re.FindStringSubmatch(u.URL)
+	if len(matches) != 2 {
+		return 0
+	}
+	v, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0
+	}
+	return int64(v)
+}
+
 // Identifier returns the collection identifier.
 func (c *Collection) Identifier() int64 {
 	switch {
@@ -136,3 +136,27 @@ func TestOrganizationPlanIdentifier(t *testing.T) {
 		}
 	}
 }
+
+func TestDepositState(t *testing.T) {
+	for _, c := range []struct {
+		state                                 DepositState
+		known, open, processing, done, failed bool
+	}{
+		{DepositRegistered, true, true, false, false, false},
+		{DepositUploaded, true, false, true, false, false},
+		{DepositHashed, true, false, true, false, false},
+		{DepositReplicated, true, false, false, true, false},
+		{DepositCompleteWithErrors, true, false, false, true, true},
+		{DepositTerminatedByUser, true, false, false, true, true},
+		{"", false, false, false, false, false},
+		{"DONE", false, false, false, false, false},
+	} {
+		got := []bool{c.state.Known(), c.state.IsOpen(), c.state.IsProcessing(), c.state.IsDone(), c.state.IsFailed()}
+		want := []bool{c.known, c.open, c.processing, c.done, c.failed}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("[%q] got %v, want %v", c.state, got, want)
+			}
+		}
+	}
+}
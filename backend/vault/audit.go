@@ -0,0 +1,191 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// auditPollInterval is the time between deposit status requests, while
+// waiting for a deposit to be processed.
+const auditPollInterval = 5 * time.Second
+
+// auditHashes are the hashes compared, if supported by the source.
+var auditHashes = []hash.Type{hash.MD5, hash.SHA256}
+
+// AuditResult is the outcome of comparing a single file.
+type AuditResult struct {
+	Remote string `json:"remote"`
+	Status string `json:"status"` // ok, missing, extra, size, hash or unverified
+	Detail string `json:"detail,omitempty"`
+}
+
+// AuditReport summarizes an audit; it passes, if all files are ok.
+type AuditReport struct {
+	Pass     bool           `json:"pass"`
+	Checked  int            `json:"checked"`
+	Failures []*AuditResult `json:"failures"`
+}
+
+// auditCommand compares the files below the root with a source, by size and
+// checksums, optionally after waiting for a deposit to be processed.
+func (f *Fs) auditCommand(ctx context.Context, args []string, opt map[string]string) (out interface{}, err error) {
+	if len(args) != 1 {
+		return nil, errors.New("audit requires a single source path")
+	}
+	src, err := cache.Get(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := opt["wait"]; ok {
+		var (
+			timeout fs.Duration
+			id      = f.lastDeposit()
+		)
+		if err := timeout.Set(v); err != nil {
+			return nil, fmt.Errorf("invalid wait duration: %w", err)
+		}
+		if v, ok := opt["deposit"]; ok {
+			if id, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid deposit id: %w", err)
+			}
+		}
+		if err := f.waitDeposit(ctx, id, time.Duration(timeout)); err != nil {
+			return nil, err
+		}
+	}
+	return f.audit(ctx, src)
+}
+
+// waitDeposit waits until the server is done with a deposit or all its
+// files are stored or errored. A terminated deposit is never processed.
+func (f *Fs) waitDeposit(ctx context.Context, id int, timeout time.Duration) error {
+	if id == 0 {
+		return ErrNoDeposit
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		d, err := f.api.Deposit(ctx, int64(id))
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.State == api.DepositTerminatedByUser:
+			return fmt.Errorf("%w: deposit %d is %s", ErrDepositClosed, id, d.State)
+		case d.State.IsDone():
+			fs.Debugf(f, "deposit %d processed: %s", id, d.State)
+			return nil
+		}
+		status, err := f.depositor.status(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !d.State.IsOpen() && status.InStorageFiles+status.ErroredFiles >= status.TotalFiles {
+			fs.Debugf(f, "deposit %d processed: %+v", id, status)
+			return nil
+		}
+		fs.Infof(f, "waiting for deposit %d (%s): %d/%d files stored", id, d.State, status.InStorageFiles, status.TotalFiles)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("deposit %d not processed: %w", id, ctx.Err())
+		case <-time.After(auditPollInterval):
+		}
+	}
+}
+
+// audit compares all objects of src with the objects below the root.
+func (f *Fs) audit(ctx context.Context, src fs.Fs) (*AuditReport, error) {
+	srcObjs, err := listObjects(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	dstObjs, err := listObjects(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		report  = &AuditReport{Failures: []*AuditResult{}}
+		remotes []string
+	)
+	for remote := range srcObjs {
+		remotes = append(remotes, remote)
+	}
+	for remote := range dstObjs {
+		if _, ok := srcObjs[remote]; !ok {
+			remotes = append(remotes, remote)
+		}
+	}
+	sort.Strings(remotes)
+	for _, remote := range remotes {
+		result := auditObject(ctx, remote, srcObjs[remote], dstObjs[remote])
+		report.Checked++
+		if result.Status != "ok" {
+			report.Failures = append(report.Failures, result)
+		}
+	}
+	report.Pass = len(report.Failures) == 0
+	fs.Infof(f, "audit: %d files checked, %d failures", report.Checked, len(report.Failures))
+	return report, nil
+}
+
+// auditObject compares a source and a destination object, either may be nil.
+func auditObject(ctx context.Context, remote string, src, dst fs.Object) *AuditResult {
+	result := &AuditResult{Remote: remote, Status: "ok"}
+	switch {
+	case dst == nil:
+		result.Status = "missing"
+		return result
+	case src == nil:
+		result.Status = "extra"
+		return result
+	case src.Size() >= 0 && src.Size() != dst.Size():
+		result.Status, result.Detail = "size", fmt.Sprintf("source %d, vault %d", src.Size(), dst.Size())
+		return result
+	}
+	var verified bool
+	for _, ht := range auditHashes {
+		if !src.Fs().Hashes().Contains(ht) {
+			continue
+		}
+		srcSum, err := src.Hash(ctx, ht)
+		if err != nil {
+			result.Status, result.Detail = "unverified", err.Error()
+			return result
+		}
+		dstSum, err := dst.Hash(ctx, ht)
+		if err != nil || srcSum == "" || dstSum == "" {
+			continue
+		}
+		if srcSum != dstSum {
+			result.Status, result.Detail = "hash", fmt.Sprintf("%v: source %s, vault %s", ht, srcSum, dstSum)
+			return result
+		}
+		verified = true
+	}
+	if !verified {
+		result.Status, result.Detail = "unverified", "no common checksum available"
+	}
+	return result
+}
+
+// listObjects returns all objects of f by remote.
+func listObjects(ctx context.Context, f fs.Fs) (map[string]fs.Object, error) {
+	objs := make(map[string]fs.Object)
+	err := walk.ListR(ctx, f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			objs[o.Remote()] = o
+		})
+		return nil
+	})
+	return objs, err
+}
@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/bagit"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// defaultBagAlgorithms are the manifest algorithms, if none are given.
+const defaultBagAlgorithms = "sha256"
+
+// bagCommand deposits a source directory as a BagIt bag. The payload is
+// uploaded to <name>/data, the tag files are generated from the checksums
+// computed during upload, then the deposit is finalized.
+func (f *Fs) bagCommand(ctx context.Context, args []string, opt map[string]string) (out interface{}, err error) {
+	if len(args) != 1 {
+		return nil, errors.New("bag requires a single source path")
+	}
+	src, err := cache.Get(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	var (
+		name = optOrDefault(opt, "name", path.Base(strings.TrimRight(src.Root(), "/")))
+		algs = strings.Split(optOrDefault(opt, "algorithms", defaultBagAlgorithms), ",")
+		bag  = bagit.New()
+	)
+	if name == "" || name == "." || name == "/" {
+		return nil, errors.New("bag requires a name")
+	}
+	for _, alg := range algs {
+		var ht hash.Type
+		if err := ht.Set(alg); err != nil || !f.Hashes().Contains(ht) {
+			return nil, fmt.Errorf("%w: %v", bagit.ErrUnsupportedAlgorithm, alg)
+		}
+	}
+	bag.SetInfo("Bagging-Date", time.Now().Format("2006-01-02"))
+	bag.SetInfo("Bag-Software-Agent", "rclone "+fs.Version)
+	var labels []string
+	for k := range opt {
+		if k != "name" && k != "algorithms" {
+			labels = append(labels, k)
+		}
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		bag.SetInfo(k, opt[k])
+	}
+	err = walk.ListR(ctx, src, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		return entries.ForObjectError(func(o fs.Object) error {
+			size, sums, err := f.bagPut(ctx, path.Join(name, bagit.PayloadDir, o.Remote()), o)
+			if err != nil {
+				return err
+			}
+			bag.Add(o.Remote(), size, sums)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	tagFiles, err := bag.TagFiles(algs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, tf := range tagFiles {
+		info := object.NewStaticObjectInfo(path.Join(name, tf.Name), time.Now(), int64(len(tf.Content)), true, nil, nil)
+		if _, err := f.Put(ctx, bytes.NewReader(tf.Content), info); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.finalize(ctx); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"bag":         path.Join(f.root, name),
+		"payloadOxum": bag.PayloadOxum(),
+	}, nil
+}
+
+// bagPut uploads a payload file and returns its size and checksums by
+// algorithm name.
+func (f *Fs) bagPut(ctx context.Context, remote string, o fs.Object) (size int64, sums map[string]string, err error) {
+	rc, err := o.Open(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rc.Close() // nolint:errcheck
+	var (
+		in   = readers.NewCountingReader(rc)
+		info = object.NewStaticObjectInfo(remote, o.ModTime(ctx), o.Size(), true, nil, nil)
+	)
+	obj, err := f.Put(ctx, in, info)
+	if err != nil {
+		return 0, nil, err
+	}
+	sums = make(map[string]string)
+	for _, ht := range f.Hashes().Array() {
+		if sums[ht.String()], err = obj.Hash(ctx, ht); err != nil {
+			return 0, nil, err
+		}
+	}
+	return int64(in.BytesRead()), sums, nil
+}
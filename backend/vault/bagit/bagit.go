@@ -0,0 +1,148 @@
+// Package bagit writes the tag files of a BagIt bag, RFC 8493, from file
+// sizes and checksums computed elsewhere, e.g. during upload. The payload
+// itself is not touched.
+package bagit
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+)
+
+// Version is the BagIt version written to bagit.txt.
+const Version = "1.0"
+
+// PayloadDir is the directory of the payload files within a bag.
+const PayloadDir = "data"
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported checksum algorithm")
+	ErrMissingChecksum      = errors.New("missing checksum")
+)
+
+// algorithms maps BagIt algorithm names to hash functions, used for tag
+// manifests.
+var algorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// File is a tag file, with a name relative to the bag root.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// entry is a single payload file.
+type entry struct {
+	path string            // relative to the payload dir
+	size int64             // size in bytes
+	sums map[string]string // algorithm name to hex checksum
+}
+
+// Bag collects payload files and bag metadata.
+type Bag struct {
+	entries []entry
+	info    [][2]string // bag-info.txt labels and values, in order
+}
+
+// New returns an empty bag.
+func New() *Bag {
+	return &Bag{}
+}
+
+// Add adds a payload file with its size and checksums, keyed by algorithm
+// name, e.g. "sha256". The path is relative to the payload directory.
+func (b *Bag) Add(path string, size int64, sums map[string]string) {
+	b.entries = append(b.entries, entry{path: path, size: size, sums: sums})
+}
+
+// SetInfo adds a label to bag-info.txt. Labels may be repeated.
+func (b *Bag) SetInfo(label, value string) {
+	b.info = append(b.info, [2]string{label, value})
+}
+
+// PayloadOxum returns the octet count and the number of payload files, as
+// used in bag-info.txt.
+func (b *Bag) PayloadOxum() string {
+	var size int64
+	for _, e := range b.entries {
+		size += e.size
+	}
+	return fmt.Sprintf("%d.%d", size, len(b.entries))
+}
+
+// TagFiles returns bagit.txt, bag-info.txt, a payload manifest per algorithm
+// and a tag manifest per algorithm, which covers the other tag files. Every
+// payload file requires a checksum for each algorithm.
+func (b *Bag) TagFiles(algs ...string) ([]File, error) {
+	for _, alg := range algs {
+		if _, ok := algorithms[alg]; !ok {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedAlgorithm, alg)
+		}
+	}
+	files := []File{
+		{Name: "bagit.txt", Content: []byte(fmt.Sprintf("BagIt-Version: %s\nTag-File-Character-Encoding: UTF-8\n", Version))},
+		{Name: "bag-info.txt", Content: b.bagInfo()},
+	}
+	for _, alg := range algs {
+		m, err := b.manifest(alg)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: "manifest-" + alg + ".txt", Content: m})
+	}
+	var tagFiles = len(files)
+	for _, alg := range algs {
+		var buf bytes.Buffer
+		for _, f := range files[:tagFiles] {
+			h := algorithms[alg]()
+			h.Write(f.Content)
+			fmt.Fprintf(&buf, "%x  %s\n", h.Sum(nil), encodePath(f.Name))
+		}
+		files = append(files, File{Name: "tagmanifest-" + alg + ".txt", Content: buf.Bytes()})
+	}
+	return files, nil
+}
+
+// bagInfo renders bag-info.txt, adding the Payload-Oxum.
+func (b *Bag) bagInfo() []byte {
+	var buf bytes.Buffer
+	for _, kv := range b.info {
+		fmt.Fprintf(&buf, "%s: %s\n", kv[0], strings.ReplaceAll(kv[1], "\n", "\n  "))
+	}
+	fmt.Fprintf(&buf, "Payload-Oxum: %s\n", b.PayloadOxum())
+	return buf.Bytes()
+}
+
+// manifest renders the payload manifest for a single algorithm, sorted by
+// path.
+func (b *Bag) manifest(alg string) ([]byte, error) {
+	entries := make([]entry, len(b.entries))
+	copy(entries, b.entries)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].path < entries[j].path })
+	var buf bytes.Buffer
+	for _, e := range entries {
+		sum, ok := e.sums[alg]
+		if !ok || sum == "" {
+			return nil, fmt.Errorf("%w: %v for %v", ErrMissingChecksum, alg, e.path)
+		}
+		fmt.Fprintf(&buf, "%s  %s\n", strings.ToLower(sum), encodePath(PayloadDir+"/"+e.path))
+	}
+	return buf.Bytes(), nil
+}
+
+// encodePath percent-encodes the characters, which must not appear in
+// manifest paths, RFC 8493, 2.1.3.
+func encodePath(p string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(p)
+}
@@ -0,0 +1,52 @@
+package bagit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTagFiles(t *testing.T) {
+	b := New()
+	b.SetInfo("Source-Organization", "Internet Archive")
+	b.Add("b.txt", 3, map[string]string{"md5": "BB"})
+	b.Add("a/100%\n.txt", 5, map[string]string{"md5": "aa"})
+	files, err := b.TagFiles("md5")
+	if err != nil {
+		t.Fatalf("tag files failed: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if got, want := strings.Join(names, ","), "bagit.txt,bag-info.txt,manifest-md5.txt,tagmanifest-md5.txt"; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	var cases = []struct {
+		got, want string
+	}{
+		{string(files[0].Content), "BagIt-Version: 1.0\nTag-File-Character-Encoding: UTF-8\n"},
+		{string(files[1].Content), "Source-Organization: Internet Archive\nPayload-Oxum: 8.2\n"},
+		{string(files[2].Content), "aa  data/a/100%25%0A.txt\nbb  data/b.txt\n"},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("got %q, want %q", c.got, c.want)
+		}
+	}
+	if lines := strings.Split(strings.TrimSpace(string(files[3].Content)), "\n"); len(lines) != 3 ||
+		!strings.HasSuffix(lines[0], "  bagit.txt") {
+		t.Errorf("unexpected tag manifest: %q", files[3].Content)
+	}
+}
+
+func TestTagFilesErrors(t *testing.T) {
+	b := New()
+	b.Add("a.txt", 1, map[string]string{"md5": "aa"})
+	if _, err := b.TagFiles("crc32"); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("got %v, want %v", err, ErrUnsupportedAlgorithm)
+	}
+	if _, err := b.TagFiles("sha256"); !errors.Is(err, ErrMissingChecksum) {
+		t.Errorf("got %v, want %v", err, ErrMissingChecksum)
+	}
+}
@@ -0,0 +1,151 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/iotemp"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultBenchmarkSize        = fs.SizeSuffix(1 << 30)
+	defaultBenchmarkFiles       = 10
+	defaultBenchmarkChunkSizes  = "1M,16M,64M"
+	defaultBenchmarkConcurrency = "1,4"
+)
+
+// benchmarkConfig is a single configuration to measure.
+type benchmarkConfig struct {
+	chunkSize   fs.SizeSuffix
+	concurrency int
+}
+
+// benchmarkCommand uploads synthetic data with each combination of chunk size
+// and concurrency and reports the throughput per configuration. The uploaded
+// files are part of the current deposit and are kept.
+func (f *Fs) benchmarkCommand(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	var (
+		size         = defaultBenchmarkSize
+		files        = defaultBenchmarkFiles
+		chunkSizes   []fs.SizeSuffix
+		concurrences []int
+	)
+	if v, ok := opt["size"]; ok {
+		if err := size.Set(v); err != nil {
+			return nil, fmt.Errorf("invalid size: %w", err)
+		}
+	}
+	if v, ok := opt["files"]; ok {
+		if files, err = strconv.Atoi(v); err != nil || files < 1 {
+			return nil, fmt.Errorf("invalid number of files: %q", v)
+		}
+	}
+	if chunkSizes, err = parseSizeList(optOrDefault(opt, "chunk_sizes", defaultBenchmarkChunkSizes)); err != nil {
+		return nil, err
+	}
+	if concurrences, err = parseIntList(optOrDefault(opt, "concurrency", defaultBenchmarkConcurrency)); err != nil {
+		return nil, err
+	}
+	return f.benchmark(ctx, "rclone-benchmark", size, files, chunkSizes, concurrences)
+}
+
+// benchmark runs every combination of chunk size and concurrency, uploading
+// into a timestamped folder named after prefix.
+func (f *Fs) benchmark(ctx context.Context, prefix string, size fs.SizeSuffix, files int, chunkSizes []fs.SizeSuffix, concurrences []int) (result []map[string]interface{}, err error) {
+	var (
+		// Changing the chunk size is only safe, while no other uploads are
+		// running, which is the case for a backend command.
+		origChunkSize = f.opt.ChunkSize
+		dir           = fmt.Sprintf("%s-%s", prefix, time.Now().Format("20060102-150405"))
+	)
+	defer func() { f.opt.ChunkSize = origChunkSize }()
+	for _, cs := range chunkSizes {
+		for _, c := range concurrences {
+			cfg := benchmarkConfig{chunkSize: cs, concurrency: c}
+			fs.Infof(f, "benchmark: uploading %v in %d files, chunk size %v, concurrency %d", size, files, cs, c)
+			elapsed, err := f.benchmarkRun(ctx, path.Join(dir, fmt.Sprintf("%v-%d", cs, c)), cfg, int64(size), files)
+			if err != nil {
+				return result, fmt.Errorf("benchmark chunk size %v, concurrency %d: %w", cs, c, err)
+			}
+			bps := float64(size) / elapsed.Seconds()
+			result = append(result, map[string]interface{}{
+				"chunkSize":      int64(cs),
+				"concurrency":    c,
+				"bytes":          int64(size),
+				"files":          files,
+				"seconds":        elapsed.Seconds(),
+				"bytesPerSecond": int64(bps),
+				"throughput":     fs.SizeSuffix(bps).ByteUnit() + "/s",
+			})
+		}
+	}
+	return result, nil
+}
+
+// benchmarkRun uploads size bytes, split into n files, into dir and returns
+// the elapsed time.
+func (f *Fs) benchmarkRun(ctx context.Context, dir string, cfg benchmarkConfig, size int64, n int) (time.Duration, error) {
+	f.opt.ChunkSize = int64(cfg.chunkSize)
+	var (
+		g, gctx = errgroup.WithContext(ctx)
+		started = time.Now()
+	)
+	g.SetLimit(cfg.concurrency)
+	for i := 0; i < n; i++ {
+		fileSize := size / int64(n)
+		if i == n-1 {
+			fileSize += size % int64(n)
+		}
+		var (
+			remote = path.Join(dir, fmt.Sprintf("file-%06d.bin", i))
+			src    = object.NewStaticObjectInfo(remote, started, fileSize, true, nil, f)
+		)
+		g.Go(func() error {
+			_, err := f.Put(gctx, &iotemp.DummyReader{N: fileSize, C: '.'}, src)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return 0, err
+	}
+	return time.Since(started), nil
+}
+
+// optOrDefault returns the value of key in opt or a default value.
+func optOrDefault(opt map[string]string, key, value string) string {
+	if v, ok := opt[key]; ok {
+		return v
+	}
+	return value
+}
+
+// parseSizeList parses a comma separated list of sizes, like "1M,16M".
+func parseSizeList(s string) (result []fs.SizeSuffix, err error) {
+	for _, v := range strings.Split(s, ",") {
+		var size fs.SizeSuffix
+		if err := size.Set(strings.TrimSpace(v)); err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid size %q", v)
+		}
+		result = append(result, size)
+	}
+	return result, nil
+}
+
+// parseIntList parses a comma separated list of positive integers.
+func parseIntList(s string) (result []int, err error) {
+	for _, v := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || i < 1 {
+			return nil, fmt.Errorf("invalid number %q", v)
+		}
+		result = append(result, i)
+	}
+	return result, nil
+}
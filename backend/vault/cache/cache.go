@@ -1,59 +1,161 @@
-// Package cache implements a minimal in-memory cache.
+// Package cache implements a minimal in-memory cache and a persistent cache
+// backed by a bolt database.
 package cache
 
 import (
+	"container/list"
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 )
 
+// Option configures a cache.
+type Option func(*Cache)
+
+// WithTTL sets the default time to live for entries, zero means entries do
+// not expire.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithMaxEntries limits the number of entries, evicting the least recently
+// used entry first. Zero means no limit.
+func WithMaxEntries(n int) Option {
+	return func(c *Cache) {
+		c.maxEntries = n
+	}
+}
+
 // New sets up a basic cache using a map.
-func New() *Cache {
-	return &Cache{
-		m: make(map[string]interface{}),
+func New(opts ...Option) *Cache {
+	c := &Cache{
+		m:  make(map[string]*list.Element),
+		ll: list.New(),
 		groupKeyFunc: func(k, g string) string {
 			return fmt.Sprintf("%s-%s", k, g)
 		},
+		now: time.Now,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Cache is a generic thread safe cache for local use.
 type Cache struct {
 	groupKeyFunc func(k, g string) string
+	ttl          time.Duration    // default ttl, zero for no expiry
+	maxEntries   int              // max number of entries, zero for no limit
+	now          func() time.Time // for testing
 	mu           sync.Mutex
-	m            map[string]interface{}
+	m            map[string]*list.Element
+	ll           *list.List // most recently used in front
+	stats        Stats
+}
+
+// entry is a single cached value.
+type entry struct {
+	key     string
+	value   interface{}
+	expires time.Time // zero for no expiry
 }
 
-// Reset clears the cache.
+// Stats contains cache counters.
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64 // entries removed due to size limit or expiry
+	Entries   int
+}
+
+// Reset clears the cache. Counters are kept.
 func (c *Cache) Reset() {
 	c.mu.Lock()
-	c.m = make(map[string]interface{})
+	c.m = make(map[string]*list.Element)
+	c.ll.Init()
 	c.mu.Unlock()
 }
 
+// Stats returns a snapshot of the cache counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.ll.Len()
+	return stats
+}
+
 // SetGroup set a key within a group.
 func (c *Cache) SetGroup(k, group string, v interface{}) {
 	c.Set(c.groupKeyFunc(k, group), v)
 }
 
+// SetGroupTTL sets a key within a group with a custom time to live.
+func (c *Cache) SetGroupTTL(k, group string, v interface{}, ttl time.Duration) {
+	c.SetTTL(c.groupKeyFunc(k, group), v, ttl)
+}
+
 // GetGroup gets the value for a key within a group.
 func (c *Cache) GetGroup(k, group string) interface{} {
 	return c.Get(c.groupKeyFunc(k, group))
 }
 
-// Set value for a key.
+// Set value for a key, using the default time to live.
 func (c *Cache) Set(k string, v interface{}) {
+	c.SetTTL(k, v, c.ttl)
+}
+
+// SetTTL sets the value for a key, which expires after ttl. A zero ttl means
+// the value does not expire.
+func (c *Cache) SetTTL(k string, v interface{}, ttl time.Duration) {
 	c.mu.Lock()
-	c.m[k] = v
-	c.mu.Unlock()
+	defer c.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+	if elem, ok := c.m[k]; ok {
+		c.ll.MoveToFront(elem)
+		e := elem.Value.(*entry)
+		e.value, e.expires = v, expires
+		return
+	}
+	c.m[k] = c.ll.PushFront(&entry{key: k, value: v, expires: expires})
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
 }
 
-// Get value for a key.
+// Get value for a key, nil if the key does not exist or has expired.
 func (c *Cache) Get(k string) interface{} {
 	c.mu.Lock()
-	result := c.m[k]
-	c.mu.Unlock()
-	return result
+	defer c.mu.Unlock()
+	elem, ok := c.m[k]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	e := elem.Value.(*entry)
+	if !e.expires.IsZero() && c.now().After(e.expires) {
+		c.removeElement(elem)
+		c.stats.Evictions++
+		c.stats.Misses++
+		return nil
+	}
+	c.ll.MoveToFront(elem)
+	c.stats.Hits++
+	return e.value
+}
+
+// removeElement drops an entry, expects the lock to be held.
+func (c *Cache) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.m, elem.Value.(*entry).key)
 }
 
 // Atos stringifies a value. Panics if the value cannot be marshalled.
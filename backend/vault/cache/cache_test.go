@@ -1,6 +1,9 @@
 package cache
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestCache(t *testing.T) {
 	cache := New()
@@ -32,3 +35,46 @@ func TestCache(t *testing.T) {
 		t.Fatalf("cache: cannot get value out")
 	}
 }
+
+func TestCacheTTL(t *testing.T) {
+	var (
+		now   = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache = New(WithTTL(time.Minute))
+	)
+	cache.now = func() time.Time { return now }
+	cache.Set("k", "v")
+	cache.SetTTL("forever", "v", 0)
+	if v := cache.Get("k"); v != "v" {
+		t.Fatalf("cache: got %v, want v", v)
+	}
+	now = now.Add(2 * time.Minute)
+	if v := cache.Get("k"); v != nil {
+		t.Fatalf("cache: entry did not expire")
+	}
+	if v := cache.Get("forever"); v != "v" {
+		t.Fatalf("cache: entry without ttl expired")
+	}
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Evictions != 1 || stats.Entries != 1 {
+		t.Fatalf("cache: unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	cache := New(WithMaxEntries(2))
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Get("a") // b is now least recently used
+	cache.Set("c", 3)
+	if v := cache.Get("b"); v != nil {
+		t.Fatalf("cache: expected b to be evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if v := cache.Get(k); v == nil {
+			t.Fatalf("cache: %v evicted", k)
+		}
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Fatalf("cache: unexpected stats: %+v", stats)
+	}
+}
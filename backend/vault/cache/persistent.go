@@ -0,0 +1,165 @@
+//go:build !plan9 && !js
+
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// persistentBucket holds all entries of a persistent cache.
+var persistentBucket = []byte("cache")
+
+// Persistent is a cache backed by a bolt database file, so entries survive
+// across invocations. Values are stored as JSON.
+type Persistent struct {
+	db  *bbolt.DB
+	ttl time.Duration    // zero for no expiry
+	now func() time.Time // for testing
+	mu  sync.Mutex       // protects stats
+	// stats.Entries is not tracked
+	stats Stats
+}
+
+// persistentEntry is the stored form of a value.
+type persistentEntry struct {
+	Expires time.Time       `json:"expires,omitempty"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// OpenPersistent opens or creates a persistent cache at filename, with
+// entries expiring after ttl. If another process holds the database, this
+// fails after a short timeout.
+func OpenPersistent(filename string, ttl time.Duration) (*Persistent, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(filename, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(persistentBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Persistent{db: db, ttl: ttl, now: time.Now}, nil
+}
+
+// Get decodes the value for a key into v and returns true, if the key exists
+// and has not expired.
+func (p *Persistent) Get(k string, v interface{}) bool {
+	var e persistentEntry
+	err := p.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(persistentBucket).Get([]byte(k))
+		if b == nil {
+			return os.ErrNotExist
+		}
+		return json.Unmarshal(b, &e)
+	})
+	ok := err == nil &&
+		(e.Expires.IsZero() || !p.now().After(e.Expires)) &&
+		json.Unmarshal(e.Value, v) == nil
+	p.mu.Lock()
+	if ok {
+		p.stats.Hits++
+	} else {
+		p.stats.Misses++
+	}
+	p.mu.Unlock()
+	return ok
+}
+
+// Set stores the value for a key.
+func (p *Persistent) Set(k string, v interface{}) error {
+	return p.SetMany(map[string]interface{}{k: v})
+}
+
+// SetMany stores many values at once, in a single transaction, which is much
+// faster than a Set per value.
+func (p *Persistent) SetMany(values map[string]interface{}) error {
+	var expires time.Time
+	if p.ttl > 0 {
+		expires = p.now().Add(p.ttl)
+	}
+	entries := make(map[string][]byte, len(values))
+	for k, v := range values {
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(persistentEntry{Expires: expires, Value: value})
+		if err != nil {
+			return err
+		}
+		entries[k] = b
+	}
+	return p.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(persistentBucket)
+		for k, b := range entries {
+			if err := bucket.Put([]byte(k), b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete removes the given keys and all keys starting with one of prefixes,
+// in a single transaction.
+func (p *Persistent) Delete(keys, prefixes []string) error {
+	return p.db.Update(func(tx *bbolt.Tx) error {
+		var (
+			bucket  = tx.Bucket(persistentBucket)
+			deleted [][]byte
+		)
+		for _, k := range keys {
+			deleted = append(deleted, []byte(k))
+		}
+		// Deleting while iterating may skip keys, so collect them first.
+		for _, prefix := range prefixes {
+			c := bucket.Cursor()
+			for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+				deleted = append(deleted, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range deleted {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Reset removes all entries.
+func (p *Persistent) Reset() error {
+	return p.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(persistentBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(persistentBucket)
+		return err
+	})
+}
+
+// Stats returns a snapshot of the cache counters.
+func (p *Persistent) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Close closes the database file.
+func (p *Persistent) Close() error {
+	return p.db.Close()
+}
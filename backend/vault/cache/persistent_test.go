@@ -0,0 +1,88 @@
+//go:build !plan9 && !js
+
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersistent(t *testing.T) {
+	var (
+		filename = filepath.Join(t.TempDir(), "cache.db")
+		now      = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		v        struct{ Name string }
+	)
+	p, err := OpenPersistent(filename, time.Minute)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	p.now = func() time.Time { return now }
+	if err := p.Set("k", struct{ Name string }{"a"}); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	// Reopen, entries must survive.
+	if p, err = OpenPersistent(filename, time.Minute); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer p.Close() // nolint:errcheck
+	p.now = func() time.Time { return now }
+	if !p.Get("k", &v) || v.Name != "a" {
+		t.Fatalf("cache: got %v, want a", v)
+	}
+	now = now.Add(2 * time.Minute)
+	if p.Get("k", &v) {
+		t.Fatalf("cache: entry did not expire")
+	}
+	now = now.Add(-2 * time.Minute)
+	if err := p.Reset(); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if p.Get("k", &v) {
+		t.Fatalf("cache: reset failed")
+	}
+	if stats := p.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Fatalf("cache: unexpected stats: %+v", stats)
+	}
+}
+
+func TestPersistentSetMany(t *testing.T) {
+	p, err := OpenPersistent(filepath.Join(t.TempDir(), "cache.db"), 0)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer p.Close() // nolint:errcheck
+	if err := p.SetMany(map[string]interface{}{"a": 1, "b": 2}); err != nil {
+		t.Fatalf("set many failed: %v", err)
+	}
+	for k, want := range map[string]int{"a": 1, "b": 2} {
+		var v int
+		if !p.Get(k, &v) || v != want {
+			t.Errorf("cache: got %v for %v, want %v", v, k, want)
+		}
+	}
+}
+
+func TestPersistentDelete(t *testing.T) {
+	p, err := OpenPersistent(filepath.Join(t.TempDir(), "cache.db"), 0)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer p.Close() // nolint:errcheck
+	if err := p.SetMany(map[string]interface{}{"a": 1, "b": 2, "c/": 3, "c/d": 4, "cd": 5}); err != nil {
+		t.Fatalf("set many failed: %v", err)
+	}
+	if err := p.Delete([]string{"a"}, []string{"c/"}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	for k, want := range map[string]bool{"a": false, "b": true, "c/": false, "c/d": false, "cd": true} {
+		var v int
+		if got := p.Get(k, &v); got != want {
+			t.Errorf("cache: got %v for %v, want %v", got, k, want)
+		}
+	}
+}
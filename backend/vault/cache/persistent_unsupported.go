@@ -0,0 +1,41 @@
+//go:build plan9 || js
+
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned, if a persistent cache is not available on this
+// platform.
+var ErrUnsupported = errors.New("persistent cache not supported on this platform")
+
+// Persistent is not supported on this platform.
+type Persistent struct{}
+
+// OpenPersistent always fails on this platform.
+func OpenPersistent(filename string, ttl time.Duration) (*Persistent, error) {
+	return nil, ErrUnsupported
+}
+
+// Get never finds anything.
+func (p *Persistent) Get(k string, v interface{}) bool { return false }
+
+// Set does nothing.
+func (p *Persistent) Set(k string, v interface{}) error { return ErrUnsupported }
+
+// SetMany does nothing.
+func (p *Persistent) SetMany(values map[string]interface{}) error { return ErrUnsupported }
+
+// Delete does nothing.
+func (p *Persistent) Delete(keys, prefixes []string) error { return nil }
+
+// Reset does nothing.
+func (p *Persistent) Reset() error { return nil }
+
+// Stats returns empty stats.
+func (p *Persistent) Stats() Stats { return Stats{} }
+
+// Close does nothing.
+func (p *Persistent) Close() error { return nil }
@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+)
+
+const (
+	defaultCalibrateSize        = fs.SizeSuffix(64 << 20)
+	defaultCalibrateFiles       = 4
+	defaultCalibrateChunkSizes  = "1M,4M,16M,64M"
+	defaultCalibrateConcurrency = "1,2,4"
+)
+
+// Calibration is the outcome of a calibration run: the measured
+// configurations and the fastest one.
+type Calibration struct {
+	Results   []map[string]interface{} `json:"results"`
+	ChunkSize string                   `json:"chunkSize"`
+	Transfers int                      `json:"transfers"`
+	Saved     bool                     `json:"saved"`
+}
+
+// calibrateCommand uploads a short synthetic deposit with a number of chunk
+// sizes and concurrencies, recommends the fastest configuration and, if
+// requested, writes the chunk size into the config section of the remote.
+func (f *Fs) calibrateCommand(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	var (
+		size         = defaultCalibrateSize
+		files        = defaultCalibrateFiles
+		_, save      = opt["save"]
+		chunkSizes   []fs.SizeSuffix
+		concurrences []int
+	)
+	if v, ok := opt["size"]; ok {
+		if err := size.Set(v); err != nil {
+			return nil, fmt.Errorf("invalid size: %w", err)
+		}
+	}
+	if v, ok := opt["files"]; ok {
+		if files, err = strconv.Atoi(v); err != nil || files < 1 {
+			return nil, fmt.Errorf("invalid number of files: %q", v)
+		}
+	}
+	if chunkSizes, err = parseSizeList(optOrDefault(opt, "chunk_sizes", defaultCalibrateChunkSizes)); err != nil {
+		return nil, err
+	}
+	if concurrences, err = parseIntList(optOrDefault(opt, "concurrency", defaultCalibrateConcurrency)); err != nil {
+		return nil, err
+	}
+	results, err := f.benchmark(ctx, "rclone-calibrate", size, files, chunkSizes, concurrences)
+	if err != nil {
+		return nil, err
+	}
+	best := fastest(results)
+	if best == nil {
+		return nil, fmt.Errorf("calibration produced no results")
+	}
+	var (
+		chunkSize = fs.SizeSuffix(best["chunkSize"].(int64))
+		c         = &Calibration{
+			Results:   results,
+			ChunkSize: chunkSize.String(),
+			Transfers: best["concurrency"].(int),
+		}
+	)
+	fs.Infof(f, "calibrate: recommending chunk size %v with --transfers %d (%v)", chunkSize, c.Transfers, best["throughput"])
+	if save {
+		// The chunk_size option is a plain number of bytes.
+		if err := config.SetValueAndSave(f.name, "chunk_size", strconv.FormatInt(int64(chunkSize), 10)); err != nil {
+			return c, fmt.Errorf("failed to save chunk size: %w", err)
+		}
+		c.Saved = true
+		fs.Infof(f, "calibrate: saved chunk_size = %d to config section %q", int64(chunkSize), f.name)
+	}
+	return c, nil
+}
+
+// fastest returns the result with the highest throughput; on a tie the
+// earlier, smaller configuration wins.
+func fastest(results []map[string]interface{}) (best map[string]interface{}) {
+	for _, r := range results {
+		if best == nil || r["bytesPerSecond"].(int64) > best["bytesPerSecond"].(int64) {
+			best = r
+		}
+	}
+	return best
+}
@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/backend/vault/oapi"
+	"github.com/rclone/rclone/fs"
+)
+
+// ErrNoCollection is returned by collection commands run on the organization
+// root.
+var ErrNoCollection = errors.New("remote root is not within a collection")
+
+// ErrCollectionMove is returned by DirMove for a collection moved into a
+// folder, as collections only exist at the top level.
+var ErrCollectionMove = errors.New("collections can only be renamed, not moved into a folder")
+
+// collectionSetCommand changes fixity frequency and target replication of the
+// collection of the remote root.
+func (f *Fs) collectionSetCommand(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	var settings oapi.CollectionSettings
+	for k, v := range opt {
+		switch k {
+		case "fixity_frequency":
+			settings.FixityFrequency = strings.ToUpper(v)
+		case "replication":
+			if settings.TargetReplication, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid replication: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown option: %v", k)
+		}
+	}
+	if settings == (oapi.CollectionSettings{}) {
+		return nil, errors.New("nothing to change, use fixity_frequency or replication")
+	}
+	if err := checkCollectionSettings(settings); err != nil {
+		return nil, err
+	}
+	c, err := f.rootCollection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.api.UpdateCollection(ctx, c, settings); err != nil {
+		return nil, err
+	}
+	fs.Infof(f, "updated collection %v", c.Name)
+	return nil, nil
+}
+
+// renameCollection renames the collection of treenode t through the
+// collections endpoint, as a collection is more than its treenode. The new
+// parent must be the organization and there must be no treenode at the
+// destination, dst.
+func (f *Fs) renameCollection(ctx context.Context, t, dstParent, dst *api.TreeNode, name string) error {
+	switch {
+	case dstParent.NodeType != "ORGANIZATION":
+		return fmt.Errorf("%w: %v", ErrCollectionMove, t.Name)
+	case dst != nil:
+		return fs.ErrorDirExists
+	}
+	c, err := f.api.TreeNodeToCollection(ctx, t)
+	if err != nil {
+		return fmt.Errorf("failed to resolve treenode to collection: %w", err)
+	}
+	if err := f.api.RenameCollection(ctx, c, name); err != nil {
+		return fmt.Errorf("cannot rename collection %v to %v: %w", c.Name, name, err)
+	}
+	fs.Infof(f, "renamed collection %v to %v", c.Name, name)
+	return nil
+}
+
+// rootCollection returns the collection containing the remote root.
+func (f *Fs) rootCollection(ctx context.Context) (*api.Collection, error) {
+	segments := pathSegments(f.absPath(""), "/")
+	if len(segments) == 0 {
+		return nil, ErrNoCollection
+	}
+	collections, err := f.api.FindCollections(ctx, url.Values{"name": []string{segments[0]}})
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, fmt.Errorf("collection %v: %w", segments[0], fs.ErrorDirNotFound)
+	}
+	return collections[0], nil
+}
+
+// checkCollectionSettings validates fixity frequency and target replication,
+// empty values are valid and mean the plan default.
+func checkCollectionSettings(settings oapi.CollectionSettings) error {
+	switch settings.FixityFrequency {
+	case "", "TWICE_YEARLY", "QUARTERLY", "MONTHLY":
+	default:
+		return fmt.Errorf("invalid fixity frequency %q, must be TWICE_YEARLY, QUARTERLY or MONTHLY", settings.FixityFrequency)
+	}
+	switch settings.TargetReplication {
+	case 0, 2, 3, 4:
+	default:
+		return fmt.Errorf("invalid target replication %d, must be 2, 3 or 4", settings.TargetReplication)
+	}
+	return nil
+}
+
+// collectionSettings returns the settings for collections created by mkdir.
+func (f *Fs) collectionSettings() oapi.CollectionSettings {
+	return oapi.CollectionSettings{
+		FixityFrequency:   f.opt.CollectionFixityFrequency,
+		TargetReplication: f.opt.CollectionTargetReplication,
+	}
+}
@@ -0,0 +1,94 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/lib/oauthutil"
+	"github.com/rclone/rclone/lib/terminal"
+)
+
+// canAsk returns true, if the config questions are answered by a person. A
+// config created from a script, e.g. with --non-interactive from cron, or
+// with answers confirmed automatically, cannot fix a failed connection test.
+var canAsk = func(ctx context.Context) bool {
+	return !fs.GetConfig(ctx).AutoConfirm && terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// vaultConfig runs after the options have been entered: it completes the
+// OAuth2 flow, if a token URL is configured, and then tests the connection,
+// so a remote with a wrong endpoint or wrong credentials can be fixed before
+// it is saved. Without a person to ask, a failed test is an error and the
+// remote is not saved.
+func vaultConfig(ctx context.Context, name string, m configmap.Mapper, in fs.ConfigIn) (*fs.ConfigOut, error) {
+	switch in.State {
+	case "":
+		// OAuth2 is only used, if a token URL has been configured,
+		// e.g. for an SSO provider in front of vault.
+		if tokenURL, ok := m.Get(config.ConfigTokenURL); ok && tokenURL != "" {
+			return oauthutil.ConfigOut("check", &oauthutil.Options{
+				OAuth2Config: oauthConfig,
+			})
+		}
+		return fs.ConfigGoto("check")
+	case "check":
+		user, version, err := checkConnection(ctx, name, m)
+		switch {
+		case err != nil && !canAsk(ctx):
+			return nil, fmt.Errorf("connection test failed, check endpoint and credentials: %w", err)
+		case err != nil:
+			return fs.ConfigConfirm("check_failed", true, "config_fix_connection",
+				fmt.Sprintf("Connection test failed: %v\n\nEdit endpoint and credentials?", err))
+		}
+		fs.Logf(name, "connection test ok: logged in as %v, server api version %v", user, version)
+		return nil, nil
+	case "check_failed":
+		if in.Result == "false" {
+			fs.Logf(name, "keeping remote, although the connection test failed")
+			return nil, nil
+		}
+		endpoint, _ := m.Get("endpoint")
+		out, err := fs.ConfigInput("endpoint", "config_endpoint", "Vault API endpoint URL")
+		out.Option.Default = endpoint
+		return out, err
+	case "endpoint":
+		m.Set("endpoint", in.Result)
+		username, _ := m.Get("username")
+		out, err := fs.ConfigInputOptional("username", "config_username", "Vault username, leave empty when using an api key")
+		out.Option.Default = username
+		return out, err
+	case "username":
+		m.Set("username", in.Result)
+		if in.Result == "" {
+			return fs.ConfigGoto("check")
+		}
+		return fs.ConfigPassword("password", "config_password", "Vault password")
+	case "password":
+		m.Set("password", in.Result) // obscured already
+		return fs.ConfigGoto("check")
+	}
+	return nil, fmt.Errorf("unknown state %q", in.State)
+}
+
+// checkConnection logs in and checks the server api version, returning the
+// username and the server version.
+func checkConnection(ctx context.Context, name string, m configmap.Mapper) (user, version string, err error) {
+	f, err := NewFs(ctx, name, "", m)
+	if err != nil {
+		return "", "", err
+	}
+	vf := f.(*Fs)
+	vf.unregisterAtexit()
+	defer func() {
+		_ = vf.Disconnect(ctx)
+	}()
+	u, err := vf.api.User(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return u.Username, vf.api.Version(ctx), nil
+}
@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+func TestConfigConnectionTest(t *testing.T) {
+	var (
+		ctx = context.Background()
+		srv = newTestServer(t)
+	)
+	defer func(fn func(context.Context) bool) { canAsk = fn }(canAsk)
+	canAsk = func(context.Context) bool { return true }
+	m := configmap.Simple{
+		"endpoint":   srv.Endpoint(),
+		"username":   testUsername,
+		"password":   obscure.MustObscure("wrong"),
+		"chunk_size": "1024",
+	}
+	out, err := vaultConfig(ctx, "vaulttest", m, fs.ConfigIn{})
+	if err != nil || out.State != "check" {
+		t.Fatalf("got %v, %v, want check state", out, err)
+	}
+	out, err = vaultConfig(ctx, "vaulttest", m, fs.ConfigIn{State: "check"})
+	if err != nil || out == nil || out.Option == nil || out.Option.Name != "config_fix_connection" {
+		t.Fatalf("got %v, %v, want question to fix connection", out, err)
+	}
+	// Enter endpoint and credentials again.
+	for _, step := range []struct{ state, result, next string }{
+		{"check_failed", "true", "endpoint"},
+		{"endpoint", srv.Endpoint(), "username"},
+		{"username", testUsername, "password"},
+		{"password", obscure.MustObscure(testPassword), "check"},
+	} {
+		out, err = vaultConfig(ctx, "vaulttest", m, fs.ConfigIn{State: step.state, Result: step.result})
+		if err != nil || out.State != step.next {
+			t.Fatalf("%s: got %v, %v, want %s state", step.state, out, err, step.next)
+		}
+	}
+	out, err = vaultConfig(ctx, "vaulttest", m, fs.ConfigIn{State: "check"})
+	if err != nil || out != nil {
+		t.Fatalf("got %v, %v, want success", out, err)
+	}
+}
+
+func TestConfigNonInteractive(t *testing.T) {
+	var (
+		ctx = context.Background()
+		srv = newTestServer(t)
+	)
+	defer func(fn func(context.Context) bool) { canAsk = fn }(canAsk)
+	canAsk = func(context.Context) bool { return false }
+	m := configmap.Simple{
+		"endpoint":   srv.Endpoint(),
+		"username":   testUsername,
+		"password":   obscure.MustObscure("wrong"),
+		"chunk_size": "1024",
+	}
+	if _, err := vaultConfig(ctx, "vaulttest", m, fs.ConfigIn{State: "check"}); err == nil {
+		t.Fatalf("expected error for wrong credentials")
+	}
+	m.Set("password", obscure.MustObscure(testPassword))
+	if out, err := vaultConfig(ctx, "vaulttest", m, fs.ConfigIn{State: "check"}); err != nil || out != nil {
+		t.Fatalf("got %v, %v, want success", out, err)
+	}
+}
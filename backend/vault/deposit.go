@@ -0,0 +1,89 @@
+package vault
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/api"
+)
+
+// deposit is the state of a deposit registered by an Fs, from registration
+// until it is finalized or terminated. Every Fs keeps its own deposits, so
+// several vault remotes in one command, e.g. a copy between two vault
+// remotes, never add files to or finalize each other's deposits. All fields
+// are locked by the mu of the Fs.
+type deposit struct {
+	id         int                      // deposit id
+	dir        string                   // absolute path of the directory deposited to
+	started    time.Time                // registration time
+	files      int64                    // files uploaded completely
+	bytes      int64                    // bytes of the files uploaded completely
+	sentBytes  int64                    // bytes of chunks sent
+	progressed time.Time                // time of the last progress message
+	manifest   []*ManifestFile          // files, if manifest_path is set
+	superseded map[string]*api.TreeNode // absolute path to file updated in this deposit
+	renamed    map[string]string        // sanitized absolute path to original remote
+	deposited  map[string]string        // remote in vault to source remote
+}
+
+// newDeposit returns the state of a freshly registered deposit into dir.
+func newDeposit(id int, dir string) *deposit {
+	return &deposit{
+		id:         id,
+		dir:        dir,
+		started:    time.Now(),
+		superseded: make(map[string]*api.TreeNode),
+		renamed:    make(map[string]string),
+		deposited:  make(map[string]string),
+	}
+}
+
+// depositDir returns the absolute path of the directory a file at remote is
+// deposited to and the path of the file relative to that directory. Below a
+// collection, all files go into one deposit to the root. At the organization
+// root, every collection gets a deposit of its own, so a sync into several
+// collections registers one deposit per collection.
+func (f *Fs) depositDir(remote string) (dir, rel string, err error) {
+	if strings.Trim(f.root, "/") != "" {
+		return f.absPath(""), remote, nil
+	}
+	segments := strings.SplitN(strings.Trim(remote, "/"), "/", 2)
+	if len(segments) < 2 || segments[0] == "" {
+		return "", "", ErrCannotCopyToRoot
+	}
+	return f.absPath(segments[0]), segments[1], nil
+}
+
+// depositByID returns the inflight deposit with the given id, nil if there
+// is none. Expects f.mu to be held.
+func (f *Fs) depositByID(id int) *deposit {
+	for _, d := range f.deposits {
+		if d.id == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// depositByPath returns the inflight deposit of the file at the absolute path
+// p, nil if there is none. Expects f.mu to be held.
+func (f *Fs) depositByPath(p string) *deposit {
+	for dir, d := range f.deposits {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return d
+		}
+	}
+	return nil
+}
+
+// inflightIDs returns the ids of all inflight deposits, in order. Expects f.mu
+// to be held.
+func (f *Fs) inflightIDs() []int {
+	ids := make([]int, 0, len(f.deposits))
+	for _, d := range f.deposits {
+		ids = append(ids, d.id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/backend/vault/oapi"
+)
+
+// depositTarget is where a deposit goes, either a collection or a folder.
+type depositTarget struct {
+	CollectionID int // collection id, if depositing into a collection root
+	ParentNodeID int // treenode id, if depositing into a folder
+}
+
+// depositor is a version of the deposit API. A deposit is registered once,
+// files are sent in chunks and the deposit is finalized or terminated at the
+// end. Versions are registered in depositAPIs, so a new version can be added
+// side by side with the existing ones.
+type depositor interface {
+	// register starts a new deposit and returns its id.
+	register(ctx context.Context, target depositTarget) (int, error)
+	// sendChunk sends a single multipart encoded chunk; errors responses
+	// are returned as *oapi.APIError.
+	sendChunk(ctx context.Context, contentType string, body io.Reader) error
+	// finalize signals that all files of a deposit have been sent.
+	finalize(ctx context.Context, id int) error
+	// terminate discards a deposit.
+	terminate(ctx context.Context, id int) error
+	// status returns the processing status of a deposit.
+	status(ctx context.Context, id int) (*api.DepositStatus, error)
+}
+
+// depositAPIs maps deposit API versions to their constructors.
+var depositAPIs = map[string]func(opt *Options, capi *oapi.CompatAPI) (depositor, error){
+	"v2": newDepositV2,
+}
+
+// newDepositor returns the deposit API version requested by the deposit_api
+// option. If unset, the latest version is used.
+func newDepositor(opt *Options, capi *oapi.CompatAPI) (depositor, error) {
+	version := opt.DepositAPI
+	if version == "" {
+		// Only one version exists so far; servers without it are
+		// rejected by requestDeposit.
+		version = "v2"
+	}
+	fn, ok := depositAPIs[version]
+	if !ok {
+		var versions []string
+		for k := range depositAPIs {
+			versions = append(versions, k)
+		}
+		sort.Strings(versions)
+		return nil, fmt.Errorf("unsupported deposit api %q, must be one of %v", version, strings.Join(versions, ", "))
+	}
+	return fn(opt, capi)
+}
+
+// depositV2 implements the current deposit API at /api/deposits/v2/.
+type depositV2 struct {
+	client *ClientWithResponses
+	capi   *oapi.CompatAPI
+}
+
+func newDepositV2(opt *Options, capi *oapi.CompatAPI) (depositor, error) {
+	endpoint, err := opt.EndpointNormalizedDepositsV2()
+	if err != nil {
+		return nil, err
+	}
+	// The compat api is the doer, so deposit requests are paced as well.
+	client, err := NewClientWithResponses(endpoint,
+		WithHTTPClient(capi),
+		WithRequestEditorFn(capi.Authorize))
+	if err != nil {
+		return nil, err
+	}
+	return &depositV2{client: client, capi: capi}, nil
+}
+
+func (d *depositV2) register(ctx context.Context, target depositTarget) (int, error) {
+	body := VaultDepositApiRegisterDepositJSONRequestBody{}
+	if target.CollectionID != 0 {
+		body.CollectionId = &target.CollectionID
+	}
+	if target.ParentNodeID != 0 {
+		body.ParentNodeId = &target.ParentNodeID
+	}
+	resp, err := d.client.VaultDepositApiRegisterDepositWithResponse(ctx, body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode() != 200 {
+		return 0, oapi.NewAPIError("register deposit", resp.StatusCode(), resp.Body)
+	}
+	if resp.JSON200.DepositId == 0 {
+		return 0, ErrMissingDepositIdentifier
+	}
+	return resp.JSON200.DepositId, nil
+}
+
+func (d *depositV2) sendChunk(ctx context.Context, contentType string, body io.Reader) error {
+	resp, err := d.client.VaultDepositApiSendChunkWithBody(ctx, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode >= 400 {
+		return oapi.ErrorFromResponse("chunk upload", resp)
+	}
+	return nil
+}
+
+func (d *depositV2) finalize(ctx context.Context, id int) error {
+	body := VaultDepositApiFinalizeDepositJSONRequestBody{
+		DepositId: id,
+	}
+	resp, err := d.client.VaultDepositApiFinalizeDepositWithResponse(ctx, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != 200 {
+		return oapi.NewAPIError("finalize deposit", resp.StatusCode(), resp.Body)
+	}
+	return nil
+}
+
+func (d *depositV2) terminate(ctx context.Context, id int) error {
+	body := TerminateDepositRequest{
+		DepositId: id,
+	}
+	resp, err := d.client.VaultDepositApiTerminateDeposit(ctx, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode != 200 {
+		return oapi.ErrorFromResponse("terminate deposit", resp)
+	}
+	return nil
+}
+
+func (d *depositV2) status(ctx context.Context, id int) (*api.DepositStatus, error) {
+	return d.capi.DepositStatus(ctx, int64(id))
+}
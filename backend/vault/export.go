@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/bagit"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// exportFormats are the supported archive formats.
+var exportFormats = []string{"tar", "zip"}
+
+// archiveWriter writes files into an archive.
+type archiveWriter interface {
+	add(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+// tarWriter writes a POSIX tar archive.
+type tarWriter struct{ *tar.Writer }
+
+func (w tarWriter) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := w.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, r)
+	return err
+}
+
+// zipWriter writes a zip archive, compressing the files.
+type zipWriter struct{ *zip.Writer }
+
+func (w zipWriter) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	fw, err := w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+// exportCommand downloads all files below the root into a single archive in
+// a local directory. The archive is a BagIt bag, so the manifests record the
+// checksums of the files, computed during download.
+func (f *Fs) exportCommand(ctx context.Context, args []string, opt map[string]string) (out interface{}, err error) {
+	if len(args) != 1 {
+		return nil, errors.New("export requires a single local directory")
+	}
+	var (
+		format = optOrDefault(opt, "format", "tar")
+		name   = optOrDefault(opt, "name", path.Base(f.root))
+		algs   = strings.Split(optOrDefault(opt, "algorithms", defaultBagAlgorithms), ",")
+		types  []hash.Type
+	)
+	if f.root == "" {
+		return nil, errors.New("export requires a collection or folder")
+	}
+	if format != "tar" && format != "zip" {
+		return nil, fmt.Errorf("unsupported export format %q, must be one of %v", format, strings.Join(exportFormats, ", "))
+	}
+	for _, alg := range algs {
+		var ht hash.Type
+		if err := ht.Set(alg); err != nil {
+			return nil, fmt.Errorf("%w: %v", bagit.ErrUnsupportedAlgorithm, alg)
+		}
+		types = append(types, ht)
+	}
+	objs, err := listObjects(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	var remotes []string
+	for remote := range objs {
+		remotes = append(remotes, remote)
+	}
+	sort.Strings(remotes)
+	filename := filepath.Join(args[0], name+"."+format)
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(filename)
+		}
+	}()
+	defer file.Close() // nolint:errcheck
+	var w archiveWriter
+	if format == "zip" {
+		w = zipWriter{zip.NewWriter(file)}
+	} else {
+		w = tarWriter{tar.NewWriter(file)}
+	}
+	bag := bagit.New()
+	bag.SetInfo("Bagging-Date", time.Now().Format("2006-01-02"))
+	bag.SetInfo("Bag-Software-Agent", "rclone "+fs.Version)
+	bag.SetInfo("External-Identifier", path.Join("/", f.root))
+	for _, remote := range remotes {
+		sums, err := f.exportObject(ctx, w, path.Join(name, bagit.PayloadDir, remote), objs[remote], types)
+		if err != nil {
+			return nil, fmt.Errorf("export %v: %w", remote, err)
+		}
+		bag.Add(remote, objs[remote].Size(), sums)
+	}
+	tagFiles, err := bag.TagFiles(algs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, tf := range tagFiles {
+		if err := w.add(path.Join(name, tf.Name), int64(len(tf.Content)), time.Now(), bytes.NewReader(tf.Content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	fs.Infof(f, "exported %d files to %v", len(remotes), filename)
+	return map[string]interface{}{
+		"archive":     filename,
+		"payloadOxum": bag.PayloadOxum(),
+	}, nil
+}
+
+// exportObject writes a single object into the archive, returns its
+// checksums by algorithm name and verifies them against the checksums
+// stored in vault, if available.
+func (f *Fs) exportObject(ctx context.Context, w archiveWriter, name string, o fs.Object, types []hash.Type) (map[string]string, error) {
+	rc, err := o.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close() // nolint:errcheck
+	hasher, err := hash.NewMultiHasherTypes(hash.NewHashSet(types...))
+	if err != nil {
+		return nil, err
+	}
+	if err := w.add(name, o.Size(), o.ModTime(ctx), io.TeeReader(rc, hasher)); err != nil {
+		return nil, err
+	}
+	if hasher.Size() != o.Size() {
+		return nil, fmt.Errorf("short read: got %d bytes, want %d", hasher.Size(), o.Size())
+	}
+	sums := make(map[string]string)
+	for _, ht := range types {
+		sum, err := hasher.SumString(ht, false)
+		if err != nil {
+			return nil, err
+		}
+		if stored, err := o.Hash(ctx, ht); err == nil && stored != "" && !strings.EqualFold(stored, sum) {
+			return nil, fmt.Errorf("%v mismatch: vault %s, downloaded %s", ht, stored, sum)
+		}
+		sums[ht.String()] = sum
+	}
+	return sums, nil
+}
@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// fixityStatus is the outcome of the latest fixity check of a collection.
+type fixityStatus struct {
+	last   time.Time // zero, if never checked
+	errors int64
+	next   time.Time // zero, if never checked or without a frequency
+}
+
+// fixityCache holds the fixity status of all collections, loaded once, as
+// listings with metadata would otherwise fetch all events for every file.
+type fixityCache struct {
+	mu           sync.Mutex
+	byCollection map[string]*fixityStatus
+}
+
+// nextFixityCheck returns the time of the check after one at t, for a fixity
+// frequency, zero for an unknown frequency.
+func nextFixityCheck(t time.Time, frequency string) time.Time {
+	switch frequency {
+	case "TWICE_YEARLY":
+		return t.AddDate(0, 6, 0)
+	case "QUARTERLY":
+		return t.AddDate(0, 3, 0)
+	case "MONTHLY":
+		return t.AddDate(0, 1, 0)
+	}
+	return time.Time{}
+}
+
+// collectionFixity returns the fixity status of a collection, nil if there
+// is no such collection.
+func (f *Fs) collectionFixity(ctx context.Context, name string) (*fixityStatus, error) {
+	f.fixity.mu.Lock()
+	defer f.fixity.mu.Unlock()
+	if f.fixity.byCollection == nil {
+		collections, err := f.api.FindCollections(ctx, url.Values{})
+		if err != nil {
+			return nil, err
+		}
+		events, err := f.api.Events(ctx, "FIXITY")
+		if err != nil {
+			return nil, err
+		}
+		var (
+			byCollection = make(map[string]*fixityStatus)
+			frequency    = make(map[string]string)
+		)
+		for _, c := range collections {
+			byCollection[c.Name] = &fixityStatus{}
+			frequency[c.Name] = c.FixityFrequency
+		}
+		for _, e := range events {
+			s, ok := byCollection[e.Collection]
+			if !ok {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, e.EndedAt)
+			if err != nil || !t.After(s.last) {
+				continue
+			}
+			s.last, s.errors = t, e.ErrorCount
+			s.next = nextFixityCheck(t, frequency[e.Collection])
+		}
+		f.fixity.byCollection = byCollection
+	}
+	return f.fixity.byCollection[name], nil
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/report"
+)
+
+// geolocationsCommand writes the distribution of copies across locations,
+// per collection, or for the subtree at the root, as CSV or JSON, to stdout
+// or to a file.
+func (f *Fs) geolocationsCommand(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	var (
+		format = optOrDefault(opt, "format", "csv")
+		buf    bytes.Buffer
+	)
+	if format != "json" && format != "csv" {
+		return nil, fmt.Errorf("unsupported report format: %v", format)
+	}
+	r, err := f.buildGeolocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if format == "json" {
+		err = r.WriteJSON(&buf)
+	} else {
+		err = r.WriteGeolocationsCSV(&buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filename, ok := opt["output"]; ok {
+		if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return buf.String(), nil
+}
+
+// buildGeolocations gathers the target replica locations of all collections,
+// or of the collection at the root. If the root is a folder inside a
+// collection, the bytes are those of the files below the root, which share
+// the locations of their collection.
+func (f *Fs) buildGeolocations(ctx context.Context) (*report.Report, error) {
+	org, err := f.api.Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := f.api.CollectionSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		r = &report.Report{
+			Organization: org.Name,
+			Generated:    time.Now().UTC().Format(time.RFC3339),
+		}
+		parts = strings.SplitN(f.root, "/", 2)
+	)
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	for _, s := range summaries {
+		if f.root != "" && s.Name != parts[0] {
+			continue
+		}
+		p, size := path.Join("/", s.Name), s.SizeBytes
+		if len(parts) == 2 {
+			objs, err := listObjects(ctx, f)
+			if err != nil {
+				return nil, err
+			}
+			p, size = path.Join("/", f.root), 0
+			for _, o := range objs {
+				size += o.Size()
+			}
+		}
+		for _, loc := range s.TargetReplicaLocations {
+			r.Geolocations = append(r.Geolocations, &report.Geolocation{
+				Collection:       s.Name,
+				Path:             p,
+				Location:         loc.Abbreviation,
+				DisplayName:      loc.DisplayName,
+				PhysicalLocation: loc.PhysicalLocation,
+				Copies:           loc.NumCopies,
+				Bytes:            size,
+			})
+		}
+	}
+	return r, nil
+}
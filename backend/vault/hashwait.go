@@ -0,0 +1,85 @@
+package vault
+
+import (
+	"context"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+const (
+	// hashWaitWindow limits waiting for hashes to files uploaded as
+	// recently; older files without hashes will not get them by waiting.
+	hashWaitWindow = 24 * time.Hour
+	// hashPollMinSleep and hashPollMaxSleep bound the pause between polls.
+	hashPollMinSleep = time.Second
+	hashPollMaxSleep = 15 * time.Second
+)
+
+// treeNodeSum returns the hash of the given type of a treenode, or the empty
+// string, if the server has not computed it (yet).
+func treeNodeSum(t *api.TreeNode, ty hash.Type) string {
+	var v interface{}
+	switch ty {
+	case hash.MD5:
+		v = t.Md5Sum
+	case hash.SHA1:
+		v = t.Sha1Sum
+	case hash.SHA256:
+		v = t.Sha256Sum
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// waitForHash polls for a missing hash of a recently uploaded file, for up to
+// hash_wait, and updates the treenode of the object, once the hash appears.
+// Files still being deposited have no treenode yet and are skipped, as are
+// files with a hash computed locally during upload. Failures are logged
+// only; Hash then reports the hash as missing, as without the option.
+func (o *Object) waitForHash(ctx context.Context, ty hash.Type) {
+	wait := time.Duration(o.fs.opt.HashWait)
+	if wait <= 0 || o.treeNode.ID == 0 || treeNodeSum(o.treeNode, ty) != "" {
+		return
+	}
+	if uploaded := uploadTime(o.treeNode); !uploaded.IsZero() && time.Since(uploaded) > hashWaitWindow {
+		return
+	}
+	var (
+		deadline = time.Now().Add(wait)
+		sleep    = hashPollMinSleep
+	)
+	fs.Debugf(o, "waiting up to %v for %v hash", wait, ty)
+	for {
+		t, err := o.fs.api.RetrieveTreeNode(ctx, o.treeNode.ID)
+		if err != nil {
+			fs.Debugf(o, "could not poll for %v hash: %v", ty, err)
+			return
+		}
+		if treeNodeSum(t, ty) != "" {
+			o.treeNode = t
+			return
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			fs.Logf(o, "no %v hash after waiting %v", ty, wait)
+			return
+		}
+		if sleep > remaining {
+			sleep = remaining
+		}
+		timer := time.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		sleep *= 2
+		if sleep > hashPollMaxSleep {
+			sleep = hashPollMaxSleep
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/backend/vault/report"
+	"github.com/rclone/rclone/fs"
+)
+
+// usageHistoryCommand writes the storage used over time, per collection or
+// for the organization, as CSV or JSON, to stdout or to a file. Vault keeps
+// no usage history as such, but every deposit and fixity report records the
+// files and bytes of its collection at the time.
+func (f *Fs) usageHistoryCommand(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	var (
+		format   = optOrDefault(opt, "format", "csv")
+		interval = optOrDefault(opt, "interval", "day")
+		group    = optOrDefault(opt, "group", "collection")
+		since    fs.Time
+		buf      bytes.Buffer
+	)
+	if format != "json" && format != "csv" {
+		return nil, fmt.Errorf("unsupported report format: %v", format)
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		return nil, fmt.Errorf("unsupported interval: %v", interval)
+	}
+	if group != "collection" && group != "organization" {
+		return nil, fmt.Errorf("unsupported group: %v", group)
+	}
+	if v, ok := opt["since"]; ok {
+		if err := since.Set(v); err != nil {
+			return nil, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	org, err := f.api.Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := f.api.Reports(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	r := &report.Report{
+		Organization: org.Name,
+		Generated:    now.Format(time.RFC3339),
+		Usage: usageHistory(reports, strings.SplitN(f.root, "/", 2)[0],
+			time.Time(since), now, interval, group == "organization"),
+	}
+	if format == "json" {
+		err = r.WriteJSON(&buf)
+	} else {
+		err = r.WriteUsageCSV(&buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filename, ok := opt["output"]; ok {
+		if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return buf.String(), nil
+}
+
+// usageHistory returns the usage at the end of each period from since, or
+// from the first report, until now. The usage of a collection is that of its
+// latest report up to the end of a period. Only the given collection is
+// included, if not empty; with total set, the usage of all collections is
+// summed up.
+func usageHistory(reports []*api.Report, collection string, since, now time.Time, interval string, total bool) (result []*report.Usage) {
+	type point struct {
+		ended time.Time
+		r     *api.Report
+	}
+	var points []point
+	for _, r := range reports {
+		if collection != "" && r.Collection != collection {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, r.EndedAt)
+		if err != nil {
+			continue
+		}
+		points = append(points, point{t, r})
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].ended.Before(points[j].ended) })
+	if since.IsZero() || since.Before(points[0].ended) {
+		since = points[0].ended
+	}
+	var (
+		latest = make(map[string]*api.Report)
+		i      int
+	)
+	for start := periodStart(since, interval); !start.After(now); start = nextPeriod(start, interval) {
+		end := nextPeriod(start, interval)
+		for ; i < len(points) && points[i].ended.Before(end); i++ {
+			latest[points[i].r.Collection] = points[i].r
+		}
+		label := start.Format("2006-01-02")
+		if total {
+			u := &report.Usage{Time: label}
+			for _, r := range latest {
+				u.Files += r.CollectionFiles
+				u.Bytes += r.CollectionBytes
+			}
+			result = append(result, u)
+			continue
+		}
+		var names []string
+		for name := range latest {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			result = append(result, &report.Usage{
+				Time:       label,
+				Collection: name,
+				Files:      latest[name].CollectionFiles,
+				Bytes:      latest[name].CollectionBytes,
+			})
+		}
+	}
+	return result
+}
+
+// periodStart returns the start of the day, week (from Monday) or month of t,
+// in UTC.
+func periodStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextPeriod returns the start of the period after the one starting at t.
+func nextPeriod(t time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
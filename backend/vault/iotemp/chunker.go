@@ -0,0 +1,80 @@
+package iotemp
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var ErrChunkOutOfRange = errors.New("chunk number out of range")
+
+// Chunker splits data of a known size into fixed size chunks, without
+// requiring the data to be in a file on disk. Each chunk is an independent
+// reader, so a chunk can be read again, e.g. on retry.
+type Chunker struct {
+	r         io.ReaderAt
+	size      int64
+	chunkSize int64
+}
+
+// NewChunker returns a chunker over size bytes of r.
+func NewChunker(r io.ReaderAt, size, chunkSize int64) (*Chunker, error) {
+	if size < 0 || chunkSize <= 0 {
+		return nil, ErrInvalidSize
+	}
+	return &Chunker{r: r, size: size, chunkSize: chunkSize}, nil
+}
+
+// NewSeekerChunker returns a chunker over size bytes of a io.ReadSeeker, e.g.
+// a memory buffer or a seekable remote reader. Chunks must not be read
+// concurrently with other users of rs.
+func NewSeekerChunker(rs io.ReadSeeker, size, chunkSize int64) (*Chunker, error) {
+	if ra, ok := rs.(io.ReaderAt); ok {
+		return NewChunker(ra, size, chunkSize)
+	}
+	return NewChunker(&seekerReaderAt{rs: rs}, size, chunkSize)
+}
+
+// NumChunks returns the number of chunks. Empty data still has one, empty
+// chunk, as the upload of an empty file requires one.
+func (c *Chunker) NumChunks() int {
+	if c.size == 0 {
+		return 1
+	}
+	return int((c.size + c.chunkSize - 1) / c.chunkSize)
+}
+
+// Chunk returns a reader for chunk i, counting from zero.
+func (c *Chunker) Chunk(i int) (*io.SectionReader, error) {
+	if i < 0 || i >= c.NumChunks() {
+		return nil, ErrChunkOutOfRange
+	}
+	var (
+		off = int64(i) * c.chunkSize
+		n   = c.chunkSize
+	)
+	if off+n > c.size {
+		n = c.size - off
+	}
+	return io.NewSectionReader(c.r, off, n), nil
+}
+
+// seekerReaderAt implements io.ReaderAt with seek and read.
+type seekerReaderAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+// ReadAt reads len(p) bytes at offset off.
+func (r *seekerReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err = r.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err = io.ReadFull(r.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
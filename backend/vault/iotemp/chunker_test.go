@@ -0,0 +1,58 @@
+package iotemp
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// seekerOnly hides the io.ReaderAt implementation of a reader.
+type seekerOnly struct {
+	io.ReadSeeker
+}
+
+func TestChunker(t *testing.T) {
+	var cases = []struct {
+		about     string
+		data      string
+		chunkSize int64
+		chunks    []string
+	}{
+		{"empty data has one empty chunk", "", 4, []string{""}},
+		{"exact fit", "abcdefgh", 4, []string{"abcd", "efgh"}},
+		{"short last chunk", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"single chunk", "abc", 4, []string{"abc"}},
+	}
+	for _, c := range cases {
+		for _, rs := range []io.ReadSeeker{
+			strings.NewReader(c.data),
+			seekerOnly{bytes.NewReader([]byte(c.data))},
+		} {
+			chunker, err := NewSeekerChunker(rs, int64(len(c.data)), c.chunkSize)
+			if err != nil {
+				t.Fatalf("[%s] got %v", c.about, err)
+			}
+			if chunker.NumChunks() != len(c.chunks) {
+				t.Fatalf("[%s] got %d chunks, want %d", c.about, chunker.NumChunks(), len(c.chunks))
+			}
+			// Read in reverse, chunks are independent.
+			for i := len(c.chunks) - 1; i >= 0; i-- {
+				r, err := chunker.Chunk(i)
+				if err != nil {
+					t.Fatalf("[%s] got %v", c.about, err)
+				}
+				b, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("[%s] got %v", c.about, err)
+				}
+				if string(b) != c.chunks[i] {
+					t.Fatalf("[%s] chunk %d: got %q, want %q", c.about, i, b, c.chunks[i])
+				}
+			}
+			if _, err := chunker.Chunk(len(c.chunks)); err != ErrChunkOutOfRange {
+				t.Fatalf("[%s] got %v, want %v", c.about, err, ErrChunkOutOfRange)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package iotemp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/lib/diskusage"
+)
+
+// ErrInsufficientSpace is returned, if a directory for temporary files is
+// running out of space.
+var ErrInsufficientSpace = errors.New("insufficient space for temporary files")
+
+// TransitPattern is the name pattern of all temporary files created by this
+// package.
+const TransitPattern = "rclone-vault-transit-*"
+
+// live keeps track of spool files of this process, which have not been
+// closed yet.
+var live = struct {
+	sync.Mutex
+	m map[string]struct{}
+}{m: make(map[string]struct{})}
+
+// register adds a spool file to the live set.
+func register(name string) {
+	live.Lock()
+	live.m[name] = struct{}{}
+	live.Unlock()
+}
+
+// unregister removes a spool file from the live set.
+func unregister(name string) {
+	live.Lock()
+	delete(live.m, name)
+	live.Unlock()
+}
+
+// RemoveSpoolFiles removes all spool files of this process, which have not
+// been closed yet, e.g. on interrupt.
+func RemoveSpoolFiles() {
+	live.Lock()
+	defer live.Unlock()
+	for name := range live.m {
+		_ = os.Remove(name)
+		delete(live.m, name)
+	}
+}
+
+// RemoveOrphans removes temporary files matching TransitPattern in dir, which
+// have not been modified for at least maxAge, e.g. left behind by a crash. An
+// empty dir means the default directory for temporary files. Returns the
+// names of the removed files.
+func RemoveOrphans(dir string, maxAge time.Duration) (removed []string, err error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	names, err := filepath.Glob(filepath.Join(dir, TransitPattern))
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, name := range names {
+		fi, err := os.Lstat(name)
+		if err != nil || !fi.Mode().IsRegular() || fi.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// CheckDir verifies, that dir can hold temporary files and has at least
+// minFree bytes available. An empty dir means the default directory for
+// temporary files. If disk usage cannot be determined on this platform, only
+// the directory is checked.
+func CheckDir(dir string, minFree uint64) error {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("not a directory: %v", dir)
+	}
+	info, err := diskusage.New(dir)
+	switch {
+	case err == diskusage.ErrUnsupported:
+		return nil
+	case err != nil:
+		return err
+	case info.Available < minFree:
+		return fmt.Errorf("%w: %v has %d bytes available, want at least %d",
+			ErrInsufficientSpace, dir, info.Available, minFree)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package iotemp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveOrphans(t *testing.T) {
+	var (
+		dir   = t.TempDir()
+		old   = filepath.Join(dir, "rclone-vault-transit-1")
+		fresh = filepath.Join(dir, "rclone-vault-transit-2")
+		other = filepath.Join(dir, "unrelated")
+	)
+	for _, name := range []string{old, fresh, other} {
+		if err := os.WriteFile(name, []byte("x"), 0600); err != nil {
+			t.Fatalf("got %v", err)
+		}
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{old, other} {
+		if err := os.Chtimes(name, past, past); err != nil {
+			t.Fatalf("got %v", err)
+		}
+	}
+	removed, err := RemoveOrphans(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if len(removed) != 1 || removed[0] != old {
+		t.Fatalf("got %v, want [%v]", removed, old)
+	}
+	for _, name := range []string{fresh, other} {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("%v should not have been removed", name)
+		}
+	}
+}
+
+func TestRemoveSpoolFiles(t *testing.T) {
+	s, err := NewSpool(&DummyReader{N: 32, C: '.'}, 8)
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	name := s.f.Name()
+	RemoveSpoolFiles()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("spool file not removed")
+	}
+	_ = s.Close()
+}
+
+func TestCheckDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckDir(dir, 0); err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if err := CheckDir(filepath.Join(dir, "missing"), 0); err == nil {
+		t.Fatalf("expected error for missing directory")
+	}
+	if err := CheckDir(dir, 1<<62); err != nil && !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("got %v, want %v", err, ErrInsufficientSpace)
+	}
+}
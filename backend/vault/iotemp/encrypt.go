@@ -0,0 +1,87 @@
+package iotemp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+)
+
+// spoolKey encrypts spool files. It is generated once per process and only
+// ever kept in memory, so spool files left behind cannot be decrypted.
+var (
+	spoolKeyOnce sync.Once
+	spoolKey     []byte
+	spoolKeyErr  error
+)
+
+// ephemeralKey returns the per process AES-256 key.
+func ephemeralKey() ([]byte, error) {
+	spoolKeyOnce.Do(func() {
+		spoolKey = make([]byte, 32)
+		_, spoolKeyErr = rand.Read(spoolKey)
+	})
+	return spoolKey, spoolKeyErr
+}
+
+// ctrFile encrypts a file with AES-CTR, which allows random access reads.
+type ctrFile struct {
+	f     *os.File
+	block cipher.Block
+	iv    [aes.BlockSize]byte
+}
+
+// newCTRFile wraps f with the ephemeral key and a random iv.
+func newCTRFile(f *os.File) (*ctrFile, error) {
+	key, err := ephemeralKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	c := &ctrFile{f: f, block: block}
+	if _, err := rand.Read(c.iv[:]); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// stream returns the key stream starting at byte offset off.
+func (c *ctrFile) stream(off int64) cipher.Stream {
+	// The counter is the iv as 128-bit big endian integer, incremented per
+	// block, cf. crypto/cipher CTR.
+	var (
+		iv     [aes.BlockSize]byte
+		hi     = binary.BigEndian.Uint64(c.iv[:8])
+		lo     = binary.BigEndian.Uint64(c.iv[8:])
+		blocks = uint64(off / aes.BlockSize)
+	)
+	if lo+blocks < lo {
+		hi++
+	}
+	binary.BigEndian.PutUint64(iv[:8], hi)
+	binary.BigEndian.PutUint64(iv[8:], lo+blocks)
+	s := cipher.NewCTR(c.block, iv[:])
+	if skip := off % aes.BlockSize; skip > 0 {
+		var discard [aes.BlockSize]byte
+		s.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	return s
+}
+
+// Writer returns a writer encrypting from the start of the file.
+func (c *ctrFile) Writer() io.Writer {
+	return cipher.StreamWriter{S: c.stream(0), W: c.f}
+}
+
+// ReadAt reads and decrypts len(p) bytes at offset off.
+func (c *ctrFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.f.ReadAt(p, off)
+	c.stream(off).XORKeyStream(p[:n], p[:n])
+	return n, err
+}
@@ -0,0 +1,63 @@
+package iotemp
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"testing"
+)
+
+// FuzzMultipartFieldWriter checks, that field values survive the trip through
+// a multipart message, e.g. for exotic filenames in a chunk upload.
+func FuzzMultipartFieldWriter(f *testing.F) {
+	for _, s := range []string{
+		"",
+		"a.txt",
+		"dir/\"quoted\".txt",
+		"--boundary\r\n\r\nx",
+		"\x00\xffä　",
+	} {
+		f.Add(s, s)
+	}
+	f.Fuzz(func(t *testing.T, filename, relativePath string) {
+		var (
+			buf    bytes.Buffer
+			w      = multipart.NewWriter(&buf)
+			mfw    = &MultipartFieldWriter{W: w}
+			fields = []struct{ name, value string }{
+				{"flowFilename", filename},
+				{"flowRelativePath", relativePath},
+				{"flowMimetype", "application/octet-stream"},
+			}
+		)
+		for _, field := range fields {
+			mfw.WriteField(field.name, field.value)
+		}
+		if err := mfw.Err(); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		r := multipart.NewReader(&buf, w.Boundary())
+		for _, field := range fields {
+			part, err := r.NextPart()
+			if err != nil {
+				t.Fatalf("next part: %v", err)
+			}
+			if part.FormName() != field.name {
+				t.Fatalf("got field %q, want %q", part.FormName(), field.name)
+			}
+			b, err := io.ReadAll(part)
+			if err != nil {
+				t.Fatalf("read part: %v", err)
+			}
+			if string(b) != field.value {
+				t.Fatalf("got value %q, want %q", b, field.value)
+			}
+		}
+		if _, err := r.NextPart(); err != io.EOF {
+			t.Fatalf("got %v, want EOF", err)
+		}
+	})
+}
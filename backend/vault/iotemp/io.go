@@ -48,9 +48,11 @@ func (r *DummyReader) Read(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-// TempFileFromReader spools a reader into temporary file and returns its name.
-func TempFileFromReader(r io.Reader) (string, error) {
-	tf, err := ioutil.TempFile("", "rclone-vault-transit-*")
+// TempFileFromReader spools a reader into temporary file in dir and returns
+// its name; an empty dir means the default directory for temporary files. The
+// file is not encrypted, use a Spool with WithEncryption for sensitive data.
+func TempFileFromReader(dir string, r io.Reader) (string, error) {
+	tf, err := ioutil.TempFile(dir, TransitPattern)
 	if err != nil {
 		return "", err
 	}
@@ -53,7 +53,7 @@ func TestDummyReader(t *testing.T) {
 func TestTempFileFromReader(t *testing.T) {
 	const s = "hello"
 	r := strings.NewReader(s)
-	filename, err := TempFileFromReader(r)
+	filename, err := TempFileFromReader("", r)
 	if err != nil {
 		t.Fatalf("tempfile from reader failed: %v", err)
 	}
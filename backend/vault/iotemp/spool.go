@@ -0,0 +1,107 @@
+package iotemp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// SpoolOption configures a spool.
+type SpoolOption func(*spoolConfig)
+
+// spoolConfig holds spool options.
+type spoolConfig struct {
+	dir     string
+	encrypt bool
+}
+
+// WithDir sets the directory for temporary files, an empty dir means the
+// default directory for temporary files.
+func WithDir(dir string) SpoolOption {
+	return func(c *spoolConfig) {
+		c.dir = dir
+	}
+}
+
+// WithEncryption encrypts data spooled to disk with AES-CTR, using a key that
+// only exists in memory for the lifetime of the process.
+func WithEncryption(encrypt bool) SpoolOption {
+	return func(c *spoolConfig) {
+		c.encrypt = encrypt
+	}
+}
+
+// Spool holds data of a reader of unknown size, in memory for small data and
+// in a temporary file otherwise. It is seekable and knows its size. Close
+// removes the temporary file, if any.
+type Spool struct {
+	io.ReadSeeker
+	size int64
+	f    *os.File // nil, if data is in memory
+}
+
+// NewSpool reads r until EOF, keeping up to max bytes in memory and falling
+// back to a temporary file for larger data.
+func NewSpool(r io.Reader, max int64, opts ...SpoolOption) (*Spool, error) {
+	var cfg spoolConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, max+1)
+	switch {
+	case err == io.EOF:
+		return &Spool{ReadSeeker: bytes.NewReader(buf.Bytes()), size: n}, nil
+	case err != nil:
+		return nil, err
+	}
+	f, err := ioutil.TempFile(cfg.dir, TransitPattern)
+	if err != nil {
+		return nil, err
+	}
+	register(f.Name())
+	var (
+		s              = &Spool{f: f}
+		w  io.Writer   = f
+		ra io.ReaderAt = f
+	)
+	if cfg.encrypt {
+		c, err := newCTRFile(f)
+		if err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+		w, ra = c.Writer(), c
+	}
+	if s.size, err = io.Copy(w, io.MultiReader(&buf, r)); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	s.ReadSeeker = io.NewSectionReader(ra, 0, s.size)
+	return s, nil
+}
+
+// Size returns the number of bytes spooled.
+func (s *Spool) Size() int64 { return s.size }
+
+// InMemory returns true, if no temporary file was required.
+func (s *Spool) InMemory() bool { return s.f == nil }
+
+// ReadAt implements io.ReaderAt, so the spool can be chunked directly.
+func (s *Spool) ReadAt(p []byte, off int64) (int, error) {
+	return s.ReadSeeker.(io.ReaderAt).ReadAt(p, off)
+}
+
+// Close releases the spool and removes the temporary file, if any.
+func (s *Spool) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	if rerr := os.Remove(s.f.Name()); err == nil {
+		err = rerr
+	}
+	unregister(s.f.Name())
+	return err
+}
@@ -0,0 +1,114 @@
+package iotemp
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	var cases = []struct {
+		about    string
+		data     string
+		max      int64
+		inMemory bool
+	}{
+		{"empty", "", 4, true},
+		{"fits in memory", "abcd", 4, true},
+		{"falls back to disk", "abcde", 4, false},
+	}
+	for _, c := range cases {
+		s, err := NewSpool(strings.NewReader(c.data), c.max)
+		if err != nil {
+			t.Fatalf("[%s] got %v", c.about, err)
+		}
+		if s.InMemory() != c.inMemory {
+			t.Fatalf("[%s] got in memory %v, want %v", c.about, s.InMemory(), c.inMemory)
+		}
+		if s.Size() != int64(len(c.data)) {
+			t.Fatalf("[%s] got size %d, want %d", c.about, s.Size(), len(c.data))
+		}
+		for i := 0; i < 2; i++ { // read twice, to check seeking
+			if _, err := s.Seek(0, io.SeekStart); err != nil {
+				t.Fatalf("[%s] got %v", c.about, err)
+			}
+			b, err := io.ReadAll(s)
+			if err != nil {
+				t.Fatalf("[%s] got %v", c.about, err)
+			}
+			if string(b) != c.data {
+				t.Fatalf("[%s] got %q, want %q", c.about, b, c.data)
+			}
+		}
+		var name string
+		if s.f != nil {
+			name = s.f.Name()
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("[%s] close failed: %v", c.about, err)
+		}
+		if name != "" {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Fatalf("[%s] temporary file not removed", c.about)
+			}
+		}
+	}
+}
+
+func TestSpoolEncrypted(t *testing.T) {
+	data := strings.Repeat("0123456789abcdef", 64) + "xyz"
+	s, err := NewSpool(strings.NewReader(data), 16, WithEncryption(true))
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	defer s.Close() // nolint:errcheck
+	raw, err := os.ReadFile(s.f.Name())
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if len(raw) != len(data) || strings.Contains(string(raw), "0123456789") {
+		t.Fatalf("spool file is not encrypted")
+	}
+	b, err := io.ReadAll(s)
+	if err != nil || string(b) != data {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	// Unaligned random access.
+	for _, off := range []int64{0, 5, 16, 31, 1000} {
+		p := make([]byte, 20)
+		n, err := s.ReadAt(p, off)
+		if err != nil && err != io.EOF {
+			t.Fatalf("[%d] got %v", off, err)
+		}
+		if string(p[:n]) != data[off:off+int64(n)] {
+			t.Fatalf("[%d] got %q, want %q", off, p[:n], data[off:off+int64(n)])
+		}
+	}
+}
+
+func TestCTRCounterCarry(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "ctr-*")
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	defer f.Close() // nolint:errcheck
+	c, err := newCTRFile(f)
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	for i := 8; i < 16; i++ {
+		c.iv[i] = 0xff // low half overflows after the first block
+	}
+	data := strings.Repeat("x", 48)
+	if _, err := io.WriteString(c.Writer(), data); err != nil {
+		t.Fatalf("got %v", err)
+	}
+	p := make([]byte, 16)
+	if _, err := c.ReadAt(p, 32); err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if string(p) != data[32:] {
+		t.Fatalf("got %q", p)
+	}
+}
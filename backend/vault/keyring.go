@@ -0,0 +1,43 @@
+package vault
+
+import (
+	"errors"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// keyringService is the service under which vault secrets are looked up in
+// the system keyring. The account is the remote name and the option name,
+// e.g. "vault/password" or "vault/api_key".
+const keyringService = "rclone-vault"
+
+// errKeyringNotFound is returned, if the keyring does not contain a secret.
+var errKeyringNotFound = errors.New("secret not found in keyring")
+
+// keyringAccount returns the account name for a remote and option.
+func keyringAccount(name, key string) string {
+	return name + "/" + key
+}
+
+// credentialsFromKeyring fills in password and api key from the system
+// keyring, for all values not already set in the config.
+func credentialsFromKeyring(name string, opt *Options) error {
+	for key, v := range map[string]*string{
+		"password": &opt.Password,
+		"api_key":  &opt.APIKey,
+	} {
+		if *v != "" {
+			continue
+		}
+		secret, err := keyringGet(keyringService, keyringAccount(name, key))
+		switch {
+		case errors.Is(err, errKeyringNotFound):
+			fs.Debugf(name, "no %s found in keyring", key)
+		case err != nil:
+			return err
+		default:
+			*v = secret
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+//go:build darwin
+
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// exitItemNotFound is the exit code of security(1), if no item matches.
+const exitItemNotFound = 44
+
+// keyringGet looks up a generic password in the macOS Keychain. A secret can
+// be stored with:
+//
+//	security add-generic-password -s rclone-vault -a vault/password -w
+func keyringGet(service, account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == exitItemNotFound:
+		return "", errKeyringNotFound
+	case err != nil:
+		return "", fmt.Errorf("keyring: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
@@ -0,0 +1,32 @@
+//go:build !darwin && !windows
+
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keyringGet looks up a secret with secret-tool, which talks to any
+// keyring implementing the freedesktop secret service API, e.g. GNOME
+// Keyring or KWallet. A secret can be stored with:
+//
+//	secret-tool store --label="rclone vault" service rclone-vault account vault/password
+func keyringGet(service, account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && stderr.Len() == 0:
+		// secret-tool exits with 1 and no message, if nothing was found.
+		return "", errKeyringNotFound
+	case err != nil:
+		return "", fmt.Errorf("keyring: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
@@ -0,0 +1,76 @@
+//go:build windows
+
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	advapi32  = windows.NewLazySystemDLL("advapi32.dll")
+	credReadW = advapi32.NewProc("CredReadW")
+	credFree  = advapi32.NewProc("CredFree")
+)
+
+// credTypeGeneric is CRED_TYPE_GENERIC.
+const credTypeGeneric = 1
+
+// credential mirrors the CREDENTIALW struct.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keyringGet reads a generic credential from the Windows Credential Manager.
+// The target name is service and account, separated by a colon. A secret can
+// be stored with:
+//
+//	cmdkey /generic:rclone-vault:vault/password /user:vault /pass
+func keyringGet(service, account string) (string, error) {
+	target, err := windows.UTF16PtrFromString(service + ":" + account)
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	r, _, err := credReadW.Call(
+		uintptr(unsafe.Pointer(target)),
+		credTypeGeneric,
+		0,
+		uintptr(unsafe.Pointer(&cred)),
+	)
+	if r == 0 {
+		if errors.Is(err, windows.ERROR_NOT_FOUND) {
+			return "", errKeyringNotFound
+		}
+		return "", fmt.Errorf("keyring: %w", err)
+	}
+	defer credFree.Call(uintptr(unsafe.Pointer(cred))) // nolint:errcheck
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+	// Credential manager and cmdkey store the secret as UTF-16.
+	if len(blob)%2 != 0 {
+		return string(blob), nil
+	}
+	u := make([]uint16, len(blob)/2)
+	for i := range u {
+		u[i] = uint16(blob[2*i]) | uint16(blob[2*i+1])<<8
+	}
+	return string(utf16.Decode(u)), nil
+}
@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// ManifestFile is a single file of a deposit, as written to manifest_path.
+type ManifestFile struct {
+	Remote         string `json:"remote"` // absolute path in vault
+	Source         string `json:"source"` // remote of the source object
+	Size           int64  `json:"size"`
+	MD5            string `json:"md5"`
+	SHA1           string `json:"sha1"`
+	SHA256         string `json:"sha256"`
+	FlowIdentifier string `json:"flow_identifier"`
+	DepositID      int    `json:"deposit_id"`
+}
+
+// Manifest lists the files of a finalized deposit.
+type Manifest struct {
+	DepositID int             `json:"deposit_id"`
+	Finalized string          `json:"finalized_at"`
+	Files     []*ManifestFile `json:"files"`
+}
+
+// writeManifest adds the manifest of a finalized deposit to the manifests of
+// this run and writes all of them to manifest_path, as a JSON array. Expects
+// f.mu to be held.
+func (f *Fs) writeManifest(id int, files []*ManifestFile) error {
+	if files == nil {
+		files = []*ManifestFile{}
+	}
+	f.manifests = append(f.manifests, &Manifest{
+		DepositID: id,
+		Finalized: time.Now().UTC().Format(time.RFC3339),
+		Files:     files,
+	})
+	b, err := json.MarshalIndent(f.manifests, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so readers never see a partial
+	// manifest.
+	tmp, err := os.CreateTemp(filepath.Dir(f.opt.ManifestPath), ".rclone-vault-manifest-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.opt.ManifestPath); err != nil {
+		return err
+	}
+	fs.Debugf(f, "wrote manifest of deposit %d with %d files to %v", id, len(files), f.opt.ManifestPath)
+	return nil
+}
@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// systemMetadataInfo describes the metadata of objects: the comment of the
+// treenode and, as vault checks fixity per collection, the outcome of the
+// latest check of the collection of the file.
+var systemMetadataInfo = map[string]fs.MetadataHelp{
+	"comment": {
+		Help:     "Comment of the file",
+		Type:     "string",
+		Example:  "accession 2024-17",
+		ReadOnly: true,
+	},
+	"fixity-last-check": {
+		Help:     "Time of the latest fixity check of the collection",
+		Type:     "RFC 3339",
+		Example:  "2006-01-02T15:04:05Z",
+		ReadOnly: true,
+	},
+	"fixity-result": {
+		Help:     "Outcome of the latest fixity check of the collection",
+		Type:     "string",
+		Example:  "ok, failed",
+		ReadOnly: true,
+	},
+	"fixity-next-check": {
+		Help:     "Time the next fixity check is due, from the fixity frequency of the collection",
+		Type:     "RFC 3339",
+		Example:  "2006-07-02T15:04:05Z",
+		ReadOnly: true,
+	},
+}
+
+// Metadata returns the comment of the object and the fixity status of its
+// collection, see systemMetadataInfo. Returns nil, if there is neither.
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	m := make(fs.Metadata)
+	if comment, ok := o.treeNode.Comment.(string); ok && comment != "" {
+		m["comment"] = comment
+	}
+	collection := strings.SplitN(path.Join(o.fs.root, o.remote), "/", 2)[0]
+	s, err := o.fs.collectionFixity(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil && !s.last.IsZero() {
+		m["fixity-last-check"] = s.last.UTC().Format(time.RFC3339)
+		m["fixity-result"] = "ok"
+		if s.errors > 0 {
+			m["fixity-result"] = "failed"
+		}
+		if !s.next.IsZero() {
+			m["fixity-next-check"] = s.next.UTC().Format(time.RFC3339)
+		}
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// commentRequested returns true, if a comment is to be written on upload,
+// e.g. with --metadata-set comment=..., which the server does not allow. A
+// comment in the metadata of the source is dropped, like all read only
+// metadata.
+func commentRequested(ctx context.Context, options []fs.OpenOption) bool {
+	if _, ok := fs.GetConfig(ctx).MetadataSet["comment"]; ok {
+		return true
+	}
+	for _, option := range options {
+		if m, ok := option.(fs.MetadataOption); ok {
+			if _, ok := m["comment"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commentCommand gets the comment of a file or folder below the root. The
+// server rejects writing comments, see ErrCommentUnsupported.
+func (f *Fs) commentCommand(ctx context.Context, args []string) (out interface{}, err error) {
+	switch {
+	case len(args) == 2 && args[0] == "get":
+	case len(args) > 0 && args[0] == "set":
+		return nil, ErrCommentUnsupported
+	default:
+		return nil, errors.New(`comment requires "get <path>"`)
+	}
+	t, err := f.resolvePath(ctx, args[1])
+	if err != nil {
+		return nil, err
+	}
+	comment, _ := t.Comment.(string)
+	return comment, nil
+}
@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/mets"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+)
+
+// defaultMETSName is the name of the uploaded METS document.
+const defaultMETSName = "mets.xml"
+
+// metsCommand writes a METS document with PREMIS fixity and provenance
+// records for all files below the root, to stdout, a local file or into
+// vault, next to the files.
+func (f *Fs) metsCommand(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	if f.root == "" {
+		return nil, errors.New("mets requires a collection or folder")
+	}
+	_, upload := opt["upload"]
+	name := optOrDefault(opt, "name", defaultMETSName)
+	doc, err := f.buildMETS(ctx, optOrDefault(opt, "manifest", f.opt.ManifestPath), name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := doc.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	filename, ok := opt["output"]
+	if ok {
+		if err := os.WriteFile(filename, b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	if !ok && !upload {
+		return string(b), nil
+	}
+	if upload {
+		info := object.NewStaticObjectInfo(name, time.Now(), int64(len(b)), true, nil, nil)
+		if _, err := f.Put(ctx, bytes.NewReader(b), info); err != nil {
+			return nil, err
+		}
+		if err := f.finalize(ctx); err != nil {
+			return nil, err
+		}
+		fs.Infof(f, "uploaded METS document with %d files to %v", doc.Len(), path.Join(f.root, name))
+	}
+	return nil, nil
+}
+
+// buildMETS gathers sizes, checksums and upload times of all files below the
+// root, except a previous METS document with the given name, and the deposit
+// of each file from the manifests of this run or the manifest file.
+func (f *Fs) buildMETS(ctx context.Context, manifestPath, name string) (*mets.Document, error) {
+	deposits, err := f.depositIDs(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := listObjects(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	doc := mets.New(path.Join("/", f.root), path.Base(f.root), "rclone "+fs.Version)
+	for remote, o := range objs {
+		if remote == name {
+			continue
+		}
+		mf := mets.File{
+			Path:      remote,
+			Size:      o.Size(),
+			Modified:  o.ModTime(ctx),
+			Checksums: make(map[string]string),
+			DepositID: deposits[path.Join("/", f.root, remote)],
+		}
+		for _, ht := range []hash.Type{hash.MD5, hash.SHA1, hash.SHA256} {
+			sum, err := o.Hash(ctx, ht)
+			if err != nil {
+				return nil, err
+			}
+			mf.Checksums[ht.String()] = sum
+		}
+		if vo, ok := o.(*Object); ok {
+			if t, err := time.Parse(time.RFC3339, vo.treeNode.UploadedAt); err == nil {
+				mf.Uploaded = t
+			}
+			if vo.treeNode.UploadedBy != nil {
+				mf.Agent = fmt.Sprint(vo.treeNode.UploadedBy)
+			}
+		}
+		doc.Add(mf)
+	}
+	return doc, nil
+}
+
+// depositIDs maps absolute paths in vault to the latest deposit of the file,
+// as recorded in the manifest file and the manifests of this run.
+func (f *Fs) depositIDs(manifestPath string) (map[string]int, error) {
+	var manifests []*Manifest
+	if manifestPath != "" {
+		b, err := os.ReadFile(manifestPath)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(b, &manifests); err != nil {
+				return nil, fmt.Errorf("invalid manifest %v: %w", manifestPath, err)
+			}
+		}
+	}
+	f.mu.Lock()
+	manifests = append(manifests, f.manifests...)
+	f.mu.Unlock()
+	ids := make(map[string]int)
+	for _, m := range manifests {
+		for _, mf := range m.Files {
+			if m.DepositID > ids[mf.Remote] {
+				ids[mf.Remote] = m.DepositID
+			}
+		}
+	}
+	return ids, nil
+}
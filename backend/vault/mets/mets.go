@@ -0,0 +1,331 @@
+// Package mets writes a METS document for a tree of files, with a physical
+// structural map and PREMIS object and event records for fixity and
+// provenance, from sizes, checksums and deposit information known elsewhere.
+// The files themselves are not touched.
+package mets
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Namespaces of the written document.
+const (
+	NamespaceMETS   = "http://www.loc.gov/METS/"
+	NamespacePREMIS = "http://www.loc.gov/premis/v3"
+	NamespaceXLink  = "http://www.w3.org/1999/xlink"
+	NamespaceXSI    = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// algorithms maps checksum algorithm names, e.g. "sha256", to the names of
+// the METS CHECKSUMTYPE and PREMIS messageDigestAlgorithm vocabularies, in
+// order of preference for the METS file checksum.
+var algorithms = [][2]string{
+	{"sha256", "SHA-256"},
+	{"sha1", "SHA-1"},
+	{"md5", "MD5"},
+}
+
+// File is a single file of the tree.
+type File struct {
+	Path      string            // relative to the root of the tree
+	Size      int64             // size in bytes
+	Modified  time.Time         // modification time, zero if unknown
+	Uploaded  time.Time         // time of deposit, zero if unknown
+	Checksums map[string]string // algorithm name to hex checksum
+	DepositID int               // deposit of the file, 0 if unknown
+	Agent     string            // identifier of the depositing user, if known
+}
+
+// Document collects the files of a tree.
+type Document struct {
+	objID string
+	label string
+	agent string
+	files []File
+}
+
+// New returns an empty document. The object id identifies the tree, e.g. its
+// path, the label is a human readable title and the agent names the software
+// creating the document.
+func New(objID, label, agent string) *Document {
+	return &Document{objID: objID, label: label, agent: agent}
+}
+
+// Add adds a file.
+func (d *Document) Add(f File) {
+	d.files = append(d.files, f)
+}
+
+// Len returns the number of files.
+func (d *Document) Len() int {
+	return len(d.files)
+}
+
+// Marshal returns the METS document as indented XML, with files sorted by
+// path. The creation date is set to now.
+func (d *Document) Marshal() ([]byte, error) {
+	files := append([]File(nil), d.files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	doc := &metsDoc{
+		XMLNSMETS:   NamespaceMETS,
+		XMLNSPREMIS: NamespacePREMIS,
+		XMLNSXLink:  NamespaceXLink,
+		XMLNSXSI:    NamespaceXSI,
+		ObjID:       d.objID,
+		Label:       d.label,
+		Header: metsHdr{
+			CreateDate: time.Now().UTC().Format(time.RFC3339),
+			Agent: metsAgent{
+				Role:      "CREATOR",
+				Type:      "OTHER",
+				OtherType: "SOFTWARE",
+				Name:      d.agent,
+			},
+		},
+		FileSec:   fileSec{Group: fileGrp{Use: "original"}},
+		StructMap: structMap{Type: "physical", Div: &div{Type: "directory", Label: d.label}},
+	}
+	dirs := map[string]*div{"": doc.StructMap.Div}
+	for i, f := range files {
+		if f.Path == "" || strings.HasPrefix(f.Path, "/") {
+			return nil, fmt.Errorf("invalid file path %q", f.Path)
+		}
+		var (
+			n     = strconv.Itoa(i + 1)
+			file  = metsFile{ID: "FILE" + n, AdmID: "AMD" + n, Size: f.Size}
+			amd   = amdSec{ID: "AMD" + n}
+			fixes []premisFixity
+		)
+		if !f.Modified.IsZero() {
+			file.Created = f.Modified.UTC().Format(time.RFC3339)
+		}
+		for _, alg := range algorithms {
+			sum := f.Checksums[alg[0]]
+			if sum == "" {
+				continue
+			}
+			if file.Checksum == "" {
+				file.Checksum, file.ChecksumType = sum, alg[1]
+			}
+			fixes = append(fixes, premisFixity{Algorithm: alg[1], Digest: sum})
+		}
+		file.FLocat = fLocat{LocType: "OTHER", OtherLocType: "SYSTEM", Href: f.Path}
+		amd.TechMD = mdSec{
+			ID: "TECH" + n,
+			Wrap: mdWrap{MDType: "PREMIS:OBJECT", Data: xmlData{Object: &premisObject{
+				Type:       "premis:file",
+				Identifier: premisIdentifier{Type: "local", Value: f.Path},
+				Characteristics: premisCharacteristics{
+					Level:  0,
+					Fixity: fixes,
+					Size:   f.Size,
+				},
+				OriginalName: path.Base(f.Path),
+			}}},
+		}
+		if f.DepositID != 0 || !f.Uploaded.IsZero() {
+			ev := &premisEvent{
+				ID:   premisEventID{Type: "local", Value: "EVENT" + n},
+				Type: "ingestion",
+				Link: premisLinkingObject{Type: "local", Value: f.Path},
+			}
+			if !f.Uploaded.IsZero() {
+				ev.DateTime = f.Uploaded.UTC().Format(time.RFC3339)
+			}
+			if f.DepositID != 0 {
+				ev.Detail = &premisEventDetail{Detail: fmt.Sprintf("vault deposit %d", f.DepositID)}
+			}
+			if f.Agent != "" {
+				ev.Agent = &premisLinkingAgent{Type: "local", Value: f.Agent, Role: "implementer"}
+			}
+			amd.DigiprovMD = &mdSec{
+				ID:   "PROV" + n,
+				Wrap: mdWrap{MDType: "PREMIS:EVENT", Data: xmlData{Event: ev}},
+			}
+		}
+		doc.FileSec.Group.Files = append(doc.FileSec.Group.Files, file)
+		doc.AmdSecs = append(doc.AmdSecs, amd)
+		parent := mkdirAll(dirs, path.Dir(f.Path))
+		parent.Divs = append(parent.Divs, &div{
+			Type:  "file",
+			Label: path.Base(f.Path),
+			Fptr:  &fptr{FileID: file.ID},
+		})
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// mkdirAll returns the div of a directory, creating it and its parents as
+// needed.
+func mkdirAll(dirs map[string]*div, dir string) *div {
+	if dir == "." {
+		dir = ""
+	}
+	if d, ok := dirs[dir]; ok {
+		return d
+	}
+	parent := mkdirAll(dirs, path.Dir(dir))
+	d := &div{Type: "directory", Label: path.Base(dir)}
+	parent.Divs = append(parent.Divs, d)
+	dirs[dir] = d
+	return d
+}
+
+// The element names carry the namespace prefixes declared on the root
+// element, which keeps the output readable; encoding/xml would otherwise
+// repeat the namespaces on every element.
+
+type metsDoc struct {
+	XMLName     xml.Name  `xml:"mets:mets"`
+	XMLNSMETS   string    `xml:"xmlns:mets,attr"`
+	XMLNSPREMIS string    `xml:"xmlns:premis,attr"`
+	XMLNSXLink  string    `xml:"xmlns:xlink,attr"`
+	XMLNSXSI    string    `xml:"xmlns:xsi,attr"`
+	ObjID       string    `xml:"OBJID,attr"`
+	Label       string    `xml:"LABEL,attr,omitempty"`
+	Header      metsHdr   `xml:"mets:metsHdr"`
+	AmdSecs     []amdSec  `xml:"mets:amdSec"`
+	FileSec     fileSec   `xml:"mets:fileSec"`
+	StructMap   structMap `xml:"mets:structMap"`
+}
+
+type metsHdr struct {
+	CreateDate string    `xml:"CREATEDATE,attr"`
+	Agent      metsAgent `xml:"mets:agent"`
+}
+
+type metsAgent struct {
+	Role      string `xml:"ROLE,attr"`
+	Type      string `xml:"TYPE,attr"`
+	OtherType string `xml:"OTHERTYPE,attr"`
+	Name      string `xml:"mets:name"`
+}
+
+type amdSec struct {
+	ID         string `xml:"ID,attr"`
+	TechMD     mdSec  `xml:"mets:techMD"`
+	DigiprovMD *mdSec `xml:"mets:digiprovMD,omitempty"`
+}
+
+type mdSec struct {
+	ID   string `xml:"ID,attr"`
+	Wrap mdWrap `xml:"mets:mdWrap"`
+}
+
+type mdWrap struct {
+	MDType string  `xml:"MDTYPE,attr"`
+	Data   xmlData `xml:"mets:xmlData"`
+}
+
+type xmlData struct {
+	Object *premisObject `xml:"premis:object,omitempty"`
+	Event  *premisEvent  `xml:"premis:event,omitempty"`
+}
+
+type premisObject struct {
+	Type            string                `xml:"xsi:type,attr"`
+	Identifier      premisIdentifier      `xml:"premis:objectIdentifier"`
+	Characteristics premisCharacteristics `xml:"premis:objectCharacteristics"`
+	OriginalName    string                `xml:"premis:originalName"`
+}
+
+type premisIdentifier struct {
+	Type  string `xml:"premis:objectIdentifierType"`
+	Value string `xml:"premis:objectIdentifierValue"`
+}
+
+type premisCharacteristics struct {
+	Level  int            `xml:"premis:compositionLevel"`
+	Fixity []premisFixity `xml:"premis:fixity"`
+	Size   int64          `xml:"premis:size"`
+}
+
+type premisFixity struct {
+	Algorithm string `xml:"premis:messageDigestAlgorithm"`
+	Digest    string `xml:"premis:messageDigest"`
+}
+
+type premisEvent struct {
+	ID       premisEventID       `xml:"premis:eventIdentifier"`
+	Type     string              `xml:"premis:eventType"`
+	DateTime string              `xml:"premis:eventDateTime"`
+	Detail   *premisEventDetail  `xml:"premis:eventDetailInformation,omitempty"`
+	Agent    *premisLinkingAgent `xml:"premis:linkingAgentIdentifier,omitempty"`
+	Link     premisLinkingObject `xml:"premis:linkingObjectIdentifier"`
+}
+
+type premisEventID struct {
+	Type  string `xml:"premis:eventIdentifierType"`
+	Value string `xml:"premis:eventIdentifierValue"`
+}
+
+type premisEventDetail struct {
+	Detail string `xml:"premis:eventDetail"`
+}
+
+type premisLinkingAgent struct {
+	Type  string `xml:"premis:linkingAgentIdentifierType"`
+	Value string `xml:"premis:linkingAgentIdentifierValue"`
+	Role  string `xml:"premis:linkingAgentRole"`
+}
+
+type premisLinkingObject struct {
+	Type  string `xml:"premis:linkingObjectIdentifierType"`
+	Value string `xml:"premis:linkingObjectIdentifierValue"`
+}
+
+type fileSec struct {
+	Group fileGrp `xml:"mets:fileGrp"`
+}
+
+type fileGrp struct {
+	Use   string     `xml:"USE,attr"`
+	Files []metsFile `xml:"mets:file"`
+}
+
+type metsFile struct {
+	ID           string `xml:"ID,attr"`
+	AdmID        string `xml:"ADMID,attr"`
+	Size         int64  `xml:"SIZE,attr"`
+	Created      string `xml:"CREATED,attr,omitempty"`
+	Checksum     string `xml:"CHECKSUM,attr,omitempty"`
+	ChecksumType string `xml:"CHECKSUMTYPE,attr,omitempty"`
+	FLocat       fLocat `xml:"mets:FLocat"`
+}
+
+type fLocat struct {
+	LocType      string `xml:"LOCTYPE,attr"`
+	OtherLocType string `xml:"OTHERLOCTYPE,attr"`
+	Href         string `xml:"xlink:href,attr"`
+}
+
+type structMap struct {
+	Type string `xml:"TYPE,attr"`
+	Div  *div   `xml:"mets:div"`
+}
+
+type div struct {
+	Type  string `xml:"TYPE,attr"`
+	Label string `xml:"LABEL,attr"`
+	Fptr  *fptr  `xml:"mets:fptr,omitempty"`
+	Divs  []*div `xml:"mets:div"`
+}
+
+type fptr struct {
+	FileID string `xml:"FILEID,attr"`
+}
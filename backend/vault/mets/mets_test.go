@@ -0,0 +1,70 @@
+package mets
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	d := New("/c/tree", "tree", "rclone")
+	uploaded := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	d.Add(File{Path: "sub/b.txt", Size: 3, Checksums: map[string]string{"md5": "bb", "sha256": "22"}, DepositID: 7, Uploaded: uploaded, Agent: "admin"})
+	d.Add(File{Path: "a.txt", Size: 1, Checksums: map[string]string{"md5": "aa"}})
+	b, err := d.Marshal()
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	// Decode with resolved namespaces, to check the prefixes are declared.
+	var doc struct {
+		ObjID string `xml:"OBJID,attr"`
+		Files []struct {
+			ID           string `xml:"ID,attr"`
+			Checksum     string `xml:"CHECKSUM,attr"`
+			ChecksumType string `xml:"CHECKSUMTYPE,attr"`
+			FLocat       struct {
+				Href string `xml:"http://www.w3.org/1999/xlink href,attr"`
+			} `xml:"http://www.loc.gov/METS/ FLocat"`
+		} `xml:"http://www.loc.gov/METS/ fileSec>fileGrp>file"`
+		Digests []string `xml:"amdSec>techMD>mdWrap>xmlData>object>objectCharacteristics>fixity>messageDigest"`
+		Events  []struct {
+			DateTime string `xml:"http://www.loc.gov/premis/v3 eventDateTime"`
+			Detail   string `xml:"http://www.loc.gov/premis/v3 eventDetailInformation>eventDetail"`
+		} `xml:"amdSec>digiprovMD>mdWrap>xmlData>event"`
+		Root struct {
+			Divs []struct {
+				Label string `xml:"LABEL,attr"`
+				Divs  []struct {
+					Label string `xml:"LABEL,attr"`
+					Fptr  struct {
+						FileID string `xml:"FILEID,attr"`
+					} `xml:"http://www.loc.gov/METS/ fptr"`
+				} `xml:"http://www.loc.gov/METS/ div"`
+			} `xml:"http://www.loc.gov/METS/ div"`
+		} `xml:"http://www.loc.gov/METS/ structMap>div"`
+	}
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("unmarshal failed: %v\n%s", err, b)
+	}
+	switch {
+	case doc.ObjID != "/c/tree":
+		t.Errorf("got objid %q", doc.ObjID)
+	case len(doc.Files) != 2 || doc.Files[0].FLocat.Href != "a.txt" || doc.Files[1].ChecksumType != "SHA-256" || doc.Files[1].Checksum != "22":
+		t.Errorf("unexpected files: %+v", doc.Files)
+	case strings.Join(doc.Digests, ",") != "aa,22,bb":
+		t.Errorf("unexpected digests: %v", doc.Digests)
+	case len(doc.Events) != 1 || doc.Events[0].DateTime != "2024-01-02T03:04:05Z" || doc.Events[0].Detail != "vault deposit 7":
+		t.Errorf("unexpected events: %+v", doc.Events)
+	case len(doc.Root.Divs) != 2 || doc.Root.Divs[1].Label != "sub" || doc.Root.Divs[1].Divs[0].Fptr.FileID != "FILE2":
+		t.Errorf("unexpected struct map: %+v", doc.Root)
+	}
+}
+
+func TestMarshalInvalidPath(t *testing.T) {
+	d := New("/c", "c", "rclone")
+	d.Add(File{Path: "/a.txt"})
+	if _, err := d.Marshal(); err == nil {
+		t.Errorf("expected error for absolute path")
+	}
+}
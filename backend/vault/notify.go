@@ -0,0 +1,80 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/oapi"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fshttp"
+)
+
+// notifyTimeout limits the time spent on a finalize notification.
+const notifyTimeout = 30 * time.Second
+
+// FinalizeSummary is posted to on_finalize_url, after a deposit has been
+// finalized.
+type FinalizeSummary struct {
+	DepositID int     `json:"deposit_id"`
+	Remote    string  `json:"remote"`
+	Files     int64   `json:"files"`
+	Bytes     int64   `json:"bytes"`
+	Status    string  `json:"status"` // "finalized" or "failed"
+	Error     string  `json:"error,omitempty"`
+	Duration  float64 `json:"duration_seconds"`
+	Finished  string  `json:"finished_at"`
+	URL       string  `json:"url"` // deposit in the web interface
+}
+
+// notifyFinalize posts a summary of a deposit to on_finalize_url. Errors are
+// only logged. Expects f.mu to be held.
+func (f *Fs) notifyFinalize(ctx context.Context, d *deposit, finalizeErr error) {
+	summary := FinalizeSummary{
+		DepositID: d.id,
+		Remote:    fs.ConfigString(f),
+		Files:     d.files,
+		Bytes:     d.bytes,
+		Status:    "finalized",
+		Duration:  time.Since(d.started).Seconds(),
+		Finished:  time.Now().UTC().Format(time.RFC3339),
+		URL:       f.opt.DepositURL(d.id),
+	}
+	if finalizeErr != nil {
+		summary.Status, summary.Error = "failed", finalizeErr.Error()
+	}
+	if err := postJSON(ctx, f.opt.OnFinalizeURL, summary); err != nil {
+		fs.Logf(f, "finalize notification to %v failed: %v", f.opt.OnFinalizeURL, err)
+		return
+	}
+	fs.Debugf(f, "sent finalize notification to %v", f.opt.OnFinalizeURL)
+}
+
+// postJSON posts v as JSON to url, expecting a 2xx response. The request does
+// not carry any vault credentials.
+func postJSON(ctx context.Context, url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", oapi.VaultRcloneUserAgentString)
+	resp, err := fshttp.NewClient(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package oapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/backend/vault/cache"
+	"github.com/rclone/rclone/fs"
+)
+
+// WithPersistentCache keeps resolved paths, directory listings and collection
+// stats in a persistent cache, so repeated runs over large, static
+// collections do not crawl the tree again. A change done through the api
+// drops the entries it affects.
+func WithPersistentCache(p *cache.Persistent) Option {
+	return func(capi *CompatAPI) {
+		capi.persistent = p
+	}
+}
+
+// persistentKey scopes a cache key to the selected organization.
+func (capi *CompatAPI) persistentKey(kind, k string) string {
+	return kind + ":" + capi.organization + ":" + k
+}
+
+// persistentGet decodes a cached value into v, returns false if there is no
+// persistent cache or no such value.
+func (capi *CompatAPI) persistentGet(kind, k string, v interface{}) bool {
+	if capi.persistent == nil {
+		return false
+	}
+	return capi.persistent.Get(capi.persistentKey(kind, k), v)
+}
+
+// persistentSet caches a value, errors are logged only.
+func (capi *CompatAPI) persistentSet(kind, k string, v interface{}) {
+	if capi.persistent == nil {
+		return
+	}
+	if err := capi.persistent.Set(capi.persistentKey(kind, k), v); err != nil {
+		fs.Debugf(capi, "failed to update persistent cache: %v", err)
+	}
+}
+
+// invalidate drops the cached entries a successful change may have made
+// stale: the resolved paths at and below each of paths, the listings of the
+// treenodes with the given ids and collection stats, in the persistent cache
+// and among the prefetched treenodes.
+func (capi *CompatAPI) invalidate(paths []string, ids ...int64) {
+	capi.prefetched.evict(paths, ids...)
+	if capi.persistent == nil {
+		return
+	}
+	var (
+		keys     = []string{capi.persistentKey("stats", "collections")}
+		prefixes []string
+	)
+	for _, p := range paths {
+		keys = append(keys, capi.persistentKey("path", p))
+		prefixes = append(prefixes, capi.persistentKey("path", strings.TrimRight(p, "/")+"/"))
+	}
+	for _, id := range ids {
+		keys = append(keys, capi.persistentKey("list", fmt.Sprintf("%d", id)))
+	}
+	if err := capi.persistent.Delete(keys, prefixes); err != nil {
+		fs.Debugf(capi, "failed to update persistent cache: %v", err)
+	}
+}
+
+// invalidateCollections drops the cached entries of the collections with the
+// given names and the listing of the organization, or the whole persistent
+// cache, if the organization treenode cannot be found.
+func (capi *CompatAPI) invalidateCollections(ctx context.Context, names ...string) {
+	root, err := capi.root(ctx)
+	if err != nil {
+		capi.InvalidateCache()
+		return
+	}
+	var paths []string
+	for _, name := range names {
+		paths = append(paths, "/"+name)
+	}
+	capi.invalidate(paths, root.ID)
+}
+
+// cachePath returns the absolute path of a treenode as used in cache keys,
+// i.e. below the organization, which is the first segment of treenode paths.
+func cachePath(t *api.TreeNode) string {
+	segments := pathSegments(t.Path)
+	if len(segments) == 0 {
+		return "/"
+	}
+	return "/" + strings.Join(segments[1:], "/")
+}
+
+// parentID returns the id of the parent of a treenode, zero if unknown.
+func parentID(t *api.TreeNode) int64 {
+	id, _ := strconv.ParseInt(t.ParentTreeNodeIdentifier(), 10, 64)
+	return id
+}
+
+// InvalidateCache clears the persistent cache, if any, and drops prefetched
+// treenodes. Should be called after a deposit, which bypasses this api.
+func (capi *CompatAPI) InvalidateCache() {
+	capi.prefetched.reset()
+	capi.InvalidatePersistentCache()
+}
+
+// InvalidatePersistentCache clears the persistent cache only, e.g. when a
+// deposit is registered: its files show up in the tree with finalize, but
+// a later run must not see listings from before the deposit.
+func (capi *CompatAPI) InvalidatePersistentCache() {
+	if capi.persistent == nil {
+		return
+	}
+	if err := capi.persistent.Reset(); err != nil {
+		fs.Debugf(capi, "failed to reset persistent cache: %v", err)
+	}
+}
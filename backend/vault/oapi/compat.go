@@ -7,11 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
-	"net/http/httputil"
 	"net/url"
+	"path"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -20,15 +19,16 @@ import (
 
 	"github.com/antchfx/htmlquery"
 	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/backend/vault/cache"
 	"github.com/rclone/rclone/fs"
-	"github.com/rclone/rclone/lib/rest"
+	"golang.org/x/sync/singleflight"
 )
 
 // TODO(martin): use oapi generated code, not legacyAPI
 //
 // * [ ] keep only types from the API (e.g. for signatures)
 // * [ ] remove all code from manual API except for the types
-// * [ ] start to rewrite client code in terms of the new API
+// * [x] start to rewrite client code in terms of the new API
 // * [ ] move legacy api types to generated types
 // * [ ] once client side code uses only new API constructs, delete manual API completely
 //
@@ -38,8 +38,13 @@ const (
 	VaultVersionHeader = "X-Vault-API-Version"
 	// VersionSupported is the version of the vault API this package implements.
 	VersionSupported = "3"
+	// AuthorizationScheme is used with an API key, as expected by DRF
+	// TokenAuthentication.
+	AuthorizationScheme = "Token"
 	// maxResponseBody limit in bytes when reading a response body.
 	maxResponseBody = 1 << 24
+	// resolveTimeout limits a path lookup shared by concurrent callers.
+	resolveTimeout = 5 * time.Minute
 )
 
 var (
@@ -49,12 +54,29 @@ var (
 	ErrAmbiguousQuery = errors.New("ambiguous query")
 	// ErrMissingCSRFToken may occur, if site structure changes
 	ErrMissingCSRFToken = errors.New("missing CSRF token")
-	// ErrObsolete marks a method obsoleted.
-	ErrObsolete = errors.New("obsolete: api has been removed")
 	// VaultRcloneUserAgentString set the User-Agent string (for most requests)
 	VaultRcloneUserAgentString = fmt.Sprintf("rclone/%s (vault-api v%s)", fs.Version, VersionSupported)
 )
 
+// UserAgent returns the User-Agent string with an identifier appended, e.g.
+// of an institution or ingest pipeline, so server logs can attribute
+// traffic. An empty identifier is ignored.
+func UserAgent(identifier string) string {
+	if identifier = strings.TrimSpace(identifier); identifier == "" {
+		return VaultRcloneUserAgentString
+	}
+	return VaultRcloneUserAgentString + " " + identifier
+}
+
+// loginMethod is the way we authenticate with username and password.
+type loginMethod int
+
+const (
+	loginMethodUnknown loginMethod = iota // not yet probed
+	loginMethodJSON                       // JSON auth endpoint
+	loginMethodForm                       // HTML login form, fallback
+)
+
 // Error for failed api requests.
 type Error struct {
 	err error
@@ -66,23 +88,33 @@ func (e *Error) Error() string {
 }
 
 // CompatAPI is a compatibility layer and provides the exact same API to vault
-// as the manually written one, but will only use the openapi-generated code
-// after some transition period.
-//
-// Uglyness of two separate clients, a basic HTTP client that is wrapped by
-// the OpenAPI client and that does authentication. Plus a legacy API that
-// uses a different authentication mechanism and that we keep around for the
-// transition period as fallback.
+// as the manually written one, but only uses the openapi-generated code. A
+// few endpoints not covered by the schema are accessed with plain HTTP
+// requests.
 //
-// TODO(martin): move all methods to use openapi client only
+// There are two clients, a basic HTTP client that does authentication and
+// that is wrapped by the OpenAPI client.
 type CompatAPI struct {
 	Endpoint string
 	Username string
 	Password string
+	// APIKey, if set, is sent in an Authorization header with every request,
+	// bypassing the login form and CSRF handling altogether.
+	APIKey string
+	// oauth is true, if c is an oauth2 client, which takes care of
+	// authorization and token refresh.
+	oauth bool
+	// organization is the name of the selected organization; if empty, we
+	// use the organization of the user.
+	organization string
 	// VersionSupported by this implementation. This is should checked before
 	// any other operation.
 	VersionSupported string
 	loginPath        string
+	// jsonLoginPath is relative to the API endpoint and is used, if the server
+	// supports it; loginMethod is determined on first login.
+	jsonLoginPath string
+	loginMethod   loginMethod
 	// c is a vanilla http.Client for now, will be wrapped by
 	// deepmap/oapi-codegen generated client.  On login, we need to set cookies
 	// on the HTTP client, that's why we need to keep this around separately
@@ -97,11 +129,87 @@ type CompatAPI struct {
 	// you're using SessionAuthentication you'll need to include valid CSRF
 	// tokens for any POST, PUT, PATCH or DELETE operations" (DRF docs).
 	csrfTokenPattern *regexp.Regexp
-	// legacyAPI, so we can replace and test one function at a time
-	legacyAPI *api.API
+	// csrf caches the CSRF token
+	csrf csrfState
+	// pacer, if set, paces and retries all API requests
+	pacer *fs.Pacer
+	// requestLog, if set, logs all requests
+	requestLog *requestLog
+	// httpDump, if set, records failed requests
+	httpDump *HTTPDump
+	// cache for values that do not change during a session, e.g. the root
+	// treenode of the organization
+	cache *cache.Cache
+	// persistent, if set, caches paths and listings across invocations
+	persistent *cache.Persistent
+	// prefetched answers lookups within subtrees fetched ahead, see Prefetch
+	prefetched prefetched
+	// resolveGroup deduplicates concurrent path resolutions
+	resolveGroup singleflight.Group
+	// userAgent is sent with every request
+	userAgent string
 }
 
-func New(endpoint, username, password string) (*CompatAPI, error) {
+// Option configures a CompatAPI.
+type Option func(*CompatAPI)
+
+// WithAPIKey configures token authentication, e.g. for service accounts.
+func WithAPIKey(key string) Option {
+	return func(capi *CompatAPI) {
+		capi.APIKey = key
+	}
+}
+
+// WithOAuthClient uses an HTTP client which handles authentication itself,
+// e.g. a client returned from oauthutil.NewClient.
+func WithOAuthClient(c *http.Client) Option {
+	return func(capi *CompatAPI) {
+		capi.c = c
+		capi.oauth = true
+	}
+}
+
+// WithOrganization selects an organization by name, for users which can
+// access more than one organization.
+func WithOrganization(name string) Option {
+	return func(capi *CompatAPI) {
+		capi.organization = name
+	}
+}
+
+// WithClient sets the base HTTP client, e.g. one from fshttp.NewClient, so
+// proxy settings, timeouts and user agent flags apply. Ignored for oauth
+// clients, which are built on top of such a client already. Login sets a
+// cookie jar on this client.
+func WithClient(c *http.Client) Option {
+	return func(capi *CompatAPI) {
+		if !capi.oauth {
+			capi.c = c
+		}
+	}
+}
+
+// WithUserAgent sets the User-Agent string sent with every request, e.g.
+// one returned by UserAgent.
+func WithUserAgent(ua string) Option {
+	return func(capi *CompatAPI) {
+		capi.userAgent = ua
+	}
+}
+
+// WithTransport sets the transport used for all requests, e.g. one derived
+// from rclone's TLS and certificate flags. Ignored for oauth clients, which
+// bring their own transport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(capi *CompatAPI) {
+		if !capi.oauth {
+			capi.c.Transport = rt
+		}
+	}
+}
+
+// New sets up a new compat api, to be followed by a Login.
+func New(endpoint, username, password string, opts ...Option) (*CompatAPI, error) {
 	// TODO: need at least an HTTP client with cookie setup
 	stripped := strings.TrimRight(strings.Replace(endpoint, "/api", "", 1), "/")
 	capi := &CompatAPI{
@@ -110,14 +218,19 @@ func New(endpoint, username, password string) (*CompatAPI, error) {
 		Password:         password,
 		VersionSupported: VersionSupported,
 		loginPath:        "/accounts/login/",
+		jsonLoginPath:    "/auth/login/",
 		// TODO: using vanilla client for now, but could upgrade to pester or something else
 		c:                &http.Client{Timeout: 30 * time.Second},
 		csrfTokenPattern: regexp.MustCompile(`"?csrfToken"?:[ ]*"([^"]*)"`),
-		legacyAPI:        api.New(endpoint, username, password),
+		cache:            cache.New(),
+		userAgent:        VaultRcloneUserAgentString,
+	}
+	for _, opt := range opts {
+		opt(capi)
 	}
 	// NewClient wants the URL w/o the "/api" suffix by default.
 	client, err := NewClientWithResponses(stripped,
-		WithHTTPClient(capi.c),
+		WithHTTPClient(&csrfRetryDoer{capi: capi}),
 		WithRequestEditorFn(capi.Intercept))
 	if err != nil {
 		return nil, err
@@ -131,47 +244,48 @@ func (capi *CompatAPI) Client() *http.Client {
 	return capi.c
 }
 
+// Authorize sets the Authorization header, if an API key is configured. It can
+// be used as a request editor by any client sharing this API's session, e.g.
+// the deposits client.
+func (capi *CompatAPI) Authorize(ctx context.Context, req *http.Request) error {
+	if capi.APIKey != "" {
+		req.Header.Set("Authorization", AuthorizationScheme+" "+capi.APIKey)
+	}
+	return nil
+}
+
 // Intercept adds required headers to each request, namely a csrf token and
-// referer. Some vault endpoints are exempt from CSRF, but that's not reflected
-// here at the moment.
+// referer for unsafe methods. Some vault endpoints are exempt from CSRF, but
+// that's not reflected here at the moment. With token authentication, CSRF
+// does not apply. The CSRF token is cached for the session.
 func (capi *CompatAPI) Intercept(ctx context.Context, req *http.Request) error {
-	req.Header.Set("User-Agent", VaultRcloneUserAgentString)
-	fs.Debugf(capi, "api CSRF intercept")
-	// previously, we used api/collections or api/users, etc - but we don't get
-	// any HTML back from resource endpoints; but just .../api works
-	anyLink := capi.Endpoint
-	fs.Debugf(capi, "using referer: %v", anyLink)
-	r, err := http.NewRequest("GET", anyLink, nil)
-	if err != nil {
-		return err
-	}
-	r.Header.Set("Accept", "text/html")
-	resp, err := capi.c.Do(r)
-	if err != nil {
-		return err
+	req.Header.Set("User-Agent", capi.userAgent)
+	if !capi.usesSession() {
+		return capi.Authorize(ctx, req)
 	}
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("intercept link at %s failed with: %d", anyLink, resp.StatusCode)
+	if isSafeMethod(req.Method) {
+		return nil
 	}
-	defer resp.Body.Close() // nolint:errcheck
-	b, err := io.ReadAll(resp.Body)
+	token, err := capi.csrfToken(ctx)
 	if err != nil {
 		return err
 	}
-	if matches := capi.csrfTokenPattern.FindStringSubmatch(string(b)); len(matches) == 2 {
-		req.Header.Set("X-CSRFTOKEN", matches[1])
-		req.Header.Set("Referer", anyLink)
-		fs.Debugf(capi, "set header: %v", req.Header)
-		return nil
-	}
-	return ErrMissingCSRFToken
+	req.Header.Set("X-CSRFTOKEN", token)
+	req.Header.Set("Referer", capi.Endpoint)
+	return nil
+}
+
+// usesSession returns true, if we authenticate with a session cookie, which
+// requires a login and CSRF tokens.
+func (capi *CompatAPI) usesSession() bool {
+	return capi.APIKey == "" && !capi.oauth
 }
 
 // Compatibility methods, from vault/api/api.go
 // --------------------------------------------
 
 func (capi *CompatAPI) Version(ctx context.Context) string {
-	r, err := http.NewRequest("GET", capi.Endpoint, nil)
+	r, err := http.NewRequestWithContext(ctx, "GET", capi.Endpoint, nil)
 	if err != nil {
 		return ""
 	}
@@ -186,10 +300,12 @@ func (capi *CompatAPI) String() string {
 	return fmt.Sprintf("vault (v%s compat)", api.VersionSupported)
 }
 
-// Login equips the HTTP client with a session cookie.
+// Login equips the HTTP client with a session cookie. With an API key or
+// oauth, there is no session and login is a noop.
 //
-// Need to setup the cookie jar for the HTTP client as well as the cookie for
-// the legacy client.
+// If the server offers a JSON login endpoint, we use that, otherwise we fall
+// back to the HTML login form. The method is determined once by probing.
+// Session cookies are shared with the legacy client.
 //
 // TODO: The session may expire after some time (e.g. two weeks) so best would
 // be to refresh the session expiry time after each request.  Cf.
@@ -197,9 +313,105 @@ func (capi *CompatAPI) String() string {
 // and
 // https://docs.djangoproject.com/en/4.2/ref/settings/#std-setting-SESSION_SAVE_EVERY_REQUEST
 func (capi *CompatAPI) Login() error {
-	if err := capi.legacyAPI.Login(); err != nil {
+	return capi.LoginContext(context.Background())
+}
+
+// LoginContext is Login, with the login requests bound to ctx.
+func (capi *CompatAPI) LoginContext(ctx context.Context) error {
+	if !capi.usesSession() {
+		fs.Debugf(capi, "using token authentication, skipping login")
+		return nil
+	}
+	u, err := url.Parse(capi.Endpoint)
+	if err != nil {
+		return err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	capi.c.Jar = jar
+	capi.invalidateCSRFToken()
+	switch capi.loginMethod {
+	case loginMethodForm:
+		err = capi.loginForm(ctx, jar)
+	case loginMethodJSON:
+		_, err = capi.loginJSON(ctx)
+	default:
+		var ok bool
+		if ok, err = capi.loginJSON(ctx); err == nil {
+			if ok {
+				capi.loginMethod = loginMethodJSON
+			} else {
+				fs.Debugf(capi, "json login not available, falling back to login form")
+				capi.loginMethod = loginMethodForm
+				err = capi.loginForm(ctx, jar)
+			}
+		}
+	}
+	if err != nil {
 		return err
 	}
+	for i, c := range capi.c.Jar.Cookies(u) {
+		fs.Debugf(capi, "cookie #%d: %v", i, c)
+	}
+	return nil
+}
+
+// loginJSON tries to login via a JSON endpoint. Returns false, if the server
+// does not offer this endpoint.
+func (capi *CompatAPI) loginJSON(ctx context.Context) (ok bool, err error) {
+	var (
+		u   *url.URL
+		buf bytes.Buffer
+	)
+	if u, err = url.Parse(capi.Endpoint); err != nil {
+		return false, err
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + capi.jsonLoginPath
+	payload := struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{
+		Username: capi.Username,
+		Password: capi.Password,
+	}
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), &buf)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Referer", u.String())
+	req.Header.Set("User-Agent", capi.userAgent)
+	resp, err := capi.roundTrip(req)
+	if err != nil {
+		return false, fmt.Errorf("vault login: %w", err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	switch {
+	case resp.StatusCode == http.StatusNotFound ||
+		resp.StatusCode == http.StatusMethodNotAllowed ||
+		resp.StatusCode == http.StatusNotImplemented:
+		return false, nil
+	case !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json"):
+		// Probably some HTML page, e.g. a catch-all route.
+		return false, nil
+	case resp.StatusCode >= 400:
+		return true, ErrorFromResponse("login", resp)
+	}
+	if len(capi.c.Jar.Cookies(u)) == 0 {
+		return true, fmt.Errorf("login succeeded, but no session cookie received")
+	}
+	return true, nil
+}
+
+// loginForm logs in via the HTML login form, which requires to parse a CSRF
+// token from the page first.
+func (capi *CompatAPI) loginForm(ctx context.Context, jar http.CookieJar) error {
 	var (
 		u   *url.URL
 		b   []byte
@@ -210,7 +422,13 @@ func (capi *CompatAPI) Login() error {
 	}
 	u.Path = strings.Replace(u.Path, "/api", capi.loginPath, 1)
 	loginPath := u.String()
-	resp, err := http.Get(loginPath)
+	// Separate client, we only want the CSRF token from the page.
+	client := &http.Client{Transport: capi.c.Transport, Timeout: capi.c.Timeout}
+	req, err := http.NewRequestWithContext(ctx, "GET", loginPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("cannot access login url: %w", err)
 	}
@@ -226,10 +444,6 @@ func (capi *CompatAPI) Login() error {
 		htmlquery.FindOne(doc, `//input[@name="csrfmiddlewaretoken"]`),
 		"value",
 	)
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return err
-	}
 	// Need to reparse, api may live on a different path.
 	u, err = url.Parse(capi.Endpoint)
 	if err != nil {
@@ -239,12 +453,11 @@ func (capi *CompatAPI) Login() error {
 		Name:  "csrftoken",
 		Value: token,
 	}})
-	capi.c.Jar = jar
 	data := url.Values{}
 	data.Set("username", capi.Username)
 	data.Set("password", capi.Password)
 	data.Set("csrfmiddlewaretoken", token)
-	req, err := http.NewRequest("POST", loginPath, strings.NewReader(data.Encode()))
+	req, err = http.NewRequestWithContext(ctx, "POST", loginPath, strings.NewReader(data.Encode()))
 	if err != nil {
 		return fmt.Errorf("login failed: %w", err)
 	}
@@ -254,16 +467,15 @@ func (capi *CompatAPI) Login() error {
 	// is required for security reasons, to ensure that your browser is not
 	// being hijacked by third parties.
 	req.Header.Set("Referer", loginPath)
-	resp, err = capi.c.Do(req)
+	resp, err = capi.roundTrip(req)
 	if err != nil {
 		return fmt.Errorf("vault login: %w", err)
 	}
 	defer resp.Body.Close() // nolint:errcheck
 	if resp.StatusCode >= 400 {
-		b, _ = ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("login failed with: %v (%s)", resp.StatusCode, string(b))
+		return ErrorFromResponse("login", resp)
 	}
-	b, _ = httputil.DumpResponse(resp, true)
+	b, _ = io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
 	if bytes.Contains(b, []byte(`Your username and password didn't match`)) {
 		return fmt.Errorf("username and password did not match")
 	}
@@ -271,15 +483,56 @@ func (capi *CompatAPI) Login() error {
 		msg := fmt.Sprintf("expected 2 cookies, got %v", len(jar.Cookies(u)))
 		return fmt.Errorf(msg)
 	}
-	for i, c := range capi.c.Jar.Cookies(u) {
-		fs.Debugf(capi, "cookie #%d: %v", i, c)
+	return nil
+}
+
+// Session contains the state required to resume an authenticated session,
+// e.g. from a previous invocation.
+type Session struct {
+	Cookies   []*http.Cookie `json:"cookies"`
+	CSRFToken string         `json:"csrf_token"`
+}
+
+// Session returns the current session state, or nil if there is no session.
+func (capi *CompatAPI) Session() (*Session, error) {
+	if !capi.usesSession() || capi.c.Jar == nil {
+		return nil, nil
+	}
+	u, err := url.Parse(capi.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{Cookies: capi.c.Jar.Cookies(u)}
+	for _, c := range session.Cookies {
+		if c.Name == "csrftoken" {
+			session.CSRFToken = c.Value
+		}
+	}
+	return session, nil
+}
+
+// ResumeSession sets up clients with the cookies and the CSRF token from a
+// previous session. The session may have expired, which is only noticed on
+// the next request.
+func (capi *CompatAPI) ResumeSession(session *Session) error {
+	u, err := url.Parse(capi.Endpoint)
+	if err != nil {
+		return err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
 	}
+	jar.SetCookies(u, session.Cookies)
+	capi.c.Jar = jar
+	capi.setCSRFToken(session.CSRFToken)
 	return nil
 }
 
 // Logout drops the session.
 func (capi *CompatAPI) Logout() error {
-	capi.legacyAPI.Logout()
+	capi.cache.Reset()
+	capi.invalidateCSRFToken()
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		return err
@@ -288,71 +541,433 @@ func (capi *CompatAPI) Logout() error {
 	return nil
 }
 
-func (capi *CompatAPI) Call(ctx context.Context, opts *rest.Opts) (*http.Response, error) {
-	return capi.legacyAPI.Call(ctx, opts)
+// getJSON performs a GET request on a path relative to the API endpoint and
+// decodes the JSON response into v. This is for endpoints not covered by the
+// OpenAPI schema.
+func (capi *CompatAPI) getJSON(ctx context.Context, p string, params url.Values, v interface{}) error {
+	u, err := url.Parse(capi.Endpoint)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + p
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", capi.userAgent)
+	if err := capi.Authorize(ctx, req); err != nil {
+		return err
+	}
+	resp, err := capi.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode >= 400 {
+		return ErrorFromResponse(strings.TrimPrefix(p, "/"), resp)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBody)).Decode(v)
+}
+
+// SplitPath returns the treenodes for the collection and leaf object for a
+// given absolute path as well as the path without the collection. It is an
+// error if the collection cannot be found.
+func (capi *CompatAPI) SplitPath(ctx context.Context, p string) (*api.PathInfo, error) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("absolute path required: %v", p)
+	}
+	var (
+		err   error
+		pi    api.PathInfo
+		parts = strings.Split(p, "/")
+	)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid path: %v, expected at least to path segments: %v", p, parts)
+	}
+	if pi.CollectionTreeNode, err = capi.ResolvePath(ctx, "/"+parts[1]); err != nil {
+		return nil, err
+	}
+	if pi.LeafTreeNode, err = capi.ResolvePath(ctx, p); err != nil {
+		return nil, err
+	}
+	pi.RelativePath = strings.Join(parts[2:], "/")
+	if pi.RelativePath == "" {
+		pi.RelativePath = "/"
+	}
+	return &pi, nil
+}
+
+// ResolvePath turns an absolute path string into a treenode, by walking the
+// path segments from the organization root, one parent and name query at a
+// time.
+//
+// Concurrent lookups of the same path share a single walk, as with many
+// checkers the same parent directories get resolved over and over.
+func (capi *CompatAPI) ResolvePath(ctx context.Context, p string) (*api.TreeNode, error) {
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	// The shared lookup must not fail for all callers, if the caller who
+	// started it gives up, so it runs detached from its cancellation, within
+	// resolveTimeout. Every caller waits as long as its own ctx allows.
+	ch := capi.resolveGroup.DoChan(p, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resolveTimeout)
+		defer cancel()
+		return capi.resolvePath(ctx, p)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*api.TreeNode), nil
+	}
 }
 
-func (capi *CompatAPI) CallJSON(ctx context.Context, opts *rest.Opts, req, resp interface{}) (*http.Response, error) {
-	return capi.legacyAPI.CallJSON(ctx, opts, req, resp)
+// resolvePath implements ResolvePath, p must be absolute.
+func (capi *CompatAPI) resolvePath(ctx context.Context, p string) (*api.TreeNode, error) {
+	var cached api.TreeNode
+	if capi.persistentGet("path", p, &cached) {
+		return &cached, nil
+	}
+	if t, ok := capi.prefetched.resolve(p); ok {
+		if t == nil {
+			return nil, fs.ErrorObjectNotFound
+		}
+		return t, nil
+	}
+	t, err := capi.root(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// segments: /a/b/c -> [a b c], /a/b/ -> [a b]
+	segments := strings.Split(strings.TrimRight(p, "/"), "/")[1:]
+	for len(segments) > 0 {
+		ts, err := capi.FindTreeNodes(ctx, url.Values{
+			"parent": []string{fmt.Sprintf("%d", t.ID)},
+			"name":   []string{segments[0]},
+		})
+		switch {
+		case err != nil:
+			return nil, err
+		case len(ts) == 0:
+			return nil, fs.ErrorObjectNotFound
+		case len(ts) > 1:
+			return nil, ErrAmbiguousQuery
+		}
+		t, segments = ts[0], segments[1:]
+	}
+	fs.Debugf(capi, "resolve path to treenode: %v => %v", p, t.ID)
+	capi.persistentSet("path", p, t)
+	return t, nil
 }
 
-// SplitPath turns an absolute path string into a PathInfo value.
-func (capi *CompatAPI) SplitPath(p string) (*api.PathInfo, error) {
-	return capi.legacyAPI.SplitPath(p)
+// ResolvePaths resolves many absolute paths at once. Paths are walked level
+// by level from the organization root, with a single treenodes query per
+// parent for all names needed below it, so shared ancestors are resolved
+// once and a deep hierarchy takes a request per level, not one per path and
+// segment. Paths that do not exist are missing from the result, which is
+// keyed by the paths as given. Resolved paths are cached like with
+// ResolvePath.
+func (capi *CompatAPI) ResolvePaths(ctx context.Context, paths []string) (map[string]*api.TreeNode, error) {
+	t, err := capi.root(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		known  = map[string]*api.TreeNode{"/": t}
+		levels [][]string // wanted paths by number of segments
+		seen   = make(map[string]bool)
+	)
+	for _, p := range paths {
+		segments := pathSegments(p)
+		for i := range segments {
+			q := "/" + strings.Join(segments[:i+1], "/")
+			if seen[q] {
+				continue
+			}
+			seen[q] = true
+			var cached api.TreeNode
+			if capi.persistentGet("path", q, &cached) {
+				known[q] = &cached
+				continue
+			}
+			if t, ok := capi.prefetched.resolve(q); ok {
+				if t != nil {
+					known[q] = t
+				}
+				continue
+			}
+			for len(levels) <= i {
+				levels = append(levels, nil)
+			}
+			levels[i] = append(levels[i], q)
+		}
+	}
+	for _, level := range levels {
+		// Group the names of a level by parent; parents that could not be
+		// resolved have no children to look for.
+		var (
+			byParent = make(map[string][]string)
+			parents  []string
+		)
+		for _, q := range level {
+			parent := path.Dir(q)
+			if known[parent] == nil {
+				continue
+			}
+			if byParent[parent] == nil {
+				parents = append(parents, parent)
+			}
+			byParent[parent] = append(byParent[parent], path.Base(q))
+		}
+		for _, parent := range parents {
+			children, err := capi.findChildren(ctx, known[parent], byParent[parent])
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range children {
+				q := path.Join(parent, c.Name)
+				if known[q] != nil {
+					return nil, ErrAmbiguousQuery
+				}
+				known[q] = c
+				capi.persistentSet("path", q, c)
+			}
+		}
+	}
+	result := make(map[string]*api.TreeNode)
+	for _, p := range paths {
+		if t := known["/"+strings.Join(pathSegments(p), "/")]; t != nil {
+			result[p] = t
+		}
+	}
+	fs.Debugf(capi, "resolved %d of %d paths to treenodes", len(result), len(paths))
+	return result, nil
 }
 
-// ResolvePath turns a path string into a treenode.
-func (capi *CompatAPI) ResolvePath(p string) (*api.TreeNode, error) {
-	return capi.legacyAPI.ResolvePath(p)
+// findChildren returns the children of a treenode with any of the given
+// names. Names are sent comma separated, so names containing a comma are
+// looked up one by one.
+func (capi *CompatAPI) findChildren(ctx context.Context, parent *api.TreeNode, names []string) (result []*api.TreeNode, err error) {
+	var (
+		id      = int(parent.ID)
+		batch   []string
+		queries []*TreenodesListParams
+	)
+	for _, name := range names {
+		if strings.Contains(name, ",") {
+			name := name
+			queries = append(queries, &TreenodesListParams{Parent: &id, Name: &name})
+		} else {
+			batch = append(batch, name)
+		}
+	}
+	switch len(batch) {
+	case 0:
+	case 1:
+		queries = append(queries, &TreenodesListParams{Parent: &id, Name: &batch[0]})
+	default:
+		queries = append(queries, &TreenodesListParams{Parent: &id, NameIn: &batch})
+	}
+	for _, params := range queries {
+		err = capi.ForEachTreenode(ctx, params, func(t *TreeNode) error {
+			result = append(result, toLegacyTreeNode(t))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
 }
 
-func (capi *CompatAPI) DepositStatus(id int64) (*api.DepositStatus, error) {
-	return capi.legacyAPI.DepositStatus(id)
-	// TODO: "deposit_status" is not covered by openapi schema
-	// var body bytes.Buffer
-	// err := json.NewEncoder(&body).Encode(struct {
-	// 	ID string `json:"deposit_id"`
-	// }{
-	// 	ID: fmt.Sprintf("%v", id),
-	// })
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// req, err := http.NewRequest("GET", path.Join(capi.Endpoint, "deposit_status"), &body)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// resp, err := capi.c.Do(req)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// defer resp.Body.Close()
-	// if resp.StatusCode >= 400 {
-	// 	return nil, fmt.Errorf("deposit status: got %v", resp.StatusCode)
-	// }
-	// var ds api.DepositStatus
-	// if err := json.NewDecoder(resp.Body).Decode(&ds); err != nil {
-	// 	return nil, err
-	// }
-	// return &ds, nil
+// pathSegments returns the non-empty segments of a path.
+func pathSegments(p string) (result []string) {
+	for _, s := range strings.Split(p, "/") {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
 }
 
+// DepositStatus returns information about a specific deposit.
+func (capi *CompatAPI) DepositStatus(ctx context.Context, id int64) (*api.DepositStatus, error) {
+	resp, err := capi.client.DepositStatusWithResponse(ctx, &DepositStatusParams{DepositId: id})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != 200 || resp.JSON200 == nil {
+		return nil, NewAPIError("deposit status", resp.StatusCode(), resp.Body)
+	}
+	ds := api.DepositStatus(*resp.JSON200)
+	return &ds, nil
+}
+
+// Deposits returns the deposits of the organization, optionally only those
+// in a given state, e.g. "REGISTERED".
+func (capi *CompatAPI) Deposits(ctx context.Context, state string) (result []*api.Deposit, err error) {
+	params := &DepositsListParams{}
+	if state != "" {
+		s := DepositsListParamsState(state)
+		params.State = &s
+	}
+	err = capi.ForEachDeposit(ctx, params, func(d *Deposit) error {
+		result = append(result, toLegacyDeposit(d))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Deposit returns a single deposit.
+func (capi *CompatAPI) Deposit(ctx context.Context, id int64) (*api.Deposit, error) {
+	resp, err := capi.client.DepositsRetrieveWithResponse(ctx, int(id))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != 200 || resp.JSON200 == nil {
+		return nil, NewAPIError("deposit", resp.StatusCode(), resp.Body)
+	}
+	return toLegacyDeposit(resp.JSON200), nil
+}
+
+// Events returns the events of the organization, optionally only those of a
+// given type, e.g. "FIXITY".
+func (capi *CompatAPI) Events(ctx context.Context, typ string) (result []*api.Event, err error) {
+	params := &EventsListParams{}
+	if typ != "" {
+		t := EventsListParamsType(typ)
+		params.Type = &t
+	}
+	err = capi.ForEachEvent(ctx, params, func(e *Event) error {
+		result = append(result, toLegacyEvent(e))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Reports returns the deposit and fixity reports of all collections, oldest
+// first.
+func (capi *CompatAPI) Reports(ctx context.Context) (result []*api.Report, err error) {
+	ordering := "ended_at"
+	err = capi.ForEachReport(ctx, &ReportsListParams{Ordering: &ordering}, func(r *Report) error {
+		result = append(result, toLegacyReport(r))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CollectionSummaries returns size and target replica locations of all
+// collections.
+func (capi *CompatAPI) CollectionSummaries(ctx context.Context) (result []*api.CollectionSummary, err error) {
+	err = capi.ForEachCollectionSummary(ctx, nil, func(c *CollectionSummary) error {
+		result = append(result, toLegacyCollectionSummary(c))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CollectionSettings are preservation settings of a collection. Zero values
+// are not sent, leaving the setting to the plan default.
+type CollectionSettings struct {
+	FixityFrequency   string
+	TargetReplication int
+}
+
+// CreateCollection creates a collection with default settings.
 func (capi *CompatAPI) CreateCollection(ctx context.Context, name string) error {
+	return capi.CreateCollectionWithSettings(ctx, name, CollectionSettings{})
+}
+
+// CreateCollectionWithSettings creates a collection, with fixity frequency
+// and target replication, if set.
+func (capi *CompatAPI) CreateCollectionWithSettings(ctx context.Context, name string, settings CollectionSettings) error {
 	body := CollectionsCreateJSONRequestBody{
 		Name: name,
 	}
+	if settings.FixityFrequency != "" {
+		v := FixityFrequencyEnum(settings.FixityFrequency)
+		body.FixityFrequency = &v
+	}
+	if settings.TargetReplication != 0 {
+		v := TargetReplicationEnum(settings.TargetReplication)
+		body.TargetReplication = &v
+	}
 	resp, err := capi.client.CollectionsCreate(ctx, body)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close() // nolint:errcheck
 	if resp.StatusCode >= 400 {
-		b, err := httputil.DumpResponse(resp, true)
-		if err != nil {
-			return err
-		}
-		fs.Debugf(capi, "create collection: got http %v: %s", resp.StatusCode, string(b))
-		return fmt.Errorf("create collection: got http %v", resp.StatusCode)
+		return ErrorFromResponse("create collection", resp)
+	}
+	capi.invalidateCollections(ctx, name)
+	return nil
+}
+
+// UpdateCollection changes the settings of a collection, zero values are
+// left unchanged. Like Move, this only sends the fields to patch.
+func (capi *CompatAPI) UpdateCollection(ctx context.Context, c *api.Collection, settings CollectionSettings) error {
+	var (
+		payload = struct {
+			FixityFrequency   string `json:"fixity_frequency,omitempty"`
+			TargetReplication int    `json:"target_replication,omitempty"`
+		}{settings.FixityFrequency, settings.TargetReplication}
+		buf bytes.Buffer
+	)
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return err
+	}
+	resp, err := capi.client.CollectionsPartialUpdateWithBody(
+		ctx, int(c.Identifier()), "application/json", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode >= 400 {
+		return ErrorFromResponse("update collection", resp)
+	}
+	return nil
+}
+
+// RenameCollection renames a collection, which also renames its treenode.
+func (capi *CompatAPI) RenameCollection(ctx context.Context, c *api.Collection, name string) error {
+	var (
+		payload = struct {
+			Name string `json:"name"`
+		}{name}
+		buf bytes.Buffer
+	)
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return err
+	}
+	resp, err := capi.client.CollectionsPartialUpdateWithBody(
+		ctx, int(c.Identifier()), "application/json", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode >= 400 {
+		return ErrorFromResponse("rename collection", resp)
 	}
+	capi.invalidateCollections(ctx, c.Name, name)
 	return nil
 }
 
@@ -370,14 +985,11 @@ func (capi *CompatAPI) CreateFolder(ctx context.Context, parent *api.TreeNode, n
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close() // nolint:errcheck
 	if resp.StatusCode >= 400 {
-		b, err := httputil.DumpResponse(resp, true)
-		if err != nil {
-			return err
-		}
-		fs.Debugf(capi, "create folder: got http %v: %s", resp.StatusCode, string(b))
-		return fmt.Errorf("create folder: got http %v", resp.StatusCode)
+		return ErrorFromResponse("create folder", resp)
 	}
+	capi.invalidate([]string{path.Join(cachePath(parent), name)}, parent.ID)
 	return nil
 }
 
@@ -408,14 +1020,37 @@ func (capi *CompatAPI) Rename(ctx context.Context, t *api.TreeNode, name string)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close() // nolint:errcheck
 	if resp.StatusCode >= 400 {
-		b, err := httputil.DumpResponse(resp, true)
-		if err != nil {
-			return err
-		}
-		fs.Debugf(capi, "move: got http %v: %s", resp.StatusCode, string(b))
-		return fmt.Errorf("move: got http %v", resp.StatusCode)
+		return ErrorFromResponse("rename", resp)
+	}
+	p := cachePath(t)
+	capi.invalidate([]string{p, path.Join(path.Dir(p), name)}, parentID(t))
+	return nil
+}
+
+// SetMetadata replaces the metadata of a treenode. Like Move, this only sends
+// the single field to patch.
+func (capi *CompatAPI) SetMetadata(ctx context.Context, t *api.TreeNode, metadata map[string]interface{}) error {
+	var (
+		payload = struct {
+			Metadata map[string]interface{} `json:"metadata"`
+		}{metadata}
+		buf bytes.Buffer
+	)
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return err
 	}
+	resp, err := capi.client.TreenodesPartialUpdateWithBody(
+		ctx, int(t.ID), "application/json", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode >= 400 {
+		return ErrorFromResponse("set metadata", resp)
+	}
+	capi.invalidate([]string{cachePath(t)}, parentID(t))
 	return nil
 }
 
@@ -466,14 +1101,11 @@ func (capi *CompatAPI) Move(ctx context.Context, t, newParent *api.TreeNode) err
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close() // nolint:errcheck
 	if resp.StatusCode >= 400 {
-		b, err := httputil.DumpResponse(resp, true)
-		if err != nil {
-			return err
-		}
-		fs.Debugf(capi, "move: got http %v: %s", resp.StatusCode, string(b))
-		return fmt.Errorf("move: got http %v", resp.StatusCode)
+		return ErrorFromResponse("move", resp)
 	}
+	capi.invalidate([]string{cachePath(t), path.Join(cachePath(newParent), t.Name)}, parentID(t), newParent.ID)
 	return nil
 }
 
@@ -482,57 +1114,100 @@ func (capi *CompatAPI) Remove(ctx context.Context, t *api.TreeNode) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close() // nolint:errcheck
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("remove: got http %v", resp.StatusCode)
+		return ErrorFromResponse("remove", resp)
 	}
+	capi.invalidate([]string{cachePath(t)}, parentID(t), t.ID)
 	return nil
 }
 
-func (capi *CompatAPI) List(t *api.TreeNode) (result []*api.TreeNode, err error) {
+func (capi *CompatAPI) List(ctx context.Context, t *api.TreeNode) (result []*api.TreeNode, err error) {
+	key := fmt.Sprintf("%d", t.ID)
+	if capi.persistentGet("list", key, &result) {
+		return result, nil
+	}
+	if result, ok := capi.prefetched.list(t.ID); ok {
+		return result, nil
+	}
 	// TODO: this was the previous implementation; below is the OAPI generated
 	// variant; to be used going forward
 	// result, err = capi.legacyAPI.List(t)
 	// TODO: legacyAPI had cache, which add noticable improvement
 	var (
-		ctx    = context.Background()
 		parent = int(t.ID)
-		limit  = 5000 // TODO: to match previous limit, may exceed some payload size
 		params = &TreenodesListParams{
 			Parent: &parent,
-			Limit:  &limit,
 		}
-		resp *TreenodesListResponse
 	)
-	if resp, err = capi.client.TreenodesListWithResponse(ctx, params); err != nil {
-		return nil, err
-	}
-	if resp.StatusCode() != 200 {
+	err = capi.ForEachTreenode(ctx, params, func(t *TreeNode) error {
+		result = append(result, toLegacyTreeNode(t))
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	return toLegacyTreeNodes(resp.JSON200.Results), nil
+	capi.persistentSet("list", key, result)
+	return result, nil
 }
 
-func (capi *CompatAPI) RegisterDeposit(ctx context.Context, rdr *api.RegisterDepositRequest) (id int64, err error) {
-	return 0, ErrObsolete
+// ForEachChild calls fn for each child of a treenode, page by page as they
+// arrive. Children already cached or prefetched are served from memory, but
+// unlike List, fetched pages are not cached, so large folders need not be
+// held in memory.
+func (capi *CompatAPI) ForEachChild(ctx context.Context, t *api.TreeNode, fn func(*api.TreeNode) error) error {
+	var cached []*api.TreeNode
+	ok := capi.persistentGet("list", fmt.Sprintf("%d", t.ID), &cached)
+	if !ok {
+		cached, ok = capi.prefetched.list(t.ID)
+	}
+	if ok {
+		for _, c := range cached {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	parent := int(t.ID)
+	return capi.ForEachTreenode(ctx, &TreenodesListParams{Parent: &parent}, func(t *TreeNode) error {
+		return fn(toLegacyTreeNode(t))
+	})
 }
 
-func (capi *CompatAPI) TreeNodeToCollection(t *api.TreeNode) (*api.Collection, error) {
-	return capi.legacyAPI.TreeNodeToCollection(t)
+// TreeNodeToCollection returns the collection for a collection treenode.
+func (capi *CompatAPI) TreeNodeToCollection(ctx context.Context, t *api.TreeNode) (*api.Collection, error) {
+	result, err := capi.FindCollections(ctx, url.Values{
+		"tree_node": []string{fmt.Sprintf("%d", t.ID)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("collection not found")
+	}
+	return result[0], nil
 }
 
-func (capi *CompatAPI) GetCollectionStats() (*api.CollectionStats, error) {
-	return capi.legacyAPI.GetCollectionStats()
+// GetCollectionStats returns file counts and sizes for all collections. The
+// "collections_stats" endpoint is not covered by the OpenAPI schema.
+func (capi *CompatAPI) GetCollectionStats(ctx context.Context) (*api.CollectionStats, error) {
+	var stats api.CollectionStats
+	if capi.persistentGet("stats", "collections", &stats) {
+		return &stats, nil
+	}
+	if err := capi.getJSON(ctx, "/collections_stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	capi.persistentSet("stats", "collections", &stats)
+	return &stats, nil
 }
 
 // FindCollections returns a list of collections, typically given a treenode identifier.
-func (capi *CompatAPI) FindCollections(vs url.Values) (result []*api.Collection, err error) {
+func (capi *CompatAPI) FindCollections(ctx context.Context, vs url.Values) (result []*api.Collection, err error) {
 	var (
-		ctx    = context.Background()
-		limit  = 5000 // TODO: switch to proper pagination
-		params = &CollectionsListParams{
-			Limit: &limit,
-		}
-		resp *CollectionsListResponse
+		params      = &CollectionsListParams{}
+		collections []Collection
 	)
 	for k, v := range vs {
 		switch k {
@@ -554,25 +1229,21 @@ func (capi *CompatAPI) FindCollections(vs url.Values) (result []*api.Collection,
 			return nil, fmt.Errorf("compat missing legacy parameters: %v", k)
 		}
 	}
-	if resp, err = capi.client.CollectionsListWithResponse(ctx, params); err != nil {
+	err = capi.ForEachCollection(ctx, params, func(c *Collection) error {
+		collections = append(collections, *c)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("collections: got http %v", resp.StatusCode())
-	}
-	return toLegacyCollection(resp.JSON200.Results), nil
+	return toLegacyCollection(&collections), nil
 }
 
 // FindTreeNodes returns a list of treenodes given query parameters. We only
 // deal with fields that we previously used. Anything else will fail noticably.
-func (capi *CompatAPI) FindTreeNodes(vs url.Values) (result []*api.TreeNode, err error) {
+func (capi *CompatAPI) FindTreeNodes(ctx context.Context, vs url.Values) (result []*api.TreeNode, err error) {
 	var (
-		ctx    = context.Background()
-		limit  = 5000 // TODO: to match previous limit, may exceed some payload size
-		params = &TreenodesListParams{
-			Limit: &limit,
-		}
-		resp *TreenodesListResponse
+		params = &TreenodesListParams{}
 	)
 	for k, v := range vs {
 		// We only ever used "parent" and "name" as parameter. If we use
@@ -605,31 +1276,50 @@ func (capi *CompatAPI) FindTreeNodes(vs url.Values) (result []*api.TreeNode, err
 			return nil, fmt.Errorf("compat missing legacy parameter: %v", k)
 		}
 	}
-	if resp, err = capi.client.TreenodesListWithResponse(ctx, params); err != nil {
+	err = capi.ForEachTreenode(ctx, params, func(t *TreeNode) error {
+		result = append(result, toLegacyTreeNode(t))
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("treenode: got http %v", resp.StatusCode())
-	}
-	result = toLegacyTreeNodes(resp.JSON200.Results)
 	return result, nil
 }
 
-// User returns the current user. This is an example of using the new API internally.
-func (capi *CompatAPI) User() (*api.User, error) {
+// RetrieveTreeNode fetches a single treenode by id, bypassing any cache.
+func (capi *CompatAPI) RetrieveTreeNode(ctx context.Context, id int64) (*api.TreeNode, error) {
+	resp, err := capi.client.TreenodesRetrieveWithResponse(ctx, int(id))
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode() {
+	case 200:
+		return toLegacyTreeNode(resp.JSON200), nil
+	case 404:
+		return nil, fs.ErrorObjectNotFound
+	default:
+		return nil, NewAPIError("treenode", resp.StatusCode(), resp.Body)
+	}
+}
+
+// User returns the current user. This is an example of using the new API
+// internally. With token authentication, the username may be omitted, in
+// which case we expect the API to only expose the token owner.
+func (capi *CompatAPI) User(ctx context.Context) (*api.User, error) {
 	// TODO: use cache
-	ctx := context.Background()
 	limit := 1
 	params := &UsersListParams{
-		Username: &capi.Username,
-		Limit:    &limit,
+		Limit: &limit,
+	}
+	if capi.Username != "" {
+		params.Username = &capi.Username
 	}
 	r, err := capi.client.UsersListWithResponse(ctx, params)
 	if err != nil {
 		return nil, err
 	}
 	if r.StatusCode() != 200 {
-		return nil, fmt.Errorf("user: got http %d", r.StatusCode())
+		return nil, NewAPIError("user", r.StatusCode(), r.Body)
 	}
 	if *r.JSON200.Count == 0 {
 		return nil, fmt.Errorf("user not found: %s", capi.Username)
@@ -637,25 +1327,74 @@ func (capi *CompatAPI) User() (*api.User, error) {
 	if *r.JSON200.Count > 1 {
 		return nil, fmt.Errorf("ambiguous query")
 	}
-	usr := (*r.JSON200.Results)[0]
-	return &api.User{
-		DateJoined:   usr.DateJoined.Format(time.RFC3339),
-		FirstName:    *usr.FirstName,
-		IsActive:     *usr.IsActive,
-		IsStaff:      *usr.IsStaff,
-		IsSuperuser:  *usr.IsSuperuser,
-		LastLogin:    usr.LastLogin.Format(time.RFC3339),
-		LastName:     *usr.LastName,
-		Organization: *usr.Organization,
-		URL:          *usr.Url,
-		Username:     usr.Username,
-	}, nil
+	return toLegacyUser(&(*r.JSON200.Results)[0]), nil
+}
+
+// Users returns all users visible to the current user, typically the users
+// of the organization.
+func (capi *CompatAPI) Users(ctx context.Context) (result []*api.User, err error) {
+	err = capi.ForEachUser(ctx, nil, func(u *User) error {
+		result = append(result, toLegacyUser(u))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetUserAccess replaces the authorized collections of a user and, if role
+// is not empty, the role. Like Move, this only sends the fields to patch.
+func (capi *CompatAPI) SetUserAccess(ctx context.Context, u *api.User, collections []string, role string) error {
+	var (
+		payload = struct {
+			AuthorizedCollections []string `json:"authorized_collections"`
+			Role                  string   `json:"role,omitempty"`
+		}{collections, role}
+		buf bytes.Buffer
+	)
+	if payload.AuthorizedCollections == nil {
+		payload.AuthorizedCollections = []string{}
+	}
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return err
+	}
+	resp, err := capi.client.UsersPartialUpdateWithBody(
+		ctx, int(u.Identifier()), "application/json", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode >= 400 {
+		return ErrorFromResponse("set user access", resp)
+	}
+	return nil
 }
 
-// Organization returns the organization of the current user.
-func (capi *CompatAPI) Organization() (*api.Organization, error) {
-	ctx := context.Background()
-	user, err := capi.User()
+// Organization returns the organization of the current user or the selected
+// organization, if one has been configured.
+func (capi *CompatAPI) Organization(ctx context.Context) (*api.Organization, error) {
+	if capi.organization != "" {
+		limit := 2
+		r, err := capi.client.OrganizationsListWithResponse(ctx, &OrganizationsListParams{
+			Name:  &capi.organization,
+			Limit: &limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if r.StatusCode() != 200 {
+			return nil, NewAPIError("organization", r.StatusCode(), r.Body)
+		}
+		switch {
+		case r.JSON200.Results == nil || len(*r.JSON200.Results) == 0:
+			return nil, fmt.Errorf("organization not found or not accessible: %v", capi.organization)
+		case len(*r.JSON200.Results) > 1:
+			return nil, fmt.Errorf("ambiguous query")
+		}
+		return toLegacyOrganization(&(*r.JSON200.Results)[0]), nil
+	}
+	user, err := capi.User(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -669,22 +1408,26 @@ func (capi *CompatAPI) Organization() (*api.Organization, error) {
 		return nil, err
 	}
 	if r.StatusCode() != 200 {
-		return nil, fmt.Errorf("error retrieving organization: %v", r.StatusCode())
-	}
-	org := r.JSON200
-	return &api.Organization{
-		Name:       org.Name,
-		Plan:       org.Plan,
-		QuotaBytes: *org.QuotaBytes,
-		TreeNode:   *org.TreeNode,
-		URL:        *org.Url,
-	}, nil
+		return nil, NewAPIError("organization", r.StatusCode(), r.Body)
+	}
+	return toLegacyOrganization(r.JSON200), nil
+}
+
+// Organizations returns all organizations accessible to the current user.
+func (capi *CompatAPI) Organizations(ctx context.Context) (result []*api.Organization, err error) {
+	err = capi.ForEachOrganization(ctx, nil, func(org *Organization) error {
+		result = append(result, toLegacyOrganization(org))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // Plan returns the plan of the current user.
-func (capi *CompatAPI) Plan() (*api.Plan, error) {
-	ctx := context.Background()
-	org, err := capi.Organization()
+func (capi *CompatAPI) Plan(ctx context.Context) (*api.Plan, error) {
+	org, err := capi.Organization(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -694,8 +1437,11 @@ func (capi *CompatAPI) Plan() (*api.Plan, error) {
 		return nil, err
 	}
 	r, err := capi.client.PlansRetrieveWithResponse(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	if r.StatusCode() != 200 {
-		return nil, fmt.Errorf("error retrieving plan: %v", r.StatusCode())
+		return nil, NewAPIError("plan", r.StatusCode(), r.Body)
 	}
 	return &api.Plan{
 		DefaultFixityFrequency: string(*r.JSON200.DefaultFixityFrequency),
@@ -709,8 +1455,11 @@ func (capi *CompatAPI) Plan() (*api.Plan, error) {
 }
 
 // root returns the organization treenode for the current API user.
-func (capi *CompatAPI) root() (*api.TreeNode, error) {
-	organization, err := capi.Organization()
+func (capi *CompatAPI) root(ctx context.Context) (*api.TreeNode, error) {
+	if v := capi.cache.GetGroup("root", "default"); v != nil {
+		return v.(*api.TreeNode), nil
+	}
+	organization, err := capi.Organization(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -718,12 +1467,16 @@ func (capi *CompatAPI) root() (*api.TreeNode, error) {
 	if err != nil {
 		return nil, err
 	}
-	ctx := context.Background()
 	resp, err := capi.client.TreenodesRetrieveWithResponse(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	return toLegacyTreeNode(resp.JSON200), nil
+	if resp.StatusCode() != 200 {
+		return nil, NewAPIError("root treenode", resp.StatusCode(), resp.Body)
+	}
+	t := toLegacyTreeNode(resp.JSON200)
+	capi.cache.SetGroup("root", "default", t)
+	return t, nil
 }
 
 // safeTimeFormat return a formatted time or the empty string.
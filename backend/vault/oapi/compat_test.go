@@ -1,6 +1,26 @@
 package oapi
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+)
 
 func TestSafeDereference(t *testing.T) {
 	var (
@@ -31,3 +51,733 @@ func TestSafeDereference(t *testing.T) {
 		}
 	}
 }
+
+func TestInterceptAPIKey(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("no request expected with token authentication, got %v", r.URL)
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	if err := capi.Login(); err != nil {
+		t.Fatalf("login with api key failed: %v", err)
+	}
+	req := httptest.NewRequest("POST", ts.URL+"/api/treenodes/", nil)
+	if err := capi.Intercept(context.Background(), req); err != nil {
+		t.Fatalf("intercept failed: %v", err)
+	}
+	var want = "Token abc"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestLoginJSON(t *testing.T) {
+	var cases = []struct {
+		about      string
+		jsonLogin  bool
+		wantMethod loginMethod
+	}{
+		{"json endpoint available", true, loginMethodJSON},
+		{"json endpoint missing, fallback to form", false, loginMethodForm},
+	}
+	for _, c := range cases {
+		t.Run(c.about, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/auth/login/", func(w http.ResponseWriter, r *http.Request) {
+				if !c.jsonLogin {
+					http.NotFound(w, r)
+					return
+				}
+				var payload struct {
+					Username string `json:"username"`
+					Password string `json:"password"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("invalid login payload: %v", err)
+				}
+				if payload.Username != "user" || payload.Password != "pass" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "s", Path: "/"})
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{}`))
+			})
+			mux.HandleFunc("/accounts/login/", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "GET" {
+					_, _ = w.Write([]byte(`<input type="hidden" name="csrfmiddlewaretoken" value="t">`))
+					return
+				}
+				http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "s", Path: "/"})
+			})
+			ts := httptest.NewServer(mux)
+			defer ts.Close()
+			capi, err := New(ts.URL+"/api", "user", "pass")
+			if err != nil {
+				t.Fatalf("could not setup client: %v", err)
+			}
+			if err := capi.Login(); err != nil {
+				t.Fatalf("login failed: %v", err)
+			}
+			if capi.loginMethod != c.wantMethod {
+				t.Fatalf("got %v, want %v", capi.loginMethod, c.wantMethod)
+			}
+		})
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sessionid", Value: "s", Path: "/"})
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	// Without the test server certificate, login must fail.
+	capi, err := New(ts.URL+"/api", "user", "pass")
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	if err := capi.Login(); err == nil {
+		t.Fatalf("expected certificate error")
+	}
+	capi, err = New(ts.URL+"/api", "user", "pass", WithTransport(ts.Client().Transport))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	if err := capi.Login(); err != nil {
+		t.Fatalf("login with custom transport failed: %v", err)
+	}
+}
+
+func TestWithOrganization(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/organizations/" {
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("name") != "other" {
+			_, _ = w.Write([]byte(`{"count": 0, "next": null, "previous": null, "results": []}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count": 1, "next": null, "previous": null, "results": [
+			{"name": "other", "plan": "/api/plans/1/", "quota_bytes": 1024, "tree_node": "http://vault/api/treenodes/7/"}]}`))
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithOrganization("other"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	org, err := capi.Organization(context.Background())
+	if err != nil {
+		t.Fatalf("organization failed: %v", err)
+	}
+	if org.Name != "other" || org.QuotaBytes != 1024 || org.TreeNodeIdentifier() != "7" {
+		t.Fatalf("got %v, want organization other", org)
+	}
+	capi, err = New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithOrganization("missing"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	if _, err := capi.Organization(context.Background()); err == nil {
+		t.Fatalf("expected error for inaccessible organization")
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/api/organizations/":
+			_, _ = w.Write([]byte(`{"count": 1, "results": [
+				{"name": "org", "plan": "", "tree_node": "http://vault/api/treenodes/1/"}]}`))
+		case r.URL.Path == "/api/treenodes/1/":
+			_, _ = w.Write([]byte(`{"id": 1, "name": "org", "node_type": "ORGANIZATION"}`))
+		case r.URL.Path == "/api/treenodes/" && q.Get("parent") == "1" && q.Get("name") == "c":
+			_, _ = w.Write([]byte(`{"count": 1, "results": [{"id": 2, "name": "c", "node_type": "COLLECTION"}]}`))
+		case r.URL.Path == "/api/treenodes/" && q.Get("parent") == "2" && q.Get("name") == "f":
+			_, _ = w.Write([]byte(`{"count": 1, "results": [{"id": 3, "name": "f", "node_type": "FILE"}]}`))
+		case r.URL.Path == "/api/treenodes/":
+			_, _ = w.Write([]byte(`{"count": 0, "results": []}`))
+		default:
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithOrganization("org"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	var cases = []struct {
+		p      string
+		id     int64
+		errNil bool
+	}{
+		{"/", 1, true},
+		{"/c", 2, true},
+		{"/c/", 2, true},
+		{"/c/f", 3, true},
+		{"/c/x", 0, false},
+	}
+	for _, c := range cases {
+		node, err := capi.ResolvePath(context.Background(), c.p)
+		if (err == nil) != c.errNil {
+			t.Fatalf("[%s] got err %v", c.p, err)
+		}
+		if err == nil && node.ID != c.id {
+			t.Fatalf("[%s] got %v, want %v", c.p, node.ID, c.id)
+		}
+	}
+}
+
+func TestDepositStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/deposit_status" || r.URL.Query().Get("deposit_id") != "42" {
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"total_files": 3, "in_storage_files": 2, "errored_files": 1}`))
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	ds, err := capi.DepositStatus(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("deposit status failed: %v", err)
+	}
+	if ds.TotalFiles != 3 || ds.InStorageFiles != 2 || ds.ErroredFiles != 1 {
+		t.Fatalf("got %+v", ds)
+	}
+}
+
+func TestPacerRetry(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"detail": "Request was throttled."}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"total_files": 1}`))
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	p := fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(time.Millisecond), pacer.MaxSleep(10*time.Millisecond)))
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithPacer(p))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	ds, err := capi.DepositStatus(ctx, 1)
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got: %v", err)
+	}
+	if calls != 3 || ds.TotalFiles != 1 {
+		t.Fatalf("got %d calls, %+v", calls, ds)
+	}
+}
+
+func TestPacerRetryPost(t *testing.T) {
+	var cases = []struct {
+		status     int
+		retryAfter string
+		calls      int
+	}{
+		{http.StatusServiceUnavailable, "", 1},
+		{http.StatusServiceUnavailable, "1", 2},
+		{http.StatusTooManyRequests, "", 2},
+	}
+	for _, c := range cases {
+		var calls int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				if c.retryAfter != "" {
+					w.Header().Set("Retry-After", c.retryAfter)
+				}
+				w.WriteHeader(c.status)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		ctx := context.Background()
+		p := fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(time.Millisecond), pacer.MaxSleep(10*time.Millisecond)))
+		capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithPacer(p))
+		if err != nil {
+			t.Fatalf("could not setup client: %v", err)
+		}
+		// The request has a body, which could be sent again, but after a
+		// plain 503 a deposit may have been registered already.
+		req, err := http.NewRequestWithContext(ctx, "POST", ts.URL+"/api/deposits/v2/register", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := capi.Do(req)
+		if err != nil {
+			t.Fatalf("expected the response, got: %v", err)
+		}
+		_ = resp.Body.Close()
+		ts.Close()
+		if calls != c.calls {
+			t.Errorf("[%d %q] got %d calls, want %d", c.status, c.retryAfter, calls, c.calls)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var cases = []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{"0", 0, 0},
+		{"-1", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, c := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		if c.header != "" {
+			resp.Header.Set("Retry-After", c.header)
+		}
+		if d := retryAfter(resp); d < c.min || d > c.max {
+			t.Errorf("retryAfter(%q) = %v, want between %v and %v", c.header, d, c.min, c.max)
+		}
+	}
+}
+
+func TestPacerRetryAfter(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"detail": "Maintenance."}`))
+	}))
+	defer ts.Close()
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.LowLevelRetries = 2
+	p := fs.NewPacer(ctx, pacer.NewDefault(pacer.MinSleep(time.Millisecond), pacer.MaxSleep(10*time.Millisecond)))
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithPacer(p))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	started := time.Now()
+	_, err = capi.DepositStatus(ctx, 1)
+	// The pacer waits for the server, not its own maximum sleep, and the
+	// caller gets the APIError with the delay, once retries are exhausted.
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("retried after %v, want Retry-After of 1s", elapsed)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got: %T %v", err, err)
+	}
+	if calls != 2 || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.RetryAfter != time.Second {
+		t.Fatalf("got %d calls, %+v", calls, apiErr)
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	var ids []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(RequestIDHeader))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"total_files": 1}`))
+	}))
+	defer ts.Close()
+	var buf bytes.Buffer
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithRequestLog(&buf))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := capi.DepositStatus(context.Background(), 1); err != nil {
+			t.Fatalf("deposit status failed: %v", err)
+		}
+	}
+	if len(ids) != 2 || ids[0] == "" || ids[0] == ids[1] {
+		t.Fatalf("expected distinct request ids, got %v", ids)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %s", len(lines), buf.String())
+	}
+	want := "req=" + ids[0] + " GET /api/deposit_status status=200"
+	if !strings.Contains(lines[0], want) {
+		t.Fatalf("got %q, want %q", lines[0], want)
+	}
+}
+
+func TestHTTPDump(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "sessionid=s3cr3t")
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte(`{}`))
+		case "/login":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"detail": "Invalid credentials."}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"detail": "Server error."}`))
+		}
+	}))
+	defer ts.Close()
+	for _, name := range []string{"dump.har", "dump.ndjson"} {
+		filename := filepath.Join(t.TempDir(), name)
+		d, err := NewHTTPDump(filename)
+		if err != nil {
+			t.Fatalf("could not create dump: %v", err)
+		}
+		capi, err := New(ts.URL+"/api", "", "", WithAPIKey("s3cr3t"), WithHTTPDump(d))
+		if err != nil {
+			t.Fatalf("could not setup client: %v", err)
+		}
+		for _, r := range []struct{ path, body string }{
+			{"/ok", ""},
+			{"/login", `{"username": "admin", "password": "s3cr3t"}`},
+			{"/chunk", ""},
+		} {
+			req, _ := http.NewRequest("POST", ts.URL+r.path, strings.NewReader(r.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Token s3cr3t")
+			resp, err := capi.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			// The body is still readable in full after recording.
+			b, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if len(b) == 0 {
+				t.Fatalf("%s: got empty body", r.path)
+			}
+		}
+		if err := d.Close(); err != nil {
+			t.Fatalf("close failed: %v", err)
+		}
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("could not read dump: %v", err)
+		}
+		if bytes.Contains(b, []byte("s3cr3t")) {
+			t.Fatalf("%s: credentials in dump: %s", name, b)
+		}
+		var entries []*harEntry
+		if filepath.Ext(name) == ".har" {
+			var doc harDocument
+			if err := json.Unmarshal(b, &doc); err != nil {
+				t.Fatalf("invalid har: %v", err)
+			}
+			entries = doc.Log.Entries
+		} else {
+			for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				var e harEntry
+				if err := json.Unmarshal([]byte(line), &e); err != nil {
+					t.Fatalf("invalid line %q: %v", line, err)
+				}
+				entries = append(entries, &e)
+			}
+		}
+		// Only the failed requests are recorded.
+		if len(entries) != 2 || entries[0].Response.Status != 400 || entries[1].Response.Status != 500 {
+			t.Fatalf("%s: got %d entries: %s", name, len(entries), b)
+		}
+		if got, want := entries[0].Request.PostData.Text, `{"username": "admin", "password": "REDACTED"}`; got != want {
+			t.Errorf("%s: got request body %q, want %q", name, got, want)
+		}
+		if got, want := entries[1].Response.Content.Text, `{"detail": "Server error."}`; got != want {
+			t.Errorf("%s: got response body %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDumpBody(t *testing.T) {
+	var cases = []struct {
+		mimeType string
+		body     string
+		want     string
+	}{
+		{"application/json", `{"password":"x\"y","a":1}`, `{"password":"REDACTED","a":1}`},
+		{"application/x-www-form-urlencoded", "username=a&password=b&next=/", "username=a&password=REDACTED&next=/"},
+		{"multipart/form-data; boundary=x", "--x...", "[multipart/form-data body of 1024 bytes omitted]"},
+		{"text/html; charset=utf-8", "<p>error</p>", "<p>error</p>"},
+	}
+	for _, c := range cases {
+		if got := dumpBody(c.mimeType, []byte(c.body), 1024); got != c.want {
+			t.Errorf("dumpBody(%q) = %q, want %q", c.body, got, c.want)
+		}
+	}
+}
+
+func TestResolvePathSingleflight(t *testing.T) {
+	var (
+		lookups int32
+		release = make(chan struct{})
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/api/organizations/":
+			_, _ = w.Write([]byte(`{"count": 1, "results": [
+				{"name": "org", "plan": "", "tree_node": "http://vault/api/treenodes/1/"}]}`))
+		case r.URL.Path == "/api/treenodes/1/":
+			_, _ = w.Write([]byte(`{"id": 1, "name": "org", "node_type": "ORGANIZATION"}`))
+		case r.URL.Path == "/api/treenodes/" && q.Get("parent") == "1" && q.Get("name") == "c":
+			atomic.AddInt32(&lookups, 1)
+			<-release
+			_, _ = w.Write([]byte(`{"count": 1, "results": [{"id": 2, "name": "c", "node_type": "COLLECTION"}]}`))
+		default:
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithOrganization("org"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	if _, err := capi.ResolvePath(context.Background(), "/"); err != nil {
+		t.Fatalf("could not resolve root: %v", err)
+	}
+	// The caller starting the lookup gives up, the others still get the
+	// result.
+	var (
+		wg          sync.WaitGroup
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := capi.ResolvePath(ctx, "/c"); !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+	}()
+	for atomic.LoadInt32(&lookups) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node, err := capi.ResolvePath(context.Background(), "/c")
+			if err != nil || node.ID != 2 {
+				t.Errorf("got %v, %v", node, err)
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&lookups); n != 1 {
+		t.Fatalf("got %d lookups, want 1", n)
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/api/organizations/":
+			_, _ = w.Write([]byte(`{"count": 1, "results": [
+				{"name": "org", "plan": "", "tree_node": "http://vault/api/treenodes/1/"}]}`))
+		case r.URL.Path == "/api/treenodes/1/":
+			_, _ = w.Write([]byte(`{"id": 1, "name": "org", "node_type": "ORGANIZATION"}`))
+		case r.URL.Path == "/api/treenodes/":
+			queries = append(queries, q.Get("parent")+":"+q.Get("name")+q.Get("name__in"))
+			var results []string
+			switch q.Get("parent") {
+			case "1":
+				results = append(results, `{"id": 2, "name": "c", "node_type": "COLLECTION"}`)
+			case "2":
+				results = append(results,
+					`{"id": 3, "name": "a", "node_type": "FOLDER"}`,
+					`{"id": 4, "name": "b", "node_type": "FOLDER"}`)
+			case "3":
+				results = append(results,
+					`{"id": 5, "name": "x", "node_type": "FILE"}`,
+					`{"id": 6, "name": "y", "node_type": "FILE"}`)
+			}
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"count": %d, "results": [%s]}`, len(results), strings.Join(results, ","))))
+		default:
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithOrganization("org"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	paths := []string{"/c/a/x", "/c/a/y/", "/c/b", "/c/missing/z", "/"}
+	nodes, err := capi.ResolvePaths(context.Background(), paths)
+	if err != nil {
+		t.Fatalf("resolve paths failed: %v", err)
+	}
+	var got []string
+	for _, p := range paths {
+		if n := nodes[p]; n != nil {
+			got = append(got, fmt.Sprintf("%s=%d", p, n.ID))
+		}
+	}
+	if want := "/c/a/x=5 /c/a/y/=6 /c/b=4 /=1"; strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %v", strings.Join(got, " "), want)
+	}
+	// One query per parent: the missing folder has no children to look for.
+	if want := "1:c 2:a,b,missing 3:x,y"; strings.Join(queries, " ") != want {
+		t.Errorf("got queries %v, want %v", strings.Join(queries, " "), want)
+	}
+}
+
+func TestVersionContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if v := capi.Version(ctx); v != "" {
+		t.Fatalf("got version %q, want none", v)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("version took %v, expected to give up with the context", elapsed)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	if got := UserAgent(" "); got != VaultRcloneUserAgentString {
+		t.Errorf("got %q, want %q", got, VaultRcloneUserAgentString)
+	}
+	if got, want := UserAgent("ACME/ingest"), VaultRcloneUserAgentString+" ACME/ingest"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/api/organizations/":
+			_, _ = w.Write([]byte(`{"count": 1, "results": [
+				{"name": "org", "plan": "", "tree_node": "http://vault/api/treenodes/1/"}]}`))
+		case r.URL.Path == "/api/treenodes/1/":
+			_, _ = w.Write([]byte(`{"id": 1, "name": "org", "node_type": "ORGANIZATION", "path": "/org"}`))
+		case r.URL.Path == "/api/treenodes/":
+			queries = append(queries, r.URL.RawQuery)
+			switch {
+			case q.Get("parent") == "1" && q.Get("name") == "c":
+				_, _ = w.Write([]byte(`{"count": 1, "results": [
+					{"id": 2, "name": "c", "node_type": "COLLECTION", "path": "/org/c", "parent": "http://vault/api/treenodes/1/"}]}`))
+			case q.Get("path__startswith") == "/org/c/":
+				_, _ = w.Write([]byte(`{"count": 5, "results": [
+					{"id": 3, "name": "a", "node_type": "FOLDER", "path": "/org/c/a", "parent": "http://vault/api/treenodes/2/"},
+					{"id": 4, "name": "x", "node_type": "FILE", "path": "/org/c/a/x", "parent": "http://vault/api/treenodes/3/"},
+					{"id": 5, "name": "e", "node_type": "FOLDER", "path": "/org/c/e", "parent": "http://vault/api/treenodes/2/"},
+					{"id": 6, "name": "v", "node_type": "FILE", "path": "/org/c/v", "parent": "http://vault/api/treenodes/2/"},
+					{"id": 7, "name": "v", "node_type": "FILE", "path": "/org/c/v", "parent": "http://vault/api/treenodes/2/"}]}`))
+			case q.Get("parent") == "2" && q.Get("name") == "v":
+				_, _ = w.Write([]byte(`{"count": 0, "results": []}`))
+			default:
+				t.Errorf("unexpected query: %v", r.URL)
+				_, _ = w.Write([]byte(`{"count": 0, "results": []}`))
+			}
+		default:
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"), WithOrganization("org"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	ctx := context.Background()
+	n, err := capi.Prefetch(ctx, "/c")
+	if err != nil {
+		t.Fatalf("prefetch failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("got %d prefetched treenodes, want 3", n)
+	}
+	queries = nil
+	var cases = []struct {
+		p  string
+		id int64
+	}{
+		{"/c", 2},
+		{"/c/a/", 3},
+		{"/c/a/x", 4},
+		{"/c/a/missing", 0},
+		{"/c/missing/x", 0},
+	}
+	for _, c := range cases {
+		node, err := capi.ResolvePath(ctx, c.p)
+		switch {
+		case c.id == 0 && err != fs.ErrorObjectNotFound:
+			t.Errorf("[%s] got %v, %v, want not found", c.p, node, err)
+		case c.id != 0 && (err != nil || node.ID != c.id):
+			t.Errorf("[%s] got %v, %v, want %d", c.p, node, err, c.id)
+		}
+	}
+	children, err := capi.List(ctx, &api.TreeNode{ID: 2})
+	if err != nil || len(children) != 4 {
+		t.Errorf("got %d children, %v, want 4", len(children), err)
+	}
+	children, err = capi.List(ctx, &api.TreeNode{ID: 5})
+	if err != nil || len(children) != 0 {
+		t.Errorf("got %d children of empty folder, %v", len(children), err)
+	}
+	if len(queries) != 0 {
+		t.Errorf("got queries %v, want none", queries)
+	}
+	// Versions of a file with the same name are left to the api.
+	if _, err := capi.ResolvePath(ctx, "/c/v"); err != fs.ErrorObjectNotFound || len(queries) == 0 {
+		t.Errorf("got %v after queries %v", err, queries)
+	}
+	// A change drops the changed treenode and the listing of its parent only.
+	capi.prefetched.evict([]string{"/c/a"}, 2)
+	for p, want := range map[string]bool{"/c/a": false, "/c/a/x": false, "/c/e": true, "/c/missing": false} {
+		if _, ok := capi.prefetched.resolve(p); ok != want {
+			t.Errorf("[%s] got prefetched %v, want %v", p, ok, want)
+		}
+	}
+	if _, ok := capi.prefetched.list(5); !ok {
+		t.Errorf("listing of unchanged folder dropped")
+	}
+	// A deposit drops all prefetched treenodes.
+	capi.InvalidateCache()
+	if _, ok := capi.prefetched.resolve("/c/e"); ok {
+		t.Errorf("prefetched treenodes kept after a deposit")
+	}
+}
@@ -0,0 +1,133 @@
+package oapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// csrfTokenTTL is how long a CSRF token is reused, before we fetch a new one.
+// Django rotates the token on login only, so this is just a safety net.
+const csrfTokenTTL = 1 * time.Hour
+
+// csrfState caches the CSRF token for the current session.
+type csrfState struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// csrfToken returns a cached CSRF token or fetches a new one.
+func (capi *CompatAPI) csrfToken(ctx context.Context) (string, error) {
+	capi.csrf.mu.Lock()
+	defer capi.csrf.mu.Unlock()
+	if capi.csrf.token != "" && time.Now().Before(capi.csrf.expires) {
+		return capi.csrf.token, nil
+	}
+	token, err := capi.fetchCSRFToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	capi.csrf.token = token
+	capi.csrf.expires = time.Now().Add(csrfTokenTTL)
+	return token, nil
+}
+
+// invalidateCSRFToken drops the cached token, e.g. on login or after the
+// server rejected it.
+func (capi *CompatAPI) invalidateCSRFToken() {
+	capi.csrf.mu.Lock()
+	capi.csrf.token = ""
+	capi.csrf.mu.Unlock()
+}
+
+// setCSRFToken caches a known token, e.g. from a resumed session. An empty
+// token is fetched again on the next request.
+func (capi *CompatAPI) setCSRFToken(token string) {
+	capi.csrf.mu.Lock()
+	capi.csrf.token = token
+	capi.csrf.expires = time.Now().Add(csrfTokenTTL)
+	capi.csrf.mu.Unlock()
+}
+
+// fetchCSRFToken parses a CSRF token from the HTML version of the API root.
+func (capi *CompatAPI) fetchCSRFToken(ctx context.Context) (string, error) {
+	// previously, we used api/collections or api/users, etc - but we don't get
+	// any HTML back from resource endpoints; but just .../api works
+	fs.Debugf(capi, "fetching CSRF token from %v", capi.Endpoint)
+	r, err := http.NewRequestWithContext(ctx, "GET", capi.Endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	r.Header.Set("Accept", "text/html")
+	r.Header.Set("User-Agent", capi.userAgent)
+	resp, err := capi.Do(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("intercept link at %s failed with: %d", capi.Endpoint, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return "", err
+	}
+	if matches := capi.csrfTokenPattern.FindStringSubmatch(string(b)); len(matches) == 2 {
+		return matches[1], nil
+	}
+	return "", ErrMissingCSRFToken
+}
+
+// isSafeMethod returns true for methods that do not require a CSRF token.
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// csrfRetryDoer retries a request once with a fresh CSRF token, if the server
+// rejected the cached one.
+type csrfRetryDoer struct {
+	capi *CompatAPI
+}
+
+// Do performs the request.
+func (d *csrfRetryDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.capi.Do(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden || !d.capi.usesSession() ||
+		isSafeMethod(req.Method) || (req.GetBody == nil && req.Body != nil) {
+		return resp, err
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	if !bytes.Contains(b, []byte("CSRF")) {
+		return resp, nil
+	}
+	fs.Debugf(d.capi, "CSRF token rejected, retrying with a new token")
+	d.capi.invalidateCSRFToken()
+	token, err := d.capi.csrfToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("X-CSRFTOKEN", token)
+	return d.capi.Do(retry)
+}
@@ -0,0 +1,64 @@
+package oapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFTokenCache(t *testing.T) {
+	var (
+		fetches int
+		valid   = "t1"
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_, _ = fmt.Fprintf(w, `<script>csrfToken: "t%d"</script>`, fetches)
+	})
+	mux.HandleFunc("/api/collections/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-CSRFTOKEN") != valid {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"detail": "CSRF Failed: CSRF token missing or incorrect."}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"name": "c"}`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "user", "pass")
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := capi.CreateCollection(ctx, "c"); err != nil {
+			t.Fatalf("create collection failed: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("got %d token fetches, want 1", fetches)
+	}
+	// Server rotates the token, we expect a single refetch and retry.
+	valid = "t2"
+	if err := capi.CreateCollection(ctx, "c"); err != nil {
+		t.Fatalf("create collection after token rotation failed: %v", err)
+	}
+	if fetches != 2 {
+		t.Fatalf("got %d token fetches, want 2", fetches)
+	}
+	// A resumed session brings its token along.
+	if err := capi.ResumeSession(&Session{CSRFToken: "t2"}); err != nil {
+		t.Fatalf("resume session failed: %v", err)
+	}
+	if err := capi.CreateCollection(ctx, "c"); err != nil {
+		t.Fatalf("create collection after resume failed: %v", err)
+	}
+	if fetches != 2 {
+		t.Fatalf("got %d token fetches after resume, want 2", fetches)
+	}
+}
@@ -0,0 +1,126 @@
+package oapi
+
+// The deposit_status endpoint is not part of schema.json, which is taken
+// as-is from vault-site. This file is written by hand, but follows the
+// structure of the generated code, so it can be dropped once the endpoint is
+// in the schema.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DepositStatus defines model for DepositStatus.
+type DepositStatus struct {
+	AssembledFiles int64 `json:"assembled_files"`
+	ErroredFiles   int64 `json:"errored_files"`
+	FileQueue      int64 `json:"file_queue"`
+	InStorageFiles int64 `json:"in_storage_files"`
+	TotalFiles     int64 `json:"total_files"`
+	UploadedFiles  int64 `json:"uploaded_files"`
+}
+
+// DepositStatusParams defines parameters for DepositStatus.
+type DepositStatusParams struct {
+	DepositId int64 `form:"deposit_id" json:"deposit_id"`
+}
+
+// NewDepositStatusRequest generates requests for DepositStatus
+func NewDepositStatusRequest(server string, params *DepositStatusParams) (*http.Request, error) {
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	queryURL, err := serverURL.Parse("./api/deposit_status")
+	if err != nil {
+		return nil, err
+	}
+	if params != nil {
+		queryValues := queryURL.Query()
+		queryValues.Set("deposit_id", fmt.Sprintf("%d", params.DepositId))
+		queryURL.RawQuery = queryValues.Encode()
+	}
+	return http.NewRequest("GET", queryURL.String(), nil)
+}
+
+// depositStatusClient is implemented by Client; ClientInterface is generated
+// and does not include DepositStatus.
+type depositStatusClient interface {
+	DepositStatus(ctx context.Context, params *DepositStatusParams, reqEditors ...RequestEditorFn) (*http.Response, error)
+}
+
+// DepositStatus requests the status of a deposit.
+func (c *Client) DepositStatus(ctx context.Context, params *DepositStatusParams, reqEditors ...RequestEditorFn) (*http.Response, error) {
+	req, err := NewDepositStatusRequest(c.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if err := c.applyEditors(ctx, req, reqEditors); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// DepositStatusResponse wraps the response of DepositStatus.
+type DepositStatusResponse struct {
+	Body         []byte
+	HTTPResponse *http.Response
+	JSON200      *DepositStatus
+}
+
+// Status returns HTTPResponse.Status
+func (r DepositStatusResponse) Status() string {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.Status
+	}
+	return http.StatusText(0)
+}
+
+// StatusCode returns HTTPResponse.StatusCode
+func (r DepositStatusResponse) StatusCode() int {
+	if r.HTTPResponse != nil {
+		return r.HTTPResponse.StatusCode
+	}
+	return 0
+}
+
+// DepositStatusWithResponse request returning *DepositStatusResponse
+func (c *ClientWithResponses) DepositStatusWithResponse(ctx context.Context, params *DepositStatusParams, reqEditors ...RequestEditorFn) (*DepositStatusResponse, error) {
+	dc, ok := c.ClientInterface.(depositStatusClient)
+	if !ok {
+		return nil, fmt.Errorf("client does not support deposit status")
+	}
+	rsp, err := dc.DepositStatus(ctx, params, reqEditors...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDepositStatusResponse(rsp)
+}
+
+// ParseDepositStatusResponse parses an HTTP response from a DepositStatusWithResponse call
+func ParseDepositStatusResponse(rsp *http.Response) (*DepositStatusResponse, error) {
+	bodyBytes, err := io.ReadAll(rsp.Body)
+	defer func() { _ = rsp.Body.Close() }()
+	if err != nil {
+		return nil, err
+	}
+	response := &DepositStatusResponse{
+		Body:         bodyBytes,
+		HTTPResponse: rsp,
+	}
+	switch {
+	case strings.Contains(rsp.Header.Get("Content-Type"), "json") && rsp.StatusCode == 200:
+		var dest DepositStatus
+		if err := json.Unmarshal(bodyBytes, &dest); err != nil {
+			return nil, err
+		}
+		response.JSON200 = &dest
+	}
+	return response, nil
+}
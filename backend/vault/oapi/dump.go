@@ -0,0 +1,294 @@
+package oapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// maxDumpBody limits the bytes of a request or response body in a dump.
+const maxDumpBody = 64 << 10
+
+// redactedHeaders carry credentials and are never dumped.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Csrftoken":         true,
+}
+
+// Patterns of password fields in JSON and form encoded bodies.
+var (
+	jsonPasswordPattern = regexp.MustCompile(`("password"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	formPasswordPattern = regexp.MustCompile(`((?:^|&)password=)[^&]*`)
+)
+
+// HTTPDump records failed requests and their responses, with credentials
+// removed, e.g. for a support request. A file ending in ".har" is written in
+// the HTTP Archive format, which browsers and many tools can open; other
+// files get one JSON entry per line.
+type HTTPDump struct {
+	mu      sync.Mutex
+	f       *os.File
+	har     bool
+	entries []*harEntry // all entries so far, as HAR is a single document
+}
+
+// NewHTTPDump creates or truncates the dump file.
+func NewHTTPDump(filename string) (*HTTPDump, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPDump{f: f, har: strings.EqualFold(filepath.Ext(filename), ".har")}, nil
+}
+
+// WithHTTPDump records all failed requests, i.e. those with an error or an
+// HTTP status of 400 or above, in the dump.
+func WithHTTPDump(d *HTTPDump) Option {
+	return func(capi *CompatAPI) {
+		capi.httpDump = d
+	}
+}
+
+// Close closes the dump file.
+func (d *HTTPDump) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.f.Close()
+}
+
+// record adds a failed request to the dump. The start of the response body
+// is read and put back in front of the rest, so the caller can still read
+// all of it.
+func (d *HTTPDump) record(req *http.Request, resp *http.Response, err error, started time.Time, elapsed time.Duration) error {
+	e := &harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            float64(elapsed) / float64(time.Millisecond),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header),
+			QueryString: harQuery(req.URL.Query()),
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+		Timings: harTimings{Send: 0, Wait: float64(elapsed) / float64(time.Millisecond), Receive: 0},
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(io.LimitReader(body, maxDumpBody))
+			_ = body.Close()
+			mimeType := req.Header.Get("Content-Type")
+			e.Request.PostData = &harPostData{MimeType: mimeType, Text: dumpBody(mimeType, b, req.ContentLength)}
+		}
+	}
+	if err != nil {
+		e.Error = err.Error()
+		e.Response = harResponse{
+			Headers:     []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+	} else {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxDumpBody))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), resp.Body), resp.Body}
+		mimeType := resp.Header.Get("Content-Type")
+		e.Response = harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Headers:     harHeaders(resp.Header),
+			Cookies:     []harNameValue{},
+			Content: harContent{
+				Size:     resp.ContentLength,
+				MimeType: mimeType,
+				Text:     dumpBody(mimeType, b, resp.ContentLength),
+			},
+			HeadersSize: -1,
+			BodySize:    resp.ContentLength,
+		}
+	}
+	return d.write(e)
+}
+
+// write appends an entry to the file; a HAR document is written again as a
+// whole, which is fine for the few failed requests.
+func (d *HTTPDump) write(e *harEntry) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.har {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = d.f.Write(append(b, '\n'))
+		return err
+	}
+	d.entries = append(d.entries, e)
+	doc := harDocument{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "rclone", Version: fs.Version},
+		Entries: d.entries,
+	}}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := d.f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = d.f.WriteAt(b, 0)
+	return err
+}
+
+// dumpBody returns a text body with passwords removed and a placeholder for
+// binary bodies, like uploaded chunks, which are of no use in a dump.
+func dumpBody(mimeType string, b []byte, size int64) string {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch {
+	case len(b) == 0:
+		return ""
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "json"),
+		mediaType == "application/x-www-form-urlencoded", mediaType == "":
+	default:
+		if size < 0 {
+			size = int64(len(b))
+		}
+		return fmt.Sprintf("[%s body of %d bytes omitted]", mediaType, size)
+	}
+	s := jsonPasswordPattern.ReplaceAllString(string(b), `$1"REDACTED"`)
+	s = formPasswordPattern.ReplaceAllString(s, `${1}REDACTED`)
+	if len(b) == maxDumpBody {
+		s += "[...]"
+	}
+	return s
+}
+
+// harHeaders returns the headers sorted by name, with credentials redacted.
+func harHeaders(h http.Header) []harNameValue {
+	result := []harNameValue{}
+	for _, k := range sortedKeys(h) {
+		for _, v := range h[k] {
+			if redactedHeaders[http.CanonicalHeaderKey(k)] {
+				v = "REDACTED"
+			}
+			result = append(result, harNameValue{Name: k, Value: v})
+		}
+	}
+	return result
+}
+
+// harQuery returns the query parameters sorted by name.
+func harQuery(q url.Values) []harNameValue {
+	result := []harNameValue{}
+	for _, k := range sortedKeys(q) {
+		for _, v := range q[k] {
+			result = append(result, harNameValue{Name: k, Value: v})
+		}
+	}
+	return result
+}
+
+// sortedKeys returns the keys of headers or query values, sorted.
+func sortedKeys(m map[string][]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The subset of HAR 1.2 written, see http://www.softwareishard.com/blog/har-12-spec/.
+
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"` // transport error, if any
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
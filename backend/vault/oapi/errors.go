@@ -0,0 +1,155 @@
+package oapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// maxErrorDetail limits the length of a non-JSON response body in an error.
+const maxErrorDetail = 256
+
+// ErrQuotaExhausted matches api errors about an exhausted storage quota.
+var ErrQuotaExhausted = errors.New("quota exhausted")
+
+// APIError is a structured error response. Vault uses Django REST Framework
+// (DRF), which responds with a {"detail": ...} object, an object with field
+// errors, like {"name": ["This field is required."]}, or a list of messages.
+// The deposits API responds with a {"code": ..., "message": ...} object.
+type APIError struct {
+	Op         string              // operation, e.g. "create folder"
+	StatusCode int                 // HTTP status code
+	Code       string              // error code, if any, e.g. "QUOTA_EXHAUSTED"
+	Detail     string              // general error message
+	Fields     map[string][]string // messages per offending field
+	RetryAfter time.Duration       // delay requested by a Retry-After header, if any
+}
+
+// Error returns a single line with all details.
+func (e *APIError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: got http %d", e.Op, e.StatusCode)
+	if e.Code != "" {
+		fmt.Fprintf(&sb, " (%s)", e.Code)
+	}
+	if e.Detail != "" {
+		fmt.Fprintf(&sb, ": %s", e.Detail)
+	}
+	var keys []string
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "; %s: %s", k, strings.Join(e.Fields[k], " "))
+	}
+	return sb.String()
+}
+
+// Is maps an APIError to the canonical rclone errors, so that errors.Is works
+// with fs.ErrorPermissionDenied, fs.ErrorObjectNotFound and
+// ErrQuotaExhausted.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case fs.ErrorPermissionDenied:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case fs.ErrorObjectNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrQuotaExhausted:
+		return e.quotaExhausted()
+	}
+	return false
+}
+
+// NoRetry returns true for client errors, which will fail again, if the
+// whole operation is retried; rate limits and timeouts are retried.
+func (e *APIError) NoRetry() bool {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests:
+		return false
+	default:
+		return e.StatusCode >= 400 && e.StatusCode < 500
+	}
+}
+
+// Fatal returns true, if the quota is exhausted, as no further upload will
+// succeed.
+func (e *APIError) Fatal() bool {
+	return e.quotaExhausted()
+}
+
+// quotaExhausted returns true, if the error reports an exhausted quota.
+func (e *APIError) quotaExhausted() bool {
+	return e.StatusCode == http.StatusInsufficientStorage || strings.Contains(strings.ToUpper(e.Code), "QUOTA")
+}
+
+// NewAPIError parses a response body into an APIError. Bodies that are not
+// understood are included in the detail, unless they look like HTML.
+func NewAPIError(op string, statusCode int, body []byte) *APIError {
+	e := &APIError{Op: op, StatusCode: statusCode}
+	var (
+		obj  map[string]json.RawMessage
+		list []string
+	)
+	switch {
+	case json.Unmarshal(body, &obj) == nil:
+		for k, v := range obj {
+			switch k {
+			case "detail", "message":
+				e.Detail = jsonMessages(v)
+			case "code":
+				e.Code = jsonMessages(v)
+			default:
+				if e.Fields == nil {
+					e.Fields = make(map[string][]string)
+				}
+				e.Fields[k] = append(e.Fields[k], jsonMessages(v))
+			}
+		}
+	case json.Unmarshal(body, &list) == nil:
+		e.Detail = strings.Join(list, " ")
+	default:
+		s := strings.TrimSpace(string(body))
+		if strings.HasPrefix(s, "<") {
+			break
+		}
+		if len(s) > maxErrorDetail {
+			s = s[:maxErrorDetail] + "..."
+		}
+		e.Detail = s
+	}
+	return e
+}
+
+// ErrorFromResponse reads the body of a response into an APIError, with the
+// delay of a Retry-After header. The caller is still responsible for closing
+// the body.
+func ErrorFromResponse(op string, resp *http.Response) *APIError {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	e := NewAPIError(op, resp.StatusCode, b)
+	e.RetryAfter = retryAfter(resp)
+	return e
+}
+
+// jsonMessages flattens a string, a list of strings or any other JSON value
+// into a single message.
+func jsonMessages(v json.RawMessage) string {
+	var (
+		s    string
+		list []string
+	)
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	if json.Unmarshal(v, &list) == nil {
+		return strings.Join(list, " ")
+	}
+	return string(v)
+}
@@ -0,0 +1,68 @@
+package oapi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+)
+
+func TestNewAPIError(t *testing.T) {
+	var cases = []struct {
+		about  string
+		status int
+		body   string
+		want   string
+	}{
+		{"detail", 404, `{"detail": "Not found."}`, "op: got http 404: Not found."},
+		{"fields", 400, `{"name": ["This field is required."], "parent": ["Invalid hyperlink."]}`,
+			"op: got http 400; name: This field is required.; parent: Invalid hyperlink."},
+		{"list", 400, `["Name clash."]`, "op: got http 400: Name clash."},
+		{"deposits", 400, `{"code": "QUOTA_EXHAUSTED", "message": "quota exhausted"}`,
+			"op: got http 400 (QUOTA_EXHAUSTED): quota exhausted"},
+		{"html", 500, `<html><body>Server Error</body></html>`, "op: got http 500"},
+		{"text", 502, `Bad Gateway`, "op: got http 502: Bad Gateway"},
+		{"empty", 403, ``, "op: got http 403"},
+	}
+	for _, c := range cases {
+		err := NewAPIError("op", c.status, []byte(c.body))
+		if got := err.Error(); got != c.want {
+			t.Errorf("[%s] got %q, want %q", c.about, got, c.want)
+		}
+	}
+}
+
+func TestAPIErrorMapping(t *testing.T) {
+	var cases = []struct {
+		status  int
+		body    string
+		target  error
+		noRetry bool
+		fatal   bool
+	}{
+		{401, `{"detail": "Invalid token."}`, fs.ErrorPermissionDenied, true, false},
+		{403, `{"detail": "Forbidden."}`, fs.ErrorPermissionDenied, true, false},
+		{404, `{"detail": "Not found."}`, fs.ErrorObjectNotFound, true, false},
+		{400, `{"code": "QUOTA_EXHAUSTED", "message": "quota exhausted"}`, ErrQuotaExhausted, true, true},
+		{507, ``, ErrQuotaExhausted, false, true},
+		{429, ``, nil, false, false},
+		{500, ``, nil, false, false},
+	}
+	for _, c := range cases {
+		err := fmt.Errorf("wrapped: %w", NewAPIError("op", c.status, []byte(c.body)))
+		if c.target != nil && !errors.Is(err, c.target) {
+			t.Errorf("[%d] got %v, want %v", c.status, err, c.target)
+		}
+		if c.target == nil && (errors.Is(err, fs.ErrorPermissionDenied) || errors.Is(err, fs.ErrorObjectNotFound)) {
+			t.Errorf("[%d] unexpected mapping: %v", c.status, err)
+		}
+		if got := fserrors.IsNoRetryError(err); got != c.noRetry {
+			t.Errorf("[%d] got no retry %v, want %v", c.status, got, c.noRetry)
+		}
+		if got := fserrors.IsFatalError(err); got != c.fatal {
+			t.Errorf("[%d] got fatal %v, want %v", c.status, got, c.fatal)
+		}
+	}
+}
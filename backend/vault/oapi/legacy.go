@@ -105,3 +105,151 @@ func toLegacyCollection(vs *[]Collection) (result []*api.Collection) {
 	}
 	return
 }
+
+// toLegacyCollectionSummary turns an open api CollectionSummary into a
+// legacy CollectionSummary.
+func toLegacyCollectionSummary(c *CollectionSummary) *api.CollectionSummary {
+	result := &api.CollectionSummary{
+		Name:            c.Name,
+		FixityFrequency: string(c.FixityFrequency),
+		SizeBytes:       int64(c.SizeBytes),
+	}
+	for _, l := range c.TargetReplicaLocations {
+		result.TargetReplicaLocations = append(result.TargetReplicaLocations, &api.ReplicaLocation{
+			Abbreviation:      l.Abbreviation,
+			DisplayName:       l.DisplayName,
+			NumCopies:         int64(l.NumCopies),
+			PhysicalLocation:  l.PhysicalLocation,
+			SystemDescription: l.SystemDescription,
+		})
+	}
+	return result
+}
+
+// toLegacyOrganization turns an open api Organization into a legacy
+// Organization.
+func toLegacyOrganization(org *Organization) *api.Organization {
+	result := &api.Organization{
+		Name: org.Name,
+		Plan: org.Plan,
+	}
+	if v := safeDereference(org.QuotaBytes); v != nil {
+		result.QuotaBytes = v.(int64)
+	}
+	if v := safeDereference(org.TreeNode); v != nil {
+		result.TreeNode = v.(string)
+	}
+	if v := safeDereference(org.Url); v != nil {
+		result.URL = v.(string)
+	}
+	return result
+}
+
+// toLegacyDeposit turns an open api Deposit into a legacy Deposit.
+func toLegacyDeposit(d *Deposit) *api.Deposit {
+	result := &api.Deposit{
+		ParentNode:   d.ParentNode,
+		RegisteredAt: safeTimeFormat(d.RegisteredAt, time.RFC3339),
+		UploadedAt:   safeTimeFormat(d.UploadedAt, time.RFC3339),
+		HashedAt:     safeTimeFormat(d.HashedAt, time.RFC3339),
+		ReplicatedAt: safeTimeFormat(d.ReplicatedAt, time.RFC3339),
+	}
+	if v := safeDereference(d.Id); v != nil {
+		result.ID = int64(v.(int))
+	}
+	if v := safeDereference(d.State); v != nil {
+		result.State = api.DepositState(v.(StateEnum))
+	}
+	if d.Collection != nil {
+		result.Collection = d.Collection.Name
+	}
+	if d.User != nil {
+		result.Username = d.User.Username
+	}
+	return result
+}
+
+// toLegacyEvent turns an open api Event into a legacy Event.
+func toLegacyEvent(e *Event) *api.Event {
+	result := &api.Event{
+		UploadState: string(e.UploadState),
+		StartedAt:   safeTimeFormat(e.StartedAt, time.RFC3339),
+		EndedAt:     safeTimeFormat(e.EndedAt, time.RFC3339),
+	}
+	if v := safeDereference(e.Id); v != nil {
+		result.ID = int64(v.(int))
+	}
+	if v := safeDereference(e.Type); v != nil {
+		result.Type = string(v.(TypeEnum))
+	}
+	if e.Collection != nil {
+		result.Collection = e.Collection.Name
+	}
+	if v := safeDereference(e.FileCount); v != nil {
+		result.FileCount = v.(int64)
+	}
+	if v := safeDereference(e.ErrorCount); v != nil {
+		result.ErrorCount = v.(int64)
+	}
+	return result
+}
+
+// toLegacyReport turns an open api Report into a legacy Report.
+func toLegacyReport(r *Report) *api.Report {
+	result := &api.Report{
+		StartedAt:       r.StartedAt.Format(time.RFC3339),
+		EndedAt:         r.EndedAt.Format(time.RFC3339),
+		FileCount:       r.FileCount,
+		TotalSize:       r.TotalSize,
+		ErrorCount:      r.ErrorCount,
+		CollectionFiles: r.CollectionFileCount,
+		CollectionBytes: r.CollectionTotalSize,
+	}
+	if v := safeDereference(r.Id); v != nil {
+		result.ID = int64(v.(int))
+	}
+	if v := safeDereference(r.ReportType); v != nil {
+		result.Type = string(v.(ReportTypeEnum))
+	}
+	if r.Collection != nil {
+		result.Collection = r.Collection.Name
+	}
+	return result
+}
+
+// toLegacyUser turns an open api User into a legacy User.
+func toLegacyUser(u *User) *api.User {
+	result := &api.User{
+		DateJoined: safeTimeFormat(u.DateJoined, time.RFC3339),
+		LastLogin:  safeTimeFormat(u.LastLogin, time.RFC3339),
+		Username:   u.Username,
+	}
+	if v := safeDereference(u.FirstName); v != nil {
+		result.FirstName = v.(string)
+	}
+	if v := safeDereference(u.LastName); v != nil {
+		result.LastName = v.(string)
+	}
+	if v := safeDereference(u.IsActive); v != nil {
+		result.IsActive = v.(bool)
+	}
+	if v := safeDereference(u.IsStaff); v != nil {
+		result.IsStaff = v.(bool)
+	}
+	if v := safeDereference(u.IsSuperuser); v != nil {
+		result.IsSuperuser = v.(bool)
+	}
+	if v := safeDereference(u.Organization); v != nil {
+		result.Organization = v.(string)
+	}
+	if v := safeDereference(u.Url); v != nil {
+		result.URL = v.(string)
+	}
+	if v := safeDereference(u.Role); v != nil {
+		result.Role = string(v.(RoleEnum))
+	}
+	if u.AuthorizedCollections != nil {
+		result.AuthorizedCollections = *u.AuthorizedCollections
+	}
+	return result
+}
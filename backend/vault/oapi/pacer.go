@@ -0,0 +1,158 @@
+package oapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	liberrors "github.com/rclone/rclone/lib/errors"
+	"github.com/rclone/rclone/lib/pacer"
+)
+
+// retryErrorCodes are HTTP status codes, for which we back off and retry.
+var retryErrorCodes = []int{
+	429, // Too Many Requests
+	503, // Service Unavailable
+}
+
+// WithPacer paces all API requests and retries rate limited ones.
+func WithPacer(p *fs.Pacer) Option {
+	return func(capi *CompatAPI) {
+		capi.pacer = p
+	}
+}
+
+// Do sends a request, paced and retried if a pacer is configured. With that,
+// CompatAPI can be used as a HttpRequestDoer by other clients, sharing
+// authentication and rate limiting, e.g. the deposits client.
+func (capi *CompatAPI) Do(req *http.Request) (*http.Response, error) {
+	if capi.pacer == nil {
+		return capi.roundTrip(req)
+	}
+	var (
+		resp    *http.Response
+		attempt int
+		wait    time.Duration // requested by the server with the last response
+	)
+	err := capi.pacer.Call(func() (bool, error) {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return false, err
+			}
+			req.Body = body
+		}
+		// The pacer applies a delay only to the call after the next one,
+		// so we wait for the server here.
+		if err := sleep(req.Context(), wait); err != nil {
+			return false, err
+		}
+		attempt++
+		var err error
+		resp, err = capi.roundTrip(req)
+		retry, err := shouldRetry(req, resp, err)
+		wait, _ = pacer.IsRetryAfter(err)
+		return retry, err
+	})
+	if err != nil {
+		// The wrapper telling the pacer how long to wait hides the
+		// APIError, which keeps the delay in RetryAfter, from errors.As.
+		if _, ok := pacer.IsRetryAfter(err); ok {
+			liberrors.Walk(err, func(cause error) bool {
+				apiErr, ok := cause.(*APIError)
+				if ok {
+					err = fserrors.RetryError(apiErr)
+				}
+				return ok
+			})
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// shouldRetry returns true, if a request should be retried. Requests with a
+// body that cannot be rewound are never retried. Requests with a method,
+// which is not idempotent, are only retried, if the server tells us it did
+// not process them, with a 429 or a 503 with Retry-After, e.g. during
+// maintenance. After a network error or another 503, a POST, e.g. to
+// register or finalize a deposit, may have been processed already, and
+// sending it again would register another deposit.
+func shouldRetry(req *http.Request, resp *http.Response, err error) (bool, error) {
+	if fserrors.ContextError(req.Context(), &err) {
+		return false, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return false, err
+	}
+	idempotent := isIdempotent(req.Method)
+	if err != nil {
+		return idempotent && fserrors.ShouldRetry(err), err
+	}
+	if !fserrors.ShouldRetryHTTP(resp, retryErrorCodes) {
+		return false, nil
+	}
+	if !idempotent && resp.StatusCode != http.StatusTooManyRequests && retryAfter(resp) == 0 {
+		return false, nil
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	apiErr := ErrorFromResponse(req.Method+" "+req.URL.Path, resp)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if apiErr.RetryAfter > 0 {
+		return true, pacer.RetryAfterError(apiErr, apiErr.RetryAfter)
+	}
+	return true, apiErr
+}
+
+// isIdempotent returns true for methods, which have the same effect, when
+// sent more than once, cf. RFC 9110, section 9.2.2.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// sleep waits for d or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retryAfter parses the Retry-After header, given in seconds or as an HTTP
+// date, into a delay. It returns zero, if the header is missing, invalid or
+// in the past.
+func retryAfter(resp *http.Response) time.Duration {
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		if n > 0 {
+			return time.Duration(n) * time.Second
+		}
+		return 0
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,201 @@
+package oapi
+
+import (
+	"context"
+)
+
+// defaultPageSize is the number of items requested per page, if the caller
+// does not set a limit.
+const defaultPageSize = 500
+
+// page is a single page of results and whether there are more pages.
+type page[T any] struct {
+	results *[]T
+	next    *string
+}
+
+// paginate requests pages with increasing offset, until there are no more
+// results, and calls fn for each item. Iteration stops at the first error
+// returned from fn. The limit and offset pointers are the ones in the
+// params struct used by fetch.
+func paginate[T any](limit, offset **int, fetch func() (*page[T], error), fn func(*T) error) error {
+	var l, o = defaultPageSize, 0
+	if *limit != nil {
+		l = **limit
+	}
+	if *offset != nil {
+		o = **offset
+	}
+	*limit = &l
+	for {
+		*offset = &o
+		p, err := fetch()
+		if err != nil {
+			return err
+		}
+		if p.results == nil || len(*p.results) == 0 {
+			return nil
+		}
+		for i := range *p.results {
+			if err := fn(&(*p.results)[i]); err != nil {
+				return err
+			}
+		}
+		if p.next == nil {
+			return nil
+		}
+		o += len(*p.results)
+	}
+}
+
+// ForEachTreenode calls fn for each treenode matching params, across all
+// pages. The params are not modified.
+func (capi *CompatAPI) ForEachTreenode(ctx context.Context, params *TreenodesListParams, fn func(*TreeNode) error) error {
+	var p TreenodesListParams
+	if params != nil {
+		p = *params
+	}
+	return paginate(&p.Limit, &p.Offset, func() (*page[TreeNode], error) {
+		resp, err := capi.client.TreenodesListWithResponse(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != 200 {
+			return nil, NewAPIError("treenodes", resp.StatusCode(), resp.Body)
+		}
+		return &page[TreeNode]{results: resp.JSON200.Results, next: resp.JSON200.Next}, nil
+	}, fn)
+}
+
+// ForEachCollection calls fn for each collection matching params, across all
+// pages. The params are not modified.
+func (capi *CompatAPI) ForEachCollection(ctx context.Context, params *CollectionsListParams, fn func(*Collection) error) error {
+	var p CollectionsListParams
+	if params != nil {
+		p = *params
+	}
+	return paginate(&p.Limit, &p.Offset, func() (*page[Collection], error) {
+		resp, err := capi.client.CollectionsListWithResponse(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != 200 {
+			return nil, NewAPIError("collections", resp.StatusCode(), resp.Body)
+		}
+		return &page[Collection]{results: resp.JSON200.Results, next: resp.JSON200.Next}, nil
+	}, fn)
+}
+
+// ForEachUser calls fn for each user matching params, across all pages. The
+// params are not modified.
+func (capi *CompatAPI) ForEachUser(ctx context.Context, params *UsersListParams, fn func(*User) error) error {
+	var p UsersListParams
+	if params != nil {
+		p = *params
+	}
+	return paginate(&p.Limit, &p.Offset, func() (*page[User], error) {
+		resp, err := capi.client.UsersListWithResponse(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != 200 {
+			return nil, NewAPIError("users", resp.StatusCode(), resp.Body)
+		}
+		return &page[User]{results: resp.JSON200.Results, next: resp.JSON200.Next}, nil
+	}, fn)
+}
+
+// ForEachOrganization calls fn for each organization matching params, across
+// all pages. The params are not modified.
+func (capi *CompatAPI) ForEachOrganization(ctx context.Context, params *OrganizationsListParams, fn func(*Organization) error) error {
+	var p OrganizationsListParams
+	if params != nil {
+		p = *params
+	}
+	return paginate(&p.Limit, &p.Offset, func() (*page[Organization], error) {
+		resp, err := capi.client.OrganizationsListWithResponse(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != 200 {
+			return nil, NewAPIError("organizations", resp.StatusCode(), resp.Body)
+		}
+		return &page[Organization]{results: resp.JSON200.Results, next: resp.JSON200.Next}, nil
+	}, fn)
+}
+
+// ForEachDeposit calls fn for each deposit matching params, across all pages.
+// The params are not modified.
+func (capi *CompatAPI) ForEachDeposit(ctx context.Context, params *DepositsListParams, fn func(*Deposit) error) error {
+	var p DepositsListParams
+	if params != nil {
+		p = *params
+	}
+	return paginate(&p.Limit, &p.Offset, func() (*page[Deposit], error) {
+		resp, err := capi.client.DepositsListWithResponse(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != 200 {
+			return nil, NewAPIError("deposits", resp.StatusCode(), resp.Body)
+		}
+		return &page[Deposit]{results: resp.JSON200.Results, next: resp.JSON200.Next}, nil
+	}, fn)
+}
+
+// ForEachEvent calls fn for each event matching params, across all pages.
+// The params are not modified.
+func (capi *CompatAPI) ForEachEvent(ctx context.Context, params *EventsListParams, fn func(*Event) error) error {
+	var p EventsListParams
+	if params != nil {
+		p = *params
+	}
+	return paginate(&p.Limit, &p.Offset, func() (*page[Event], error) {
+		resp, err := capi.client.EventsListWithResponse(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != 200 {
+			return nil, NewAPIError("events", resp.StatusCode(), resp.Body)
+		}
+		return &page[Event]{results: resp.JSON200.Results, next: resp.JSON200.Next}, nil
+	}, fn)
+}
+
+// ForEachReport calls fn for each report matching params, across all pages.
+// The params are not modified.
+func (capi *CompatAPI) ForEachReport(ctx context.Context, params *ReportsListParams, fn func(*Report) error) error {
+	var p ReportsListParams
+	if params != nil {
+		p = *params
+	}
+	return paginate(&p.Limit, &p.Offset, func() (*page[Report], error) {
+		resp, err := capi.client.ReportsListWithResponse(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != 200 {
+			return nil, NewAPIError("reports", resp.StatusCode(), resp.Body)
+		}
+		return &page[Report]{results: resp.JSON200.Results, next: resp.JSON200.Next}, nil
+	}, fn)
+}
+
+// ForEachCollectionSummary calls fn for each collection summary, across all
+// pages. The params are not modified.
+func (capi *CompatAPI) ForEachCollectionSummary(ctx context.Context, params *CollectionSummariesListParams, fn func(*CollectionSummary) error) error {
+	var p CollectionSummariesListParams
+	if params != nil {
+		p = *params
+	}
+	return paginate(&p.Limit, &p.Offset, func() (*page[CollectionSummary], error) {
+		resp, err := capi.client.CollectionSummariesListWithResponse(ctx, &p)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode() != 200 {
+			return nil, NewAPIError("collection summaries", resp.StatusCode(), resp.Body)
+		}
+		return &page[CollectionSummary]{results: resp.JSON200.Results, next: resp.JSON200.Next}, nil
+	}, fn)
+}
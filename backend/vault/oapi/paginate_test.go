@@ -0,0 +1,56 @@
+package oapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestForEachTreenode(t *testing.T) {
+	const total = 7
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		var results, next = "", "null"
+		for i := offset; i < offset+limit && i < total; i++ {
+			if results != "" {
+				results += ","
+			}
+			results += fmt.Sprintf(`{"id": %d, "name": "n%d", "node_type": "FILE"}`, i, i)
+		}
+		if offset+limit < total {
+			next = `"more"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"count": %d, "next": %s, "results": [%s]}`, total, next, results)
+	}))
+	defer ts.Close()
+	capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"))
+	if err != nil {
+		t.Fatalf("could not setup client: %v", err)
+	}
+	limit := 3
+	params := &TreenodesListParams{Limit: &limit}
+	var ids []int
+	err = capi.ForEachTreenode(context.Background(), params, func(t *TreeNode) error {
+		ids = append(ids, *t.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if len(ids) != total {
+		t.Fatalf("got %v, want %d items", ids, total)
+	}
+	for i, id := range ids {
+		if id != i {
+			t.Fatalf("got %v, want ordered ids", ids)
+		}
+	}
+	if params.Offset != nil {
+		t.Fatalf("params modified")
+	}
+}
@@ -0,0 +1,240 @@
+package oapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+)
+
+// ErrNoPersistentCache is returned by Warm, if there is no persistent cache.
+var ErrNoPersistentCache = errors.New("no persistent cache configured")
+
+// subtree is a tree of treenodes below some folder. Within the subtree, the
+// listings are complete, so a path missing from it does not exist.
+type subtree struct {
+	paths    map[string]*api.TreeNode  // by absolute path
+	children map[int64][]*api.TreeNode // complete listings of the folders
+	// ambiguous paths, e.g. with versions of a file, are left to the api
+	ambiguous map[string]bool
+}
+
+// prefetched holds subtrees fetched ahead of time.
+type prefetched struct {
+	mu sync.Mutex
+	subtree
+	// generation counts changes, so a prefetch overlapping a change is dropped
+	generation int
+}
+
+// resolve returns the treenode at absolute path p, or nil, if p is below a
+// prefetched folder without the next segment of p as a child. Returns false,
+// if p is outside of any prefetched subtree.
+func (pf *prefetched) resolve(p string) (*api.TreeNode, bool) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	segments := pathSegments(p)
+	for i := len(segments); i >= 0; i-- {
+		key := "/" + strings.Join(segments[:i], "/")
+		if pf.ambiguous[key] {
+			return nil, false
+		}
+		t := pf.paths[key]
+		switch {
+		case t == nil:
+			continue
+		case i == len(segments):
+			c := *t
+			return &c, true
+		}
+		// The closest known ancestor lacks the next segment, which is
+		// conclusive for a folder with a complete listing.
+		_, ok := pf.children[t.ID]
+		return nil, ok
+	}
+	return nil, false
+}
+
+// list returns a copy of the children of a prefetched folder.
+func (pf *prefetched) list(id int64) ([]*api.TreeNode, bool) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	children, ok := pf.children[id]
+	if !ok {
+		return nil, false
+	}
+	var result []*api.TreeNode
+	for _, t := range children {
+		c := *t
+		result = append(result, &c)
+	}
+	return result, true
+}
+
+// reset drops all prefetched treenodes.
+func (pf *prefetched) reset() {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	pf.subtree = subtree{}
+	pf.generation++
+}
+
+// evict drops the prefetched treenodes at and below each of paths and the
+// listings of the treenodes with the given ids, after a change to them. The
+// rest of the prefetched subtree is kept.
+func (pf *prefetched) evict(paths []string, ids ...int64) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	for _, p := range paths {
+		prefix := strings.TrimRight(p, "/") + "/"
+		for q, t := range pf.paths {
+			if q == p || strings.HasPrefix(q, prefix) {
+				delete(pf.children, t.ID)
+				delete(pf.paths, q)
+			}
+		}
+		for q := range pf.ambiguous {
+			if q == p || strings.HasPrefix(q, prefix) {
+				delete(pf.ambiguous, q)
+			}
+		}
+	}
+	for _, id := range ids {
+		delete(pf.children, id)
+	}
+	pf.generation++
+}
+
+// fetchSubtree fetches the whole subtree below the treenode at absolute path
+// p, with a single paginated query for all paths starting with the path of
+// the treenode, instead of one query per folder. The subtree of a file is
+// empty.
+func (capi *CompatAPI) fetchSubtree(ctx context.Context, p string) (*subtree, error) {
+	t, err := capi.ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		top    = "/" + strings.Join(pathSegments(p), "/")
+		result = &subtree{
+			paths:     map[string]*api.TreeNode{top: t},
+			children:  make(map[int64][]*api.TreeNode),
+			ambiguous: make(map[string]bool),
+		}
+	)
+	if t.NodeType == "FILE" {
+		return result, nil
+	}
+	var (
+		prefix   = strings.TrimRight(t.Path, "/") + "/"
+		byParent = make(map[int64][]*api.TreeNode)
+	)
+	err = capi.ForEachTreenode(ctx, &TreenodesListParams{PathStartswith: &prefix}, func(v *TreeNode) error {
+		c := toLegacyTreeNode(v)
+		id, err := strconv.ParseInt(c.ParentTreeNodeIdentifier(), 10, 64)
+		if err != nil {
+			return nil // not below any folder, e.g. the organization
+		}
+		byParent[id] = append(byParent[id], c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Walk down from the top, so only treenodes actually below it are kept.
+	queue := []string{top}
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		parent := result.paths[q]
+		result.children[parent.ID] = byParent[parent.ID]
+		names := make(map[string]int)
+		for _, c := range byParent[parent.ID] {
+			names[c.Name]++
+		}
+		for _, c := range byParent[parent.ID] {
+			cp := path.Join(q, c.Name)
+			if names[c.Name] > 1 {
+				result.ambiguous[cp] = true
+				continue
+			}
+			result.paths[cp] = c
+			if c.NodeType != "FILE" {
+				queue = append(queue, cp)
+			}
+		}
+	}
+	return result, nil
+}
+
+// Prefetch fetches the whole subtree below the treenode at absolute path p,
+// see fetchSubtree. Path resolution and listings within the subtree are
+// answered from memory, including lookups of files that do not exist, which
+// is what most checks of a sync are. A change evicts only the treenodes it
+// affects. Returns the number of treenodes fetched.
+func (capi *CompatAPI) Prefetch(ctx context.Context, p string) (int, error) {
+	capi.prefetched.mu.Lock()
+	generation := capi.prefetched.generation
+	capi.prefetched.mu.Unlock()
+	st, err := capi.fetchSubtree(ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	n := len(st.paths) - 1
+	capi.prefetched.mu.Lock()
+	defer capi.prefetched.mu.Unlock()
+	if capi.prefetched.generation != generation {
+		fs.Debugf(capi, "dropped prefetched treenodes below %v, as the tree changed meanwhile", p)
+		return n, nil
+	}
+	if capi.prefetched.paths == nil {
+		capi.prefetched.subtree = subtree{
+			paths:     make(map[string]*api.TreeNode),
+			children:  make(map[int64][]*api.TreeNode),
+			ambiguous: make(map[string]bool),
+		}
+	}
+	for k, v := range st.paths {
+		capi.prefetched.paths[k] = v
+	}
+	for k, v := range st.children {
+		capi.prefetched.children[k] = v
+	}
+	for k := range st.ambiguous {
+		capi.prefetched.ambiguous[k] = true
+	}
+	fs.Debugf(capi, "prefetched %d treenodes below %v", n, p)
+	return n, nil
+}
+
+// Warm fetches the whole subtree below the treenode at absolute path p, see
+// fetchSubtree, and stores its paths and listings in the persistent cache,
+// so a later run, e.g. a mount, starts without crawling the tree. Returns
+// the number of treenodes and folders cached.
+func (capi *CompatAPI) Warm(ctx context.Context, p string) (treenodes, folders int, err error) {
+	if capi.persistent == nil {
+		return 0, 0, ErrNoPersistentCache
+	}
+	st, err := capi.fetchSubtree(ctx, p)
+	if err != nil {
+		return 0, 0, err
+	}
+	values := make(map[string]interface{})
+	for k, v := range st.paths {
+		values[capi.persistentKey("path", k)] = v
+	}
+	for id, v := range st.children {
+		values[capi.persistentKey("list", fmt.Sprintf("%d", id))] = v
+	}
+	if err := capi.persistent.SetMany(values); err != nil {
+		return 0, 0, err
+	}
+	fs.Debugf(capi, "cached %d treenodes below %v", len(st.paths)-1, p)
+	return len(st.paths) - 1, len(st.children), nil
+}
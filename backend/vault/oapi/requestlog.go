@@ -0,0 +1,91 @@
+package oapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// RequestIDHeader carries the correlation id of a request, so it can be
+// matched with server side logs.
+const RequestIDHeader = "X-Request-ID"
+
+// requestLog writes one line per request and response.
+type requestLog struct {
+	mu     sync.Mutex
+	w      io.Writer // if nil, use the rclone debug log
+	prefix string    // random, per process
+	seq    atomic.Uint64
+}
+
+// WithRequestLog logs each request with a correlation id, method, path,
+// status and duration. If w is nil, lines go to the rclone debug log.
+func WithRequestLog(w io.Writer) Option {
+	return func(capi *CompatAPI) {
+		b := make([]byte, 4)
+		_, _ = rand.Read(b)
+		capi.requestLog = &requestLog{w: w, prefix: hex.EncodeToString(b)}
+	}
+}
+
+// nextID returns a new correlation id.
+func (l *requestLog) nextID() string {
+	return fmt.Sprintf("%s-%06d", l.prefix, l.seq.Add(1))
+}
+
+// logf writes a single line.
+func (l *requestLog) logf(capi *CompatAPI, format string, args ...interface{}) {
+	if l.w == nil {
+		fs.Debugf(capi, format, args...)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = fmt.Fprintf(l.w, "%s "+format+"\n", append([]interface{}{time.Now().Format(time.RFC3339Nano)}, args...)...)
+}
+
+// roundTrip sends a single request with the underlying client, logging it,
+// if a request log is configured, and recording it, if it failed and an HTTP
+// dump is configured.
+func (capi *CompatAPI) roundTrip(req *http.Request) (*http.Response, error) {
+	// Requests of other clients using CompatAPI as their doer, e.g. the
+	// deposits client, are sent with the same User-Agent.
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", capi.userAgent)
+	}
+	l := capi.requestLog
+	if l == nil && capi.httpDump == nil {
+		return capi.c.Do(req)
+	}
+	var id string
+	if l != nil {
+		if id = req.Header.Get(RequestIDHeader); id == "" {
+			id = l.nextID()
+			req.Header.Set(RequestIDHeader, id)
+		}
+	}
+	started := time.Now()
+	resp, err := capi.c.Do(req)
+	elapsed := time.Since(started).Round(time.Millisecond)
+	if d := capi.httpDump; d != nil && (err != nil || resp.StatusCode >= 400) {
+		if derr := d.record(req, resp, err, started, elapsed); derr != nil {
+			fs.Logf(capi, "failed to write http dump: %v", derr)
+		}
+	}
+	if l == nil {
+		return resp, err
+	}
+	if err != nil {
+		l.logf(capi, "req=%s %s %s error=%q duration=%v", id, req.Method, req.URL.Path, err, elapsed)
+		return resp, err
+	}
+	l.logf(capi, "req=%s %s %s status=%d duration=%v", id, req.Method, req.URL.Path, resp.StatusCode, elapsed)
+	return resp, err
+}
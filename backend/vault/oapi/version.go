@@ -0,0 +1,111 @@
+package oapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// ErrIncompatibleVersion is returned, if the server API version is too old
+// to be used at all.
+var ErrIncompatibleVersion = errors.New("incompatible api version")
+
+// MinVersionSupported is the oldest server API version we can talk to, with
+// reduced functionality.
+const MinVersionSupported = 2
+
+// Features lists optional capabilities of a server.
+type Features struct {
+	Version    string // as reported by the server
+	DepositsV2 bool   // chunked uploads via /api/deposits/v2/
+}
+
+// FeaturesForVersion checks a server API version and returns the features
+// assumed for it. An empty version is treated as the version this package
+// implements. The version does not tell, whether a server offers DepositsV2,
+// so it is assumed here and probed by Negotiate.
+func FeaturesForVersion(version string) (*Features, error) {
+	if version == "" {
+		version = VersionSupported
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot parse %q", ErrIncompatibleVersion, version)
+	}
+	if v < MinVersionSupported {
+		return nil, fmt.Errorf("%w: %v, need at least %v", ErrIncompatibleVersion, v, MinVersionSupported)
+	}
+	return &Features{Version: version, DepositsV2: true}, nil
+}
+
+// Negotiate determines the features of the server. It fails only, if the
+// server is incompatible.
+func (capi *CompatAPI) Negotiate(ctx context.Context) (*Features, error) {
+	version := capi.Version(ctx)
+	features, err := FeaturesForVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" && version != capi.VersionSupported {
+		fs.Logf(capi, "server api version %v differs from supported version %v, some features may be unavailable",
+			version, capi.VersionSupported)
+	}
+	ok, err := capi.probeDepositsV2(ctx)
+	if err != nil {
+		fs.Logf(capi, "cannot tell, whether the server offers deposits v2, uploads are disabled: %v", err)
+	}
+	features.DepositsV2 = ok
+	return features, nil
+}
+
+// depositsV2Probes caches the outcome of probeDepositsV2 by endpoint, as it
+// does not change during the lifetime of the process.
+var depositsV2Probes = struct {
+	mu sync.Mutex
+	m  map[string]bool
+}{m: make(map[string]bool)}
+
+// probeDepositsV2 checks, whether the server offers the deposits v2 endpoints.
+// Registering a deposit only accepts POST, so an authenticated GET is
+// answered with a 405, if the endpoint exists, or a 404, if it does not; this
+// registers nothing. Any other response proves nothing and is an error; only
+// conclusive outcomes are cached.
+func (capi *CompatAPI) probeDepositsV2(ctx context.Context) (bool, error) {
+	depositsV2Probes.mu.Lock()
+	ok, found := depositsV2Probes.m[capi.Endpoint]
+	depositsV2Probes.mu.Unlock()
+	if found {
+		return ok, nil
+	}
+	r, err := http.NewRequestWithContext(ctx, "GET", capi.Endpoint+"/deposits/v2/register", nil)
+	if err != nil {
+		return false, err
+	}
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("User-Agent", capi.userAgent)
+	if err := capi.Authorize(ctx, r); err != nil {
+		return false, err
+	}
+	resp, err := capi.c.Do(r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusMethodNotAllowed:
+		ok = true
+	case http.StatusNotFound:
+		ok = false
+	default:
+		return false, fmt.Errorf("probing deposits v2: unexpected status %s", resp.Status)
+	}
+	depositsV2Probes.mu.Lock()
+	depositsV2Probes.m[capi.Endpoint] = ok
+	depositsV2Probes.mu.Unlock()
+	return ok, nil
+}
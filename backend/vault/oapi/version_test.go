@@ -0,0 +1,76 @@
+package oapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeaturesForVersion(t *testing.T) {
+	var cases = []struct {
+		version    string
+		depositsV2 bool
+		err        error
+	}{
+		{"", true, nil},
+		{"3", true, nil},
+		{"4", true, nil},
+		{"2", true, nil},
+		{"1", false, ErrIncompatibleVersion},
+		{"x", false, ErrIncompatibleVersion},
+	}
+	for _, c := range cases {
+		features, err := FeaturesForVersion(c.version)
+		if !errors.Is(err, c.err) {
+			t.Fatalf("[%s] got %v, want %v", c.version, err, c.err)
+		}
+		if err == nil && features.DepositsV2 != c.depositsV2 {
+			t.Fatalf("[%s] got %v, want %v", c.version, features.DepositsV2, c.depositsV2)
+		}
+	}
+}
+
+func TestNegotiateDepositsV2(t *testing.T) {
+	var cases = []struct {
+		status int
+		want   bool
+		probes int // after negotiating twice
+	}{
+		{http.StatusMethodNotAllowed, true, 1},
+		{http.StatusOK, true, 1},
+		{http.StatusNotFound, false, 1},
+		{http.StatusForbidden, false, 2},
+		{http.StatusInternalServerError, false, 2},
+	}
+	for _, c := range cases {
+		var probes int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/deposits/v2/register" {
+				probes++
+				if r.Header.Get("Authorization") != "Token abc" {
+					t.Errorf("[%d] probe not authenticated", c.status)
+				}
+				w.WriteHeader(c.status)
+			}
+		}))
+		capi, err := New(ts.URL+"/api", "", "", WithAPIKey("abc"))
+		if err != nil {
+			t.Fatalf("could not setup client: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			features, err := capi.Negotiate(context.Background())
+			if err != nil {
+				t.Fatalf("negotiate failed: %v", err)
+			}
+			if features.DepositsV2 != c.want {
+				t.Errorf("[%d] got deposits v2 %v, want %v", c.status, features.DepositsV2, c.want)
+			}
+		}
+		ts.Close()
+		if probes != c.probes {
+			t.Errorf("[%d] got %d probes, want %d", c.status, probes, c.probes)
+		}
+	}
+}
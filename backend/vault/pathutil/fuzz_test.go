@@ -0,0 +1,38 @@
+package pathutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzSanitize(f *testing.F) {
+	for _, s := range []string{
+		"",
+		"/a/b/c.txt",
+		"/a/ b /c",
+		"/a/./../c",
+		"/a/b\x00c\xff",
+		"/ x　/y",
+		"/" + strings.Repeat("x", 300) + ".tar.gz",
+		"/" + strings.Repeat("ä", 200),
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, p string) {
+		var (
+			valid = IsValidPath(p)
+			s     = Sanitize(p)
+		)
+		if len(p) <= MaxPathLength {
+			if err := Validate(s); err != nil {
+				t.Fatalf("Sanitize(%q) = %q, which is invalid: %v", p, s, err)
+			}
+		}
+		if ss := Sanitize(s); ss != s {
+			t.Fatalf("Sanitize not idempotent for %q: %q, then %q", p, s, ss)
+		}
+		if valid && strings.Trim(s, "/") != strings.Trim(strings.Join(strings.FieldsFunc(p, func(r rune) bool { return r == '/' }), "/"), "/") {
+			t.Fatalf("Sanitize altered valid path %q: %q", p, s)
+		}
+	})
+}
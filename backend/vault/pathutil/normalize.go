@@ -0,0 +1,64 @@
+package pathutil
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization is a unicode normalization applied to names, so that e.g.
+// names from macOS (NFD) and Linux (NFC) do not end up as different,
+// duplicate-looking entries.
+type Normalization int
+
+const (
+	NormalizationNone Normalization = iota
+	NormalizationNFC
+	NormalizationNFD
+)
+
+// ParseNormalization parses "none", "nfc" or "nfd", case insensitive. The
+// empty string means none.
+func ParseNormalization(s string) (Normalization, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return NormalizationNone, nil
+	case "nfc":
+		return NormalizationNFC, nil
+	case "nfd":
+		return NormalizationNFD, nil
+	default:
+		return NormalizationNone, fmt.Errorf("unknown unicode normalization: %q", s)
+	}
+}
+
+// Apply returns p in normalized form.
+func (n Normalization) Apply(p string) string {
+	switch n {
+	case NormalizationNFC:
+		return norm.NFC.String(p)
+	case NormalizationNFD:
+		return norm.NFD.String(p)
+	default:
+		return p
+	}
+}
+
+// Varies reports whether p differs between normal forms, so that a name
+// stored in one form is not found by its other form.
+func Varies(p string) bool {
+	return norm.NFC.String(p) != norm.NFD.String(p)
+}
+
+// String returns the option value of n.
+func (n Normalization) String() string {
+	switch n {
+	case NormalizationNFC:
+		return "nfc"
+	case NormalizationNFD:
+		return "nfd"
+	default:
+		return "none"
+	}
+}
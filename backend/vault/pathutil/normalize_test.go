@@ -0,0 +1,38 @@
+package pathutil
+
+import "testing"
+
+func TestNormalization(t *testing.T) {
+	var (
+		nfc = "/a/caf\u00e9.txt"
+		nfd = "/a/cafe\u0301.txt"
+	)
+	var cases = []struct {
+		name   string
+		p      string
+		result string
+	}{
+		{"none", nfd, nfd},
+		{"", nfc, nfc},
+		{"nfc", nfd, nfc},
+		{"NFC", nfc, nfc},
+		{"nfd", nfc, nfd},
+	}
+	for _, c := range cases {
+		n, err := ParseNormalization(c.name)
+		if err != nil {
+			t.Fatalf("ParseNormalization(%q) failed: %v", c.name, err)
+		}
+		if got := n.Apply(c.p); got != c.result {
+			t.Errorf("[%s] got %q, want %q", c.name, got, c.result)
+		}
+	}
+	if _, err := ParseNormalization("nfkc"); err == nil {
+		t.Errorf("expected error for unsupported form")
+	}
+	for p, want := range map[string]bool{nfc: true, nfd: true, "/a/cafe.txt": false} {
+		if got := Varies(p); got != want {
+			t.Errorf("Varies(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
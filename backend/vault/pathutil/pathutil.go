@@ -0,0 +1,180 @@
+// Package pathutil implements checks and rewrites for paths stored in vault.
+//
+// Vault stores names in XML based metadata and limits the length of paths
+// and path segments, so not every name found on a local filesystem can be
+// deposited as is.
+package pathutil
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxPathLength is the maximum length of a path in bytes.
+	MaxPathLength = 4096
+	// MaxSegmentLength is the maximum length of a single path segment in bytes.
+	MaxSegmentLength = 255
+	// Replacement is used for any character, that cannot be stored.
+	Replacement = '_'
+)
+
+var (
+	ErrPathTooLong    = errors.New("path too long")
+	ErrSegmentTooLong = errors.New("path segment too long")
+	ErrInvalidChar    = errors.New("character not allowed in XML")
+	ErrInvalidUTF8    = errors.New("invalid utf-8")
+	ErrDotSegment     = errors.New("relative path segment")
+	ErrSpaceAffix     = errors.New("leading or trailing whitespace")
+)
+
+// IsValidPath returns true, if p can be stored in vault unaltered.
+func IsValidPath(p string) bool {
+	return Validate(p) == nil
+}
+
+// Validate returns nil, if p can be stored in vault unaltered, otherwise an
+// error wrapping one of the Err* values of this package, which names the
+// first rule violated.
+func Validate(p string) error {
+	if len(p) > MaxPathLength {
+		return fmt.Errorf("%w: %d bytes, max %d", ErrPathTooLong, len(p), MaxPathLength)
+	}
+	for _, s := range strings.Split(p, "/") {
+		if s == "" {
+			continue
+		}
+		if err := validateSegment(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSegment checks a single, non-empty path segment.
+func validateSegment(s string) error {
+	switch {
+	case len(s) > MaxSegmentLength:
+		return fmt.Errorf("%w: %d bytes, max %d", ErrSegmentTooLong, len(s), MaxSegmentLength)
+	case s == "." || s == "..":
+		return fmt.Errorf("%w: %q", ErrDotSegment, s)
+	case !utf8.ValidString(s):
+		return fmt.Errorf("%w in %q", ErrInvalidUTF8, s)
+	case hasSpaceAffix(s):
+		return fmt.Errorf("%w in %q", ErrSpaceAffix, s)
+	}
+	for i, r := range s {
+		if !isXMLChar(r) {
+			return fmt.Errorf("%w: %U at byte %d of %q", ErrInvalidChar, r, i, s)
+		}
+	}
+	return nil
+}
+
+// hasSpaceAffix returns true, if s starts or ends with whitespace.
+func hasSpaceAffix(s string) bool {
+	first, _ := utf8.DecodeRuneInString(s)
+	last, _ := utf8.DecodeLastRuneInString(s)
+	return unicode.IsSpace(first) || unicode.IsSpace(last)
+}
+
+// isXMLChar reports whether r is allowed in an XML 1.0 document, cf.
+// https://www.w3.org/TR/xml/#charsets
+func isXMLChar(r rune) bool {
+	switch {
+	case r == utf8.RuneError:
+		return false
+	case r == 0x09 || r == 0x0A || r == 0x0D:
+		return true
+	case r >= 0x20 && r <= 0xD7FF:
+		return true
+	case r >= 0xE000 && r <= 0xFFFD:
+		return true
+	case r >= 0x10000 && r <= 0x10FFFF:
+		return true
+	}
+	return false
+}
+
+// Sanitize rewrites p into a path that passes IsValidPath. The rewrite is
+// deterministic, so the same input always yields the same output:
+//
+//   - characters not allowed in XML and invalid UTF-8 become "_"
+//   - leading and trailing whitespace of a segment becomes "_"
+//   - "." and ".." segments become "_" and "__"
+//   - segments longer than MaxSegmentLength are shortened, keeping the
+//     extension and adding a short hash of the original segment
+//
+// Empty segments are dropped. Valid paths are returned unaltered, except for
+// cleaning up empty segments.
+func Sanitize(p string) string {
+	var segments []string
+	for _, s := range strings.Split(p, "/") {
+		if s == "" {
+			continue
+		}
+		segments = append(segments, sanitizeSegment(s))
+	}
+	result := strings.Join(segments, "/")
+	if strings.HasPrefix(p, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+// sanitizeSegment rewrites a single, non-empty path segment.
+func sanitizeSegment(s string) string {
+	if validateSegment(s) == nil {
+		return s
+	}
+	switch s {
+	case ".":
+		return "_"
+	case "..":
+		return "__"
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if isXMLChar(r) {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune(Replacement)
+		}
+	}
+	t := replaceSpaceAffix(sb.String())
+	if len(t) > MaxSegmentLength {
+		t = shorten(t, fmt.Sprintf("~%x", sha1.Sum([]byte(s)))[:9])
+	}
+	return t
+}
+
+// replaceSpaceAffix replaces leading and trailing whitespace with "_".
+func replaceSpaceAffix(s string) string {
+	var (
+		trimmedLeft = strings.TrimLeftFunc(s, unicode.IsSpace)
+		trimmed     = strings.TrimRightFunc(trimmedLeft, unicode.IsSpace)
+		left        = utf8.RuneCountInString(s[:len(s)-len(trimmedLeft)])
+		right       = utf8.RuneCountInString(trimmedLeft[len(trimmed):])
+	)
+	return strings.Repeat(string(Replacement), left) + trimmed + strings.Repeat(string(Replacement), right)
+}
+
+// shorten truncates s to fit MaxSegmentLength after adding tag and the file
+// extension of s, cutting at a rune boundary.
+func shorten(s, tag string) string {
+	ext := path.Ext(s)
+	if len(ext)+len(tag) > MaxSegmentLength/2 {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(s, ext)
+	n := MaxSegmentLength - len(tag) - len(ext)
+	for n > 0 && !utf8.RuneStart(stem[n]) {
+		n--
+	}
+	return strings.TrimRightFunc(stem[:n], unicode.IsSpace) + tag + ext
+}
@@ -0,0 +1,92 @@
+package pathutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIsValidPath(t *testing.T) {
+	var cases = []struct {
+		p      string
+		result bool
+	}{
+		{"", true},
+		{"/a/b/c.txt", true},
+		{"a/b c/d", true},
+		{"/a/ b", false},
+		{"/a/b /c", false},
+		{"/a/./c", false},
+		{"/a/../c", false},
+		{"/a/b\x00c", false},
+		{"/a/b\x1fc", false},
+		{"/a/b\xffc", false},
+		{"/a/" + strings.Repeat("x", 255), true},
+		{"/a/" + strings.Repeat("x", 256), false},
+		{strings.Repeat("/abc", 1025), false},
+	}
+	for _, c := range cases {
+		if got := IsValidPath(c.p); got != c.result {
+			t.Errorf("IsValidPath(%q) got %v, want %v", c.p, got, c.result)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	var cases = []struct {
+		p      string
+		result string
+	}{
+		{"/a/b/c.txt", "/a/b/c.txt"},
+		{"a//b", "a/b"},
+		{"/a/ b ", "/a/_b_"},
+		{"/a/./..", "/a/_/__"},
+		{"/a/b\x00c", "/a/b_c"},
+		{"/a/b\xffc", "/a/b_c"},
+	}
+	for _, c := range cases {
+		if got := Sanitize(c.p); got != c.result {
+			t.Errorf("Sanitize(%q) got %q, want %q", c.p, got, c.result)
+		}
+	}
+}
+
+func TestSanitizeLongSegment(t *testing.T) {
+	var (
+		long = strings.Repeat("ä", 200) + ".pdf"
+		s    = Sanitize(long)
+	)
+	if !IsValidPath(s) {
+		t.Fatalf("sanitized path still invalid: %q", s)
+	}
+	if !strings.HasSuffix(s, ".pdf") {
+		t.Fatalf("extension lost: %q", s)
+	}
+	if s != Sanitize(long) {
+		t.Fatalf("sanitize is not deterministic")
+	}
+	if s == Sanitize(strings.Repeat("ä", 201)+".pdf") {
+		t.Fatalf("different long names should not collide")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var cases = []struct {
+		p   string
+		err error
+	}{
+		{"/a/b/c.txt", nil},
+		{strings.Repeat("/abc", 1025), ErrPathTooLong},
+		{"/a/" + strings.Repeat("x", 256), ErrSegmentTooLong},
+		{"/a/b\x01c", ErrInvalidChar},
+		{"/a/b\xffc", ErrInvalidUTF8},
+		{"/a/../c", ErrDotSegment},
+		{"/a/b ", ErrSpaceAffix},
+	}
+	for _, c := range cases {
+		err := Validate(c.p)
+		if !errors.Is(err, c.err) {
+			t.Errorf("Validate(%q) got %v, want %v", c.p, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/rclone/rclone/backend/vault/oapi"
+	"github.com/rclone/rclone/fs"
+)
+
+// prefetch fetches all treenodes below the root, once, before the first
+// lookup, if prefetch_listing is set. Failures are logged only, lookups then
+// go to the api one by one, as without the option.
+func (f *Fs) prefetch(ctx context.Context) {
+	if !f.opt.PrefetchListing {
+		return
+	}
+	f.prefetchOnce.Do(func() {
+		n, err := f.api.Prefetch(ctx, f.absPath(""))
+		switch {
+		case err == fs.ErrorObjectNotFound:
+			fs.Debugf(f, "nothing to prefetch, root does not exist yet")
+		case err != nil:
+			fs.Logf(f, "could not prefetch listing: %v", err)
+		default:
+			fs.Infof(f, "prefetched %d files and folders", n)
+		}
+	})
+}
+
+// WarmResult is the output of the warm command.
+type WarmResult struct {
+	Path      string `json:"path"`
+	Treenodes int    `json:"treenodes"`
+	Folders   int    `json:"folders"`
+}
+
+// warmCommand stores all treenodes below the root in the persistent cache.
+func (f *Fs) warmCommand(ctx context.Context) (out interface{}, err error) {
+	p := path.Join("/", f.absPath(""))
+	treenodes, folders, err := f.api.Warm(ctx, p)
+	switch {
+	case errors.Is(err, oapi.ErrNoPersistentCache):
+		return nil, fmt.Errorf("%w: set cache_ttl to keep the cache across runs", err)
+	case err == fs.ErrorObjectNotFound:
+		return nil, fs.ErrorDirNotFound
+	case err != nil:
+		return nil, err
+	}
+	fs.Infof(f, "cached %d files and folders", treenodes)
+	return &WarmResult{Path: p, Treenodes: treenodes, Folders: folders}, nil
+}
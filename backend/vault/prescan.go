@@ -0,0 +1,67 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// maxPrescanReport limits the number of invalid paths quoted in the error;
+// all invalid paths are logged.
+const maxPrescanReport = 10
+
+// prescan validates the stored names of all files of the source of src, once,
+// before the first deposit is registered, so invalid paths are reported up
+// front and not hours into a deposit. Sources that cannot be listed are not
+// checked.
+func (f *Fs) prescan(ctx context.Context, src fs.ObjectInfo) error {
+	f.prescanOnce.Do(func() {
+		srcFs, ok := src.Fs().(fs.Fs)
+		if !ok || srcFs == nil {
+			return
+		}
+		invalid, err := f.invalidRemotes(ctx, srcFs)
+		if err != nil {
+			fs.Debugf(f, "skipping path validation: %v", err)
+			return
+		}
+		if len(invalid) == 0 {
+			return
+		}
+		for _, remote := range invalid {
+			fs.Errorf(remote, "invalid path for vault")
+		}
+		quoted := invalid
+		if len(quoted) > maxPrescanReport {
+			quoted = quoted[:maxPrescanReport]
+		}
+		f.prescanErr = fserrors.FatalError(fmt.Errorf("%w: %d files cannot be stored, e.g. %q; set sanitize_paths to rename them",
+			ErrInvalidPath, len(invalid), quoted))
+	})
+	return f.prescanErr
+}
+
+// invalidRemotes lists the objects of srcFs and returns the sorted remotes,
+// that cannot be stored in vault. Objects excluded by the filters are not
+// transferred and not checked; with a single file, e.g. for copyto, only
+// that file is listed.
+func (f *Fs) invalidRemotes(ctx context.Context, srcFs fs.Fs) (invalid []string, err error) {
+	var mu sync.Mutex
+	err = walk.ListR(ctx, srcFs, "", false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		mu.Lock()
+		defer mu.Unlock()
+		entries.ForObject(func(o fs.Object) {
+			if _, err := f.storedRemote(o.Remote()); err != nil {
+				invalid = append(invalid, o.Remote())
+			}
+		})
+		return nil
+	})
+	sort.Strings(invalid)
+	return invalid, err
+}
@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// DepositProgress is the progress of an inflight deposit, as shown by rclone
+// rc vault/deposits/progress.
+type DepositProgress struct {
+	Remote      string  `json:"remote"`
+	Path        string  `json:"path"` // directory deposited to
+	DepositID   int     `json:"depositId"`
+	Files       int64   `json:"files"`     // files uploaded completely
+	Uploading   int64   `json:"uploading"` // files being uploaded
+	Bytes       int64   `json:"bytes"`     // size of the files uploaded completely
+	SentBytes   int64   `json:"sentBytes"` // bytes of all chunks sent
+	ElapsedTime float64 `json:"elapsedTime"`
+}
+
+// depositing are the remotes which registered a deposit, until shutdown.
+var depositing = struct {
+	mu  sync.Mutex
+	fss map[*Fs]bool
+}{fss: make(map[*Fs]bool)}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vault/deposits/progress",
+		Fn:    rcDepositsProgress,
+		Title: "Show the progress of inflight deposits",
+		Help: `This shows the progress of the deposits in progress of all vault
+remotes, complementing the byte counters of core/stats.
+
+Returns:
+
+- deposits - list of deposits, with remote, directory deposited to, deposit
+  id, files uploaded completely and in progress, bytes of the files uploaded
+  completely and bytes sent, and the time since registration in seconds
+
+Eg
+
+    rclone rc vault/deposits/progress
+`,
+	})
+}
+
+// rcDepositsProgress returns the progress of all inflight deposits.
+func rcDepositsProgress(ctx context.Context, in rc.Params) (rc.Params, error) {
+	return rc.Params{"deposits": depositStats()}, nil
+}
+
+// trackDeposits adds the remote to the progress, after it registered a deposit.
+func trackDeposits(f *Fs) {
+	depositing.mu.Lock()
+	defer depositing.mu.Unlock()
+	depositing.fss[f] = true
+}
+
+// untrackDeposits removes the remote from the progress, e.g. after shutdown.
+func untrackDeposits(f *Fs) {
+	depositing.mu.Lock()
+	defer depositing.mu.Unlock()
+	delete(depositing.fss, f)
+}
+
+// depositStats returns the progress of all inflight deposits, by deposit id.
+func depositStats() []*DepositProgress {
+	depositing.mu.Lock()
+	fss := make([]*Fs, 0, len(depositing.fss))
+	for f := range depositing.fss {
+		fss = append(fss, f)
+	}
+	depositing.mu.Unlock()
+	result := []*DepositProgress{}
+	for _, f := range fss {
+		result = append(result, f.depositProgress()...)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DepositID < result[j].DepositID })
+	return result
+}
+
+// depositProgress returns the progress of the inflight deposits.
+func (f *Fs) depositProgress() (result []*DepositProgress) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range f.deposits {
+		result = append(result, &DepositProgress{
+			Remote:      fs.ConfigString(f),
+			Path:        d.dir,
+			DepositID:   d.id,
+			Files:       d.files,
+			Uploading:   f.uploading,
+			Bytes:       d.bytes,
+			SentBytes:   d.sentBytes,
+			ElapsedTime: time.Since(d.started).Seconds(),
+		})
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+)
+
+// ErrQuotaExceeded is returned, if a transfer does not fit into the remaining
+// quota of the organization.
+var ErrQuotaExceeded = errors.New("transfer exceeds remaining quota")
+
+// checkQuota compares the planned transfer size with the remaining quota of
+// the organization, before a deposit is registered, so we fail early instead
+// of in the middle of a deposit. Size is the size of the object about to be
+// uploaded, -1 if unknown.
+func (f *Fs) checkQuota(ctx context.Context, size int64) error {
+	planned := plannedTransferSize(ctx, size)
+	if planned <= 0 {
+		return nil
+	}
+	usage, err := f.About(ctx)
+	if err != nil || usage.Free == nil {
+		fs.Debugf(f, "skipping quota check: %v", err)
+		return nil
+	}
+	fs.Debugf(f, "quota check: %v planned, %v free", fs.SizeSuffix(planned), fs.SizeSuffix(*usage.Free))
+	if planned > *usage.Free {
+		return fserrors.FatalError(fmt.Errorf("%w: %v planned, %v free", ErrQuotaExceeded,
+			fs.SizeSuffix(planned), fs.SizeSuffix(*usage.Free)))
+	}
+	return nil
+}
+
+// plannedTransferSize returns the number of bytes left to transfer, as far as
+// known: the bytes queued by sync or copy, but at least size, limited by
+// --max-transfer. Rclone may still be scanning the source, so this is a lower
+// bound.
+func plannedTransferSize(ctx context.Context, size int64) int64 {
+	var (
+		stats   = accounting.Stats(ctx)
+		planned = size
+	)
+	if out, err := stats.RemoteStats(); err == nil {
+		if total, ok := out["totalBytes"].(int64); ok && total-stats.GetBytes() > planned {
+			planned = total - stats.GetBytes()
+		}
+	}
+	if limit := int64(fs.GetConfig(ctx).MaxTransfer); limit > 0 && planned > limit {
+		planned = limit
+	}
+	return planned
+}
@@ -0,0 +1,238 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// ErrNoDeposit is returned, if a deposit call has no deposit id and there is
+// no inflight deposit.
+var ErrNoDeposit = errors.New("no deposit id given and no deposit inflight")
+
+// ErrSeveralDeposits is returned, if a deposit call has no deposit id and
+// there are several inflight deposits, e.g. into several collections.
+var ErrSeveralDeposits = errors.New("no deposit id given and several deposits inflight")
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vault/deposits/list",
+		Fn:    rcDepositsList,
+		Title: "List deposits of a vault remote",
+		Help: `This lists the deposits of the organization of a vault remote.
+
+Parameters:
+
+- fs - a vault remote, e.g. "vault:"
+- state - only list deposits in this state, e.g. "REGISTERED" (optional)
+- tag - only list deposits with this tag, see deposit_tags (optional)
+
+Returns:
+
+- deposits - list of deposits, with id, state and timestamps
+- inflight - id of the deposit of this remote in progress, 0 if none; the
+  first one, if there are several, e.g. into several collections
+- inflight_ids - ids of all deposits of this remote in progress
+- tags - tags of the listed deposits by deposit id, as recorded by this remote
+
+Eg
+
+    rclone rc vault/deposits/list fs=vault: state=REGISTERED
+    rclone rc vault/deposits/list fs=vault: tag=grant-2023
+`,
+	})
+	rc.Add(rc.Call{
+		Path:  "vault/deposits/status",
+		Fn:    rcDepositsStatus,
+		Title: "Show the status of a deposit",
+		Help: `This shows the state and the file counts of a deposit.
+
+Parameters:
+
+- fs - a vault remote, e.g. "vault:"
+- id - deposit id, defaults to the inflight deposit (optional)
+
+Returns:
+
+- deposit - the deposit, with id, state and timestamps
+- status - number of total, assembled, errored and stored files
+- done - true, if the server is done with the deposit, successfully or not
+- failed - true, if the deposit completed with errors or was terminated
+`,
+	})
+	rc.Add(rc.Call{
+		Path:  "vault/deposits/abort",
+		Fn:    rcDepositsAbort,
+		Title: "Terminate a deposit",
+		Help: `This terminates a deposit, uploaded files of the deposit are discarded.
+If the deposit is an inflight deposit of the remote, the next upload into
+its directory starts a new deposit.
+
+Parameters:
+
+- fs - a vault remote, e.g. "vault:"
+- id - deposit id, defaults to the inflight deposit (optional)
+`,
+	})
+	rc.Add(rc.Call{
+		Path:  "vault/deposits/finalize",
+		Fn:    rcDepositsFinalize,
+		Title: "Finalize a deposit",
+		Help: `This finalizes a deposit, after which vault assembles and stores the
+uploaded files. Use this for deposits left registered, e.g. by an
+interrupted transfer.
+
+Parameters:
+
+- fs - a vault remote, e.g. "vault:"
+- id - deposit id, defaults to the inflight deposit (optional)
+`,
+	})
+}
+
+// rcVaultFs returns the vault remote named by the "fs" parameter.
+func rcVaultFs(ctx context.Context, in rc.Params) (*Fs, error) {
+	f, err := rc.GetFsNamed(ctx, in, "fs")
+	if err != nil {
+		return nil, err
+	}
+	vf, ok := f.(*Fs)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a vault remote", f)
+	}
+	return vf, nil
+}
+
+// rcDepositID returns the "id" parameter or the inflight deposit id.
+func rcDepositID(f *Fs, in rc.Params) (int, error) {
+	id, err := in.GetInt64("id")
+	switch {
+	case rc.NotErrParamNotFound(err):
+		return 0, err
+	case err == nil:
+		return int(id), nil
+	}
+	switch ids := f.inflightDeposits(); len(ids) {
+	case 0:
+		return 0, ErrNoDeposit
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrSeveralDeposits, ids)
+	}
+}
+
+func rcDepositsList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	f, err := rcVaultFs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	state, err := in.GetString("state")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	if state != "" && !api.DepositState(state).Known() {
+		return nil, fmt.Errorf("unknown deposit state %q, must be one of %v", state, api.DepositStates)
+	}
+	tag, err := in.GetString("tag")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	deposits, err := f.api.Deposits(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := loadDepositTags(f.name)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		listed = []*api.Deposit{}
+		tags   = make(map[string][]string)
+	)
+	for _, d := range deposits {
+		id := strconv.FormatInt(d.ID, 10)
+		if tag != "" && !hasTag(recorded[id], tag) {
+			continue
+		}
+		if t, ok := recorded[id]; ok {
+			tags[id] = t
+		}
+		listed = append(listed, d)
+	}
+	return rc.Params{
+		"deposits":     listed,
+		"inflight":     f.inflightDeposit(),
+		"inflight_ids": f.inflightDeposits(),
+		"tags":         tags,
+	}, nil
+}
+
+func rcDepositsStatus(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	f, err := rcVaultFs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	id, err := rcDepositID(f, in)
+	if err != nil {
+		return nil, err
+	}
+	deposit, err := f.api.Deposit(ctx, int64(id))
+	if err != nil {
+		return nil, err
+	}
+	status, err := f.depositor.status(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{
+		"deposit": deposit,
+		"status":  status,
+		"done":    deposit.State.IsDone(),
+		"failed":  deposit.State.IsFailed(),
+	}, nil
+}
+
+func rcDepositsAbort(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	f, err := rcVaultFs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	id, err := rcDepositID(f, in)
+	if err != nil {
+		return nil, err
+	}
+	return nil, f.abortDeposit(ctx, id)
+}
+
+func rcDepositsFinalize(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	f, err := rcVaultFs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	id, err := rcDepositID(f, in)
+	if err != nil {
+		return nil, err
+	}
+	if f.isInflight(id) {
+		return nil, f.finalizeDeposit(ctx, id)
+	}
+	d, err := f.api.Deposit(ctx, int64(id))
+	if err != nil {
+		return nil, err
+	}
+	if !d.State.IsOpen() {
+		return nil, fmt.Errorf("%w: deposit %d is %s", ErrDepositClosed, id, d.State)
+	}
+	if err := f.depositor.finalize(ctx, id); err != nil {
+		return nil, err
+	}
+	f.api.InvalidateCache()
+	fs.Logf(f, "finalized deposit %d", id)
+	return nil, nil
+}
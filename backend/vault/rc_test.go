@@ -0,0 +1,137 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+func TestRcDeposits(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		srv      = newTestServer(t)
+		fsString = fmt.Sprintf(`:vault,endpoint="%s",username=%s,password=%s:c`,
+			srv.Endpoint(), testUsername, obscure.MustObscure(testPassword))
+	)
+	f, err := cache.Get(ctx, fsString)
+	if err != nil {
+		t.Fatalf("failed to setup fs: %v", err)
+	}
+	defer cache.Clear()
+	var (
+		put = func(name string) {
+			src := object.NewStaticObjectInfo(name, time.Now(), 5, true, nil, nil)
+			if _, err := f.Put(ctx, strings.NewReader("vault"), src); err != nil {
+				t.Fatalf("put failed: %v", err)
+			}
+		}
+		call = func(p string, in rc.Params) rc.Params {
+			in["fs"] = fsString
+			out, err := rc.Calls.Get(p).Fn(ctx, in)
+			if err != nil {
+				t.Fatalf("%s failed: %v", p, err)
+			}
+			return out
+		}
+		listState = func(state string) []*api.Deposit {
+			return call("vault/deposits/list", rc.Params{"state": state})["deposits"].([]*api.Deposit)
+		}
+	)
+	// Finalize the inflight deposit.
+	put("a.txt")
+	out := call("vault/deposits/list", rc.Params{"state": "REGISTERED"})
+	if deposits := out["deposits"].([]*api.Deposit); len(deposits) != 1 || int(deposits[0].ID) != out["inflight"] {
+		t.Fatalf("unexpected deposits: %v, inflight %v", deposits, out["inflight"])
+	}
+	out = call("vault/deposits/status", rc.Params{})
+	if d := out["deposit"].(*api.Deposit); d.State != "REGISTERED" || d.Collection != "c" {
+		t.Fatalf("unexpected deposit: %v", d)
+	}
+	call("vault/deposits/finalize", rc.Params{})
+	if deposits := listState("REPLICATED"); len(deposits) != 1 {
+		t.Fatalf("got %d replicated deposits, want 1", len(deposits))
+	}
+	if _, ok := srv.File("c/a.txt"); !ok {
+		t.Fatalf("file not deposited")
+	}
+	// Abort the next deposit.
+	put("b.txt")
+	call("vault/deposits/abort", rc.Params{})
+	deposits := listState("TERMINATED_BY_USER")
+	if len(deposits) != 1 {
+		t.Fatalf("got %d terminated deposits, want 1", len(deposits))
+	}
+	out = call("vault/deposits/status", rc.Params{"id": deposits[0].ID})
+	if out["done"] != true || out["failed"] != true {
+		t.Fatalf("got done %v, failed %v for a terminated deposit", out["done"], out["failed"])
+	}
+	_, err = rc.Calls.Get("vault/deposits/finalize").Fn(ctx, rc.Params{"fs": fsString, "id": deposits[0].ID})
+	if !errors.Is(err, ErrDepositClosed) {
+		t.Fatalf("got %v, want %v", err, ErrDepositClosed)
+	}
+	if _, err := rc.Calls.Get("vault/deposits/list").Fn(ctx, rc.Params{"fs": fsString, "state": "DONE"}); err == nil {
+		t.Fatalf("expected error for unknown state")
+	}
+	if _, err := rc.Calls.Get("vault/deposits/status").Fn(ctx, rc.Params{"fs": fsString}); err != ErrNoDeposit {
+		t.Fatalf("got %v, want %v", err, ErrNoDeposit)
+	}
+}
+
+func TestRcDepositTags(t *testing.T) {
+	dir := config.GetCacheDir()
+	defer func() { _ = config.SetCacheDir(dir) }()
+	if err := config.SetCacheDir(t.TempDir()); err != nil {
+		t.Fatalf("cannot set cache dir: %v", err)
+	}
+	var (
+		ctx      = context.Background()
+		srv      = newTestServer(t)
+		fsString = fmt.Sprintf(`:vault,endpoint="%s",username=%s,password=%s,deposit_tags='grant,batch-1':c`,
+			srv.Endpoint(), testUsername, obscure.MustObscure(testPassword))
+	)
+	f, err := cache.Get(ctx, fsString)
+	if err != nil {
+		t.Fatalf("failed to setup fs: %v", err)
+	}
+	defer cache.Clear()
+	src := object.NewStaticObjectInfo("a.txt", time.Now(), 5, true, nil, nil)
+	if _, err := f.Put(ctx, strings.NewReader("vault"), src); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := f.(fs.Shutdowner).Shutdown(ctx); err != nil {
+		t.Fatalf("finalize failed: %v", err)
+	}
+	list := func(tag string) rc.Params {
+		out, err := rc.Calls.Get("vault/deposits/list").Fn(ctx, rc.Params{"fs": fsString, "tag": tag})
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		return out
+	}
+	out := list("batch-1")
+	deposits, tags := out["deposits"].([]*api.Deposit), out["tags"].(map[string][]string)
+	if len(deposits) != 1 {
+		t.Fatalf("got %d deposits, want 1", len(deposits))
+	}
+	if got := tags[strconv.FormatInt(deposits[0].ID, 10)]; strings.Join(got, ",") != "grant,batch-1" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	if deposits := list("other")["deposits"].([]*api.Deposit); len(deposits) != 0 {
+		t.Fatalf("got %d deposits, want none", len(deposits))
+	}
+	if m, _ := srv.Metadata("c/a.txt"); m["deposit_tags"] != nil {
+		t.Fatalf("tags stored in the metadata of files: %v", m)
+	}
+}
@@ -0,0 +1,163 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+)
+
+// DepositReceipt is a structured record of a finalized deposit, e.g. for
+// accession records.
+type DepositReceipt struct {
+	DepositID  int64               `json:"deposit_id"`
+	State      api.DepositState    `json:"state"`
+	Collection string              `json:"collection"`
+	Username   string              `json:"username"`
+	History    []*DepositStateTime `json:"history"`
+	Status     *api.DepositStatus  `json:"status"`
+	Files      []*ReceiptFile      `json:"files"`
+	Generated  string              `json:"generated_at"`
+}
+
+// DepositStateTime is the time a deposit reached a state.
+type DepositStateTime struct {
+	State api.DepositState `json:"state"`
+	Time  string           `json:"time"`
+}
+
+// ReceiptFile is a single file of a deposit. Checksums are taken from vault,
+// if the file has been assembled, from the manifest otherwise.
+type ReceiptFile struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	MD5        string `json:"md5"`
+	SHA1       string `json:"sha1"`
+	SHA256     string `json:"sha256"`
+	UploadedAt string `json:"uploaded_at,omitempty"`
+}
+
+// receiptCommand returns the receipt of a deposit, by default of the last
+// deposit finalized. The file list requires a manifest, see manifest_path.
+func (f *Fs) receiptCommand(ctx context.Context, args []string, opt map[string]string) (out interface{}, err error) {
+	id := f.lastDeposit()
+	if len(args) > 0 {
+		if id, err = strconv.Atoi(args[0]); err != nil {
+			return nil, fmt.Errorf("invalid deposit id: %w", err)
+		}
+	}
+	if id == 0 {
+		return nil, ErrNoDeposit
+	}
+	receipt, err := f.depositReceipt(ctx, id, optOrDefault(opt, "manifest", f.opt.ManifestPath))
+	if err != nil {
+		return nil, err
+	}
+	if filename, ok := opt["output"]; ok {
+		b, err := json.MarshalIndent(receipt, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return nil, os.WriteFile(filename, b, 0644)
+	}
+	return receipt, nil
+}
+
+// depositReceipt gathers deposit state and status from vault and the files
+// of the deposit from the manifests of this run or the manifest file.
+func (f *Fs) depositReceipt(ctx context.Context, id int, manifestPath string) (*DepositReceipt, error) {
+	d, err := f.api.Deposit(ctx, int64(id))
+	if err != nil {
+		return nil, err
+	}
+	status, err := f.depositor.status(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &DepositReceipt{
+		DepositID:  d.ID,
+		State:      d.State,
+		Collection: d.Collection,
+		Username:   d.Username,
+		History:    []*DepositStateTime{},
+		Status:     status,
+		Files:      []*ReceiptFile{},
+		Generated:  time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, st := range []DepositStateTime{
+		{api.DepositRegistered, d.RegisteredAt},
+		{api.DepositUploaded, d.UploadedAt},
+		{api.DepositHashed, d.HashedAt},
+		{api.DepositReplicated, d.ReplicatedAt},
+	} {
+		if st.Time != "" {
+			receipt.History = append(receipt.History, &DepositStateTime{State: st.State, Time: st.Time})
+		}
+	}
+	files, err := f.manifestFiles(id, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		fs.Logf(f, "no manifest of deposit %d found, receipt lists no files; set manifest_path when depositing", id)
+	}
+	for _, mf := range files {
+		rf := &ReceiptFile{Path: mf.Remote, Size: mf.Size, MD5: mf.MD5, SHA1: mf.SHA1, SHA256: mf.SHA256}
+		if t, err := f.api.ResolvePath(ctx, mf.Remote); err == nil {
+			if v, ok := t.Md5Sum.(string); ok && v != "" {
+				rf.MD5 = v
+			}
+			if v, ok := t.Sha1Sum.(string); ok && v != "" {
+				rf.SHA1 = v
+			}
+			if v, ok := t.Sha256Sum.(string); ok && v != "" {
+				rf.SHA256 = v
+			}
+			rf.UploadedAt = t.UploadedAt
+		}
+		receipt.Files = append(receipt.Files, rf)
+	}
+	return receipt, nil
+}
+
+// manifestFiles returns the files of a deposit, as recorded in the
+// manifests of this run or, if not found there, in a manifest file. It
+// returns nil, if the deposit is in neither.
+func (f *Fs) manifestFiles(id int, manifestPath string) ([]*ManifestFile, error) {
+	f.mu.Lock()
+	manifests := f.manifests
+	f.mu.Unlock()
+	if manifestPath != "" && !hasManifest(manifests, id) {
+		b, err := os.ReadFile(manifestPath)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(b, &manifests); err != nil {
+				return nil, fmt.Errorf("invalid manifest %v: %w", manifestPath, err)
+			}
+		}
+	}
+	for _, m := range manifests {
+		if m.DepositID == id {
+			return m.Files, nil
+		}
+	}
+	return nil, nil
+}
+
+// hasManifest returns true, if manifests contain the deposit.
+func hasManifest(manifests []*Manifest, id int) bool {
+	for _, m := range manifests {
+		if m.DepositID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/report"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// reportCommand writes a preservation report as CSV or JSON, to stdout or to
+// a file.
+func (f *Fs) reportCommand(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	var (
+		format       = optOrDefault(opt, "format", "json")
+		_, withFiles = opt["files"]
+		buf          bytes.Buffer
+	)
+	if format != "json" && format != "csv" {
+		return nil, fmt.Errorf("unsupported report format: %v", format)
+	}
+	r, err := f.buildReport(ctx, withFiles)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case format == "json":
+		err = r.WriteJSON(&buf)
+	case withFiles:
+		err = r.WriteFilesCSV(&buf)
+	default:
+		err = r.WriteCollectionsCSV(&buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filename, ok := opt["output"]; ok {
+		if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return buf.String(), nil
+}
+
+// buildReport gathers collection stats and fixity events of the organization
+// and, if withFiles is set, sizes and checksums of all files below the root.
+func (f *Fs) buildReport(ctx context.Context, withFiles bool) (*report.Report, error) {
+	org, err := f.api.Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := f.api.FindCollections(ctx, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	stats, err := f.api.GetCollectionStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events, err := f.api.Events(ctx, "FIXITY")
+	if err != nil {
+		return nil, err
+	}
+	var (
+		r = &report.Report{
+			Organization: org.Name,
+			Generated:    time.Now().UTC().Format(time.RFC3339),
+		}
+		byName = make(map[string]*report.Collection)
+	)
+	for _, c := range collections {
+		rc := &report.Collection{
+			Name:              c.Name,
+			FixityFrequency:   c.FixityFrequency,
+			TargetReplication: c.TargetReplication,
+		}
+		for _, s := range stats.Collections {
+			if s.ID == c.Identifier() {
+				rc.Files, rc.Bytes, rc.StatsTime = s.FileCount, s.TotalSize, s.Time
+			}
+		}
+		byName[c.Name] = rc
+		r.Collections = append(r.Collections, rc)
+	}
+	sort.Slice(r.Collections, func(i, j int) bool { return r.Collections[i].Name < r.Collections[j].Name })
+	for _, e := range events {
+		rc, ok := byName[e.Collection]
+		if !ok || e.EndedAt == "" {
+			continue
+		}
+		rc.FixityChecks++
+		if laterThan(e.EndedAt, rc.LastFixityCheck) {
+			rc.LastFixityCheck, rc.LastFixityFiles, rc.LastFixityErrors = e.EndedAt, e.FileCount, e.ErrorCount
+		}
+	}
+	if !withFiles {
+		return r, nil
+	}
+	err = walk.ListR(ctx, f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		return entries.ForObjectError(func(o fs.Object) error {
+			var (
+				p  = path.Join("/", f.root, o.Remote())
+				rf = &report.File{
+					Collection: strings.SplitN(p[1:], "/", 2)[0],
+					Path:       p,
+					Size:       o.Size(),
+					Modified:   o.ModTime(ctx).UTC().Format(time.RFC3339),
+				}
+			)
+			for ht, v := range map[hash.Type]*string{hash.MD5: &rf.MD5, hash.SHA1: &rf.SHA1, hash.SHA256: &rf.SHA256} {
+				sum, err := o.Hash(ctx, ht)
+				if err != nil {
+					return err
+				}
+				*v = sum
+			}
+			r.Files = append(r.Files, rf)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].Path < r.Files[j].Path })
+	return r, nil
+}
+
+// laterThan returns true, if RFC3339 timestamp a is after b or b is empty.
+func laterThan(a, b string) bool {
+	if b == "" {
+		return true
+	}
+	ta, erra := time.Parse(time.RFC3339, a)
+	tb, errb := time.Parse(time.RFC3339, b)
+	if erra != nil || errb != nil {
+		return a > b
+	}
+	return ta.After(tb)
+}
@@ -0,0 +1,163 @@
+// Package report holds preservation reports of an organization, with
+// collection stats, fixity summaries, the distribution of copies across
+// locations, usage over time and optional per file checksums, and writes
+// them as CSV or JSON.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// Collection summarizes a single collection.
+type Collection struct {
+	Name              string `json:"name"`
+	Files             int64  `json:"files"`
+	Bytes             int64  `json:"bytes"`
+	StatsTime         string `json:"stats_time"`
+	FixityFrequency   string `json:"fixity_frequency"`
+	TargetReplication int64  `json:"target_replication"`
+	FixityChecks      int64  `json:"fixity_checks"`
+	LastFixityCheck   string `json:"last_fixity_check"`
+	LastFixityFiles   int64  `json:"last_fixity_files"`
+	LastFixityErrors  int64  `json:"last_fixity_errors"`
+}
+
+// File is a single file with its checksums.
+type File struct {
+	Collection string `json:"collection"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Modified   string `json:"modified"`
+	MD5        string `json:"md5"`
+	SHA1       string `json:"sha1"`
+	SHA256     string `json:"sha256"`
+}
+
+// Geolocation is the number of copies of a collection or of a subtree of a
+// collection at a single location.
+type Geolocation struct {
+	Collection       string `json:"collection"`
+	Path             string `json:"path"`
+	Location         string `json:"location"`
+	DisplayName      string `json:"display_name"`
+	PhysicalLocation string `json:"physical_location"`
+	Copies           int64  `json:"copies"`
+	Bytes            int64  `json:"bytes"`
+}
+
+// Usage is the storage used by a collection, or by the organization, if
+// collection is empty, at the end of the period starting at time.
+type Usage struct {
+	Time       string `json:"time"`
+	Collection string `json:"collection"`
+	Files      int64  `json:"files"`
+	Bytes      int64  `json:"bytes"`
+}
+
+// Report is a preservation report of an organization.
+type Report struct {
+	Organization string         `json:"organization"`
+	Generated    string         `json:"generated"`
+	Collections  []*Collection  `json:"collections"`
+	Files        []*File        `json:"files,omitempty"`
+	Geolocations []*Geolocation `json:"geolocations,omitempty"`
+	Usage        []*Usage       `json:"usage,omitempty"`
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCollectionsCSV writes one row per collection, with a header.
+func (r *Report) WriteCollectionsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"organization", "collection", "files", "bytes", "stats_time",
+		"fixity_frequency", "target_replication", "fixity_checks",
+		"last_fixity_check", "last_fixity_files", "last_fixity_errors",
+	})
+	for _, c := range r.Collections {
+		_ = cw.Write([]string{
+			r.Organization,
+			c.Name,
+			strconv.FormatInt(c.Files, 10),
+			strconv.FormatInt(c.Bytes, 10),
+			c.StatsTime,
+			c.FixityFrequency,
+			strconv.FormatInt(c.TargetReplication, 10),
+			strconv.FormatInt(c.FixityChecks, 10),
+			c.LastFixityCheck,
+			strconv.FormatInt(c.LastFixityFiles, 10),
+			strconv.FormatInt(c.LastFixityErrors, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteFilesCSV writes one row per file, with a header.
+func (r *Report) WriteFilesCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"collection", "path", "size", "modified", "md5", "sha1", "sha256"})
+	for _, f := range r.Files {
+		_ = cw.Write([]string{
+			f.Collection,
+			f.Path,
+			strconv.FormatInt(f.Size, 10),
+			f.Modified,
+			f.MD5,
+			f.SHA1,
+			f.SHA256,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteGeolocationsCSV writes one row per collection or subtree and
+// location, with a header. Stored bytes are bytes times copies.
+func (r *Report) WriteGeolocationsCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"organization", "collection", "path", "location", "display_name",
+		"physical_location", "copies", "bytes", "stored_bytes",
+	})
+	for _, g := range r.Geolocations {
+		_ = cw.Write([]string{
+			r.Organization,
+			g.Collection,
+			g.Path,
+			g.Location,
+			g.DisplayName,
+			g.PhysicalLocation,
+			strconv.FormatInt(g.Copies, 10),
+			strconv.FormatInt(g.Bytes, 10),
+			strconv.FormatInt(g.Bytes*g.Copies, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteUsageCSV writes one row per period and collection, with a header.
+func (r *Report) WriteUsageCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"organization", "time", "collection", "files", "bytes"})
+	for _, u := range r.Usage {
+		_ = cw.Write([]string{
+			r.Organization,
+			u.Time,
+			u.Collection,
+			strconv.FormatInt(u.Files, 10),
+			strconv.FormatInt(u.Bytes, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testReport() *Report {
+	return &Report{
+		Organization: "org",
+		Generated:    "2023-01-01T00:00:00Z",
+		Collections: []*Collection{
+			{Name: "c", Files: 2, Bytes: 10, FixityFrequency: "MONTHLY", FixityChecks: 1, LastFixityErrors: 0},
+		},
+		Files: []*File{
+			{Collection: "c", Path: "a, b.txt", Size: 10, MD5: "aa"},
+		},
+		Geolocations: []*Geolocation{
+			{Collection: "c", Path: "/c", Location: "SF", PhysicalLocation: "San Francisco", Copies: 2, Bytes: 10},
+		},
+		Usage: []*Usage{
+			{Time: "2023-01-01T00:00:00Z", Collection: "c", Files: 2, Bytes: 10},
+		},
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var (
+		r   = testReport()
+		buf bytes.Buffer
+	)
+	if err := r.WriteCollectionsCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[1] != "org,c,2,10,,MONTHLY,0,1,,0,0" {
+		t.Fatalf("unexpected collections csv: %q", buf.String())
+	}
+	buf.Reset()
+	if err := r.WriteFilesCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "collection,path,size,modified,md5,sha1,sha256\nc,\"a, b.txt\",10,,aa,,\n"; buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+	buf.Reset()
+	if err := r.WriteGeolocationsCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[1] != "org,c,/c,SF,,San Francisco,2,10,20" {
+		t.Fatalf("unexpected geolocations csv: %q", buf.String())
+	}
+	buf.Reset()
+	if err := r.WriteUsageCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "organization,time,collection,files,bytes\norg,2023-01-01T00:00:00Z,c,2,10\n"; buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var r Report
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Collections) != 1 || len(r.Files) != 1 || r.Files[0].Path != "a, b.txt" {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+}
@@ -0,0 +1,138 @@
+package retry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// StateClosed lets all calls pass.
+	StateClosed State = iota
+	// StateOpen holds back all calls until the cooldown has passed.
+	StateOpen
+	// StateHalfOpen lets calls pass again after the cooldown; the next
+	// failure opens the breaker again, the next success closes it.
+	StateHalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops calls to a service after a number of consecutive
+// failures, e.g. during a storm of server errors, for a cooldown period,
+// instead of retrying each call on its own schedule. It is safe for
+// concurrent use.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	onChange  func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	failures int       // consecutive failures
+	openedAt time.Time // when the breaker opened last
+}
+
+// BreakerOption configures a circuit breaker.
+type BreakerOption func(*CircuitBreaker)
+
+// WithStateChange calls fn on every state change, e.g. for logging. The
+// function is called with the breaker locked and must not call back into it.
+func WithStateChange(fn func(from, to State)) BreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.onChange = fn
+	}
+}
+
+// NewCircuitBreaker creates a breaker, which opens after threshold
+// consecutive failures and stays open for cooldown. A threshold of zero
+// disables the breaker, it never opens.
+func NewCircuitBreaker(threshold int, cooldown time.Duration, opts ...BreakerOption) *CircuitBreaker {
+	cb := &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+	for _, opt := range opts {
+		opt(cb)
+	}
+	return cb
+}
+
+// State returns the current state.
+func (cb *CircuitBreaker) State() State {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Wait blocks while the breaker is open, until the cooldown has passed or
+// the context is done.
+func (cb *CircuitBreaker) Wait(ctx context.Context) error {
+	for {
+		cb.mu.Lock()
+		if cb.state != StateOpen {
+			cb.mu.Unlock()
+			return nil
+		}
+		remaining := cb.cooldown - time.Since(cb.openedAt)
+		if remaining <= 0 {
+			cb.setState(StateHalfOpen)
+			cb.mu.Unlock()
+			return nil
+		}
+		cb.mu.Unlock()
+		t := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Success records a successful call, closing the breaker.
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures = 0
+	cb.setState(StateClosed)
+}
+
+// Failure records a failed call. The breaker opens, if the threshold of
+// consecutive failures is reached, or reopens, if it is half-open.
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.threshold <= 0 {
+		return
+	}
+	cb.failures++
+	if cb.state == StateHalfOpen || (cb.state == StateClosed && cb.failures >= cb.threshold) {
+		cb.openedAt = time.Now()
+		cb.setState(StateOpen)
+	}
+}
+
+// setState changes the state and calls the hook. Expects cb.mu to be held.
+func (cb *CircuitBreaker) setState(s State) {
+	if cb.state == s {
+		return
+	}
+	from := cb.state
+	cb.state = s
+	if cb.onChange != nil {
+		cb.onChange(from, s)
+	}
+}
@@ -0,0 +1,71 @@
+package retry_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/retry"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx         = context.Background()
+		transitions []string
+		cb          = retry.NewCircuitBreaker(3, 50*time.Millisecond, retry.WithStateChange(func(from, to retry.State) {
+			transitions = append(transitions, from.String()+">"+to.String())
+		}))
+	)
+	cb.Failure()
+	cb.Failure()
+	cb.Success() // resets the consecutive failures
+	cb.Failure()
+	cb.Failure()
+	if cb.State() != retry.StateClosed {
+		t.Fatalf("expected closed breaker, got %v", cb.State())
+	}
+	cb.Failure()
+	if cb.State() != retry.StateOpen {
+		t.Fatalf("expected open breaker, got %v", cb.State())
+	}
+	started := time.Now()
+	if err := cb.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("wait returned after %v, expected cooldown", elapsed)
+	}
+	// A failure while half-open opens the breaker right away.
+	cb.Failure()
+	if cb.State() != retry.StateOpen {
+		t.Fatalf("expected open breaker, got %v", cb.State())
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := cb.Wait(cctx); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if err := cb.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cb.Success()
+	want := "closed>open open>half-open half-open>open open>half-open half-open>closed"
+	if got := strings.Join(transitions, " "); got != want {
+		t.Errorf("got transitions %v, want %v", got, want)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	t.Parallel()
+
+	cb := retry.NewCircuitBreaker(0, time.Hour)
+	for i := 0; i < 100; i++ {
+		cb.Failure()
+	}
+	if cb.State() != retry.StateClosed {
+		t.Fatalf("expected closed breaker, got %v", cb.State())
+	}
+}
@@ -0,0 +1,54 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// Budget is a number of retries shared by several backoffs, e.g. by the
+// retries of all chunks of a single transfer, so a transfer gives up after a
+// maximum of cumulative retries, no matter how they are spread. It is safe
+// for concurrent use.
+type Budget struct {
+	mu   sync.Mutex
+	max  uint64
+	used uint64
+}
+
+// NewBudget creates a budget of max retries. A max of zero means unlimited
+// retries.
+func NewBudget(max uint64) *Budget {
+	return &Budget{max: max}
+}
+
+// Take uses up a single retry and returns false, if the budget is exhausted.
+func (b *Budget) Take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.max > 0 && b.used >= b.max {
+		return false
+	}
+	b.used++
+	return true
+}
+
+// Used returns the number of retries taken so far.
+func (b *Budget) Used() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// WithBudget takes a retry from the budget on each backoff and stops, once
+// the budget is exhausted. A nil budget is unlimited.
+func WithBudget(b *Budget, next Backoff) Backoff {
+	if b == nil {
+		return next
+	}
+	return BackoffFunc(func() (time.Duration, bool) {
+		if !b.Take() {
+			return 0, true
+		}
+		return next.Next()
+	})
+}
@@ -0,0 +1,52 @@
+package retry_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/retry"
+)
+
+func TestWithBudget(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		budget = retry.NewBudget(5)
+		calls  int
+	)
+	// Two operations share the budget: the first takes 3 retries, the second
+	// gives up after the remaining 2.
+	for _, fails := range []int{3, 10} {
+		i := 0
+		b := retry.WithBudget(budget, retry.NewConstant(time.Nanosecond))
+		err := retry.Do(ctx, b, func(_ context.Context) error {
+			calls++
+			if i++; i <= fails {
+				return retry.RetryableError(fmt.Errorf("oops"))
+			}
+			return nil
+		})
+		if fails == 3 && err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fails == 10 && err == nil {
+			t.Fatal("expected err")
+		}
+	}
+	if got, want := calls, 4+3; got != want {
+		t.Errorf("expected %v calls, got %v", want, got)
+	}
+	if got, want := budget.Used(), uint64(5); got != want {
+		t.Errorf("expected %v used, got %v", want, got)
+	}
+	// Zero is unlimited.
+	unlimited := retry.NewBudget(0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.Take() {
+			t.Fatal("unlimited budget exhausted")
+		}
+	}
+}
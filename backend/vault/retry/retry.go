@@ -22,7 +22,8 @@ import (
 type RetryFunc func(ctx context.Context) error
 
 type retryableError struct {
-	err error
+	err   error
+	after time.Duration
 }
 
 // RetryableError marks an error as retryable.
@@ -30,7 +31,17 @@ func RetryableError(err error) error {
 	if err == nil {
 		return nil
 	}
-	return &retryableError{err}
+	return &retryableError{err: err}
+}
+
+// RetryableErrorAfter marks an error as retryable after the given delay,
+// e.g. one requested by the server, which replaces the delay of the backoff.
+// The backoff still decides whether to retry at all.
+func RetryableErrorAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err, after: after}
 }
 
 // Unwrap implements error wrapping.
@@ -72,6 +83,9 @@ func Do(ctx context.Context, b Backoff, f RetryFunc) error {
 		if stop {
 			return rerr.Unwrap()
 		}
+		if rerr.after > 0 {
+			next = rerr.after
+		}
 
 		// ctx.Done() has priority, so we test it alone first
 		select {
@@ -205,3 +205,28 @@ func TestCancel(t *testing.T) {
 		}
 	}
 }
+
+func TestRetryableErrorAfter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := retry.WithMaxRetries(2, retry.NewConstant(time.Hour))
+
+	var i int
+	started := time.Now()
+	err := retry.Do(ctx, b, func(_ context.Context) error {
+		i++
+		return retry.RetryableErrorAfter(errors.New("throttled"), time.Millisecond)
+	})
+	if err == nil || err.Error() != "throttled" {
+		t.Fatalf("got %v, want throttled", err)
+	}
+	// The delay of the error replaces the backoff, which still limits the
+	// number of retries.
+	if got, want := i, 3; got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+	if elapsed := time.Since(started); elapsed > time.Minute {
+		t.Errorf("took %v, expected the delay of the error", elapsed)
+	}
+}
@@ -0,0 +1,103 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/rclone/rclone/backend/vault/oapi"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+)
+
+// unsafeFilenameChars are replaced, when we derive a filename from a remote name.
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// sessionFile returns the path to the persisted session of a remote. The
+// session belongs to a user on a server, so changing the endpoint or the
+// username of a remote does not pick up the session of another user.
+func sessionFile(name string, opt *Options) string {
+	h := sha256.Sum256([]byte(opt.EndpointNormalized() + "\x00" + opt.Username))
+	return filepath.Join(config.GetCacheDir(), "vault",
+		unsafeFilenameChars.ReplaceAllString(name, "_")+"-"+hex.EncodeToString(h[:8])+".session.json")
+}
+
+// cacheFile returns the path to the persistent cache of a remote.
+func cacheFile(name string) string {
+	return filepath.Join(config.GetCacheDir(), "vault", unsafeFilenameChars.ReplaceAllString(name, "_")+".cache.db")
+}
+
+// loadSession reads a persisted session, returns nil if there is none.
+func loadSession(name string, opt *Options) (*oapi.Session, error) {
+	b, err := os.ReadFile(sessionFile(name, opt))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session oapi.Session
+	if err := json.Unmarshal(b, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// saveSession persists a session, readable for the current user only.
+func saveSession(name string, opt *Options, session *oapi.Session) error {
+	filename := sessionFile(name, opt)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0600)
+}
+
+// removeSession deletes a persisted session, if any.
+func removeSession(name string, opt *Options) error {
+	err := os.Remove(sessionFile(name, opt))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// login authenticates the api. If persist_session is set, we try to resume a
+// previously saved session first and only login again, if that session is
+// not valid any more.
+func login(ctx context.Context, name string, opt *Options, api *oapi.CompatAPI) error {
+	if !opt.PersistSession {
+		return api.LoginContext(ctx)
+	}
+	session, err := loadSession(name, opt)
+	if err != nil {
+		fs.Debugf(name, "ignoring unreadable session: %v", err)
+	}
+	if session != nil {
+		if err := api.ResumeSession(session); err != nil {
+			return err
+		}
+		if _, err := api.User(ctx); err == nil {
+			fs.Debugf(name, "resumed session from %v", sessionFile(name, opt))
+			return nil
+		}
+		fs.Debugf(name, "persisted session expired, logging in again")
+	}
+	if err := api.LoginContext(ctx); err != nil {
+		return err
+	}
+	if session, err = api.Session(); err != nil || session == nil {
+		return err
+	}
+	if err := saveSession(name, opt, session); err != nil {
+		fs.Logf(name, "failed to persist session: %v", err)
+	}
+	return nil
+}
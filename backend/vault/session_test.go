@@ -0,0 +1,47 @@
+package vault
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rclone/rclone/backend/vault/oapi"
+	"github.com/rclone/rclone/fs/config"
+)
+
+func TestSessionRoundtrip(t *testing.T) {
+	dir := config.GetCacheDir()
+	defer func() { _ = config.SetCacheDir(dir) }()
+	if err := config.SetCacheDir(t.TempDir()); err != nil {
+		t.Fatalf("cannot set cache dir: %v", err)
+	}
+	const name = ":vault,endpoint=x"
+	opt := &Options{Endpoint: "http://localhost:8000/api", Username: "admin"}
+	session, err := loadSession(name, opt)
+	if err != nil || session != nil {
+		t.Fatalf("expected no session, got %v, %v", session, err)
+	}
+	session = &oapi.Session{
+		Cookies:   []*http.Cookie{{Name: "sessionid", Value: "123"}},
+		CSRFToken: "abc",
+	}
+	if err := saveSession(name, opt, session); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	loaded, err := loadSession(name, opt)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.CSRFToken != "abc" || len(loaded.Cookies) != 1 || loaded.Cookies[0].Value != "123" {
+		t.Fatalf("got %v, want %v", loaded, session)
+	}
+	other := &Options{Endpoint: opt.Endpoint, Username: "other"}
+	if session, _ := loadSession(name, other); session != nil {
+		t.Fatalf("expected no session for another user, got %v", session)
+	}
+	if err := removeSession(name, opt); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if session, _ = loadSession(name, opt); session != nil {
+		t.Fatalf("session not removed")
+	}
+}
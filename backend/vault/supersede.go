@@ -0,0 +1,58 @@
+package vault
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/backend/vault/oapi"
+	"github.com/rclone/rclone/fs"
+)
+
+// Update modes, cf. update_mode option.
+const (
+	updateModeReplace = "replace"
+	updateModeVersion = "version"
+)
+
+// supersede records that the file t at the absolute path p has been
+// uploaded again in the inflight deposit into its directory. Without such a
+// deposit, e.g. after a concurrent finalize, the file is kept.
+func (f *Fs) supersede(p string, t *api.TreeNode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := f.depositByPath(p)
+	if d == nil {
+		fs.Logf(f, "keeping superseded file %v: deposit already finalized", p)
+		return
+	}
+	d.superseded[p] = t
+}
+
+// removeSuperseded removes files, that have been replaced by a file at the
+// same path in a finalized deposit. A file is only removed, if we find a new
+// file at its path; files not yet assembled by vault are kept. Expects f.mu
+// to be held.
+func (f *Fs) removeSuperseded(ctx context.Context, superseded map[string]*api.TreeNode) {
+	for p, old := range superseded {
+		t, err := f.api.ResolvePath(ctx, p)
+		switch {
+		case errors.Is(err, oapi.ErrAmbiguousQuery):
+			// The new file has been added next to the old one.
+		case err != nil:
+			fs.Logf(f, "keeping superseded file %v: %v", p, err)
+			continue
+		case t.ID == old.ID:
+			fs.Logf(f, "keeping superseded file %v: new version not yet stored", p)
+			continue
+		default:
+			// The server replaced the file, nothing left to do.
+			continue
+		}
+		if err := f.api.Remove(ctx, old); err != nil {
+			fs.Logf(f, "could not remove superseded file %v: %v", p, err)
+			continue
+		}
+		fs.Debugf(f, "removed superseded file %v [%v]", p, old.ID)
+	}
+}
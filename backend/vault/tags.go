@@ -0,0 +1,73 @@
+package vault
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/rclone/rclone/fs/config"
+)
+
+// tagsMu serializes access to the tags files.
+var tagsMu sync.Mutex
+
+// tagsFile returns the path to the deposit tags recorded by a remote. The
+// deposit API has no place for tags, so we keep them locally.
+func tagsFile(name string) string {
+	return filepath.Join(config.GetCacheDir(), "vault", unsafeFilenameChars.ReplaceAllString(name, "_")+".tags.json")
+}
+
+// loadDepositTags returns the recorded tags by deposit id.
+func loadDepositTags(name string) (map[string][]string, error) {
+	tagsMu.Lock()
+	defer tagsMu.Unlock()
+	return readDepositTags(name)
+}
+
+// readDepositTags reads the tags file, expects tagsMu to be held.
+func readDepositTags(name string) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	b, err := os.ReadFile(tagsFile(name))
+	if os.IsNotExist(err) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// recordDepositTags records the tags of a deposit.
+func recordDepositTags(name string, id int, tags []string) error {
+	tagsMu.Lock()
+	defer tagsMu.Unlock()
+	all, err := readDepositTags(name)
+	if err != nil {
+		return err
+	}
+	all[strconv.Itoa(id)] = tags
+	filename := tagsFile(name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0600)
+}
+
+// hasTag returns true, if tag is one of tags.
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -11,24 +11,34 @@ import (
 	"mime"
 	"mime/multipart"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
 	"os"
 	"path"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/backend/vault/cache"
 	"github.com/rclone/rclone/backend/vault/iotemp"
 	"github.com/rclone/rclone/backend/vault/oapi"
+	"github.com/rclone/rclone/backend/vault/pathutil"
 	"github.com/rclone/rclone/backend/vault/retry"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/fshttp"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/encoder"
+	"github.com/rclone/rclone/lib/oauthutil"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/terminal"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -69,6 +79,10 @@ const (
 	// would be glad to have a short in person debug session (where we can try
 	// to replicate the issue in prod together, or the like)
 	defaultUploadChunkSize = 1 << 20 // 1M
+	defaultMinSleep        = fs.Duration(10 * time.Millisecond)
+	progressInterval       = 10 * time.Second // time between progress messages
+	maxSleep               = 2 * time.Second
+	decayConstant          = 2 // bigger for slower decay, exponential
 )
 
 func init() {
@@ -76,40 +90,603 @@ func init() {
 		Name:        "vault",
 		Description: "Internet Archive Vault Digital Preservation System",
 		NewFs:       NewFs,
-		Options: []fs.Option{
+		CommandHelp: commandHelp,
+		Config:      vaultConfig,
+		MetadataInfo: &fs.MetadataInfo{
+			System: systemMetadataInfo,
+			Help: `Vault checks the fixity of files per collection, on a schedule set by
+the fixity frequency of the collection. Files carry the time and outcome
+of the latest check of their collection and the time the next check is
+due, e.g. to flag collections with overdue or failed checks, with
+"rclone lsjson -M".
+
+Metadata is read only. The vault server does not allow changing the
+comment of a file, so "--metadata-set comment=..." is rejected.
+`,
+		},
+		Options: append([]fs.Option{
 			{
 				Name:    "username",
 				Help:    "Vault username",
 				Default: "",
 			},
 			{
-				Name:    "password",
-				Help:    "Vault password",
-				Default: "",
+				Name:       "password",
+				Help:       "Vault password",
+				Default:    "",
+				IsPassword: true,
 			},
 			{
 				Name:    "endpoint",
 				Help:    "Vault API endpoint URL",
 				Default: "http://127.0.0.1:8000/api",
 			},
+			{
+				Name:      "api_key",
+				Help:      "Vault API token, if set username and password are not used for login",
+				Default:   "",
+				Sensitive: true,
+			},
+			{
+				Name:    "organization",
+				Help:    "Organization name, if the user can access more than one organization; defaults to the organization of the user",
+				Default: "",
+			},
+			{
+				Name: "user_agent_suffix",
+				Help: `Identifier appended to the User-Agent of all requests
+
+E.g. an institution or ingest job, like "ACME-Archives/nightly-ingest", so
+traffic can be attributed to specific ingest pipelines in the server logs.
+Ignored, if --user-agent is set.`,
+				Default:  "",
+				Advanced: true,
+			},
 			{
 				Name:     "chunk_size",
 				Help:     "Upload chunk size in bytes (limited)",
 				Default:  defaultUploadChunkSize,
 				Advanced: true,
 			},
-		},
+			{
+				Name: "max_parallel_chunks",
+				Help: `Number of chunks of a single file sent in parallel
+
+Each chunk in flight is kept in memory, so this uses up to
+(max_parallel_chunks + chunk_read_ahead) * chunk_size memory per file.`,
+				Default:  1,
+				Advanced: true,
+			},
+			{
+				Name: "chunk_read_ahead",
+				Help: `Number of chunks of a single file read ahead of sending
+
+Chunks are read from the source while earlier chunks are sent, so slow
+source I/O overlaps with the network upload. Set to 0 to read the next chunk
+only after a chunk was sent.`,
+				Default:  1,
+				Advanced: true,
+			},
+			{
+				Name: "max_parallel_uploads",
+				Help: `Number of files uploaded in parallel, 0 for no limit
+
+By default, the number of parallel uploads is governed by --transfers.`,
+				Default:  0,
+				Advanced: true,
+			},
+			{
+				Name: "use_keyring",
+				Help: `Read password and api_key from the system keyring, if not set in the config
+
+Secrets are looked up with service "rclone-vault" and the account
+"<remote>/password" or "<remote>/api_key", using secret-tool on Linux,
+the Keychain on macOS and the Credential Manager on Windows.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name:     "pacer_min_sleep",
+				Help:     "Minimum time to sleep between API calls",
+				Default:  defaultMinSleep,
+				Advanced: true,
+			},
+			{
+				Name: "log_requests",
+				Help: `Log every API request with a correlation id, method, path, status and duration
+
+The correlation id is sent in the X-Request-ID header as well, which helps
+to match a failed deposit with the server logs. Lines go to the debug log
+(use -vv), unless log_requests_file is set.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name:     "log_requests_file",
+				Help:     "Append the request log to this file instead of the debug log",
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name: "dump_http",
+				Help: `Record failed requests to this file, e.g. for vault support
+
+Requests failing with an error or an HTTP status of 400 or above are
+recorded with headers and the start of text bodies; credentials, cookies and
+passwords are removed and uploaded file data is omitted. A file ending in
+.har is written in the HTTP Archive format, otherwise one JSON object per
+line. The file is replaced on each run.`,
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name:     config.ConfigEncoding,
+				Help:     config.ConfigEncodingHelp,
+				Advanced: true,
+				Default: (encoder.Base |
+					encoder.EncodeCtl |
+					encoder.EncodeDel |
+					encoder.EncodeLeftSpace |
+					encoder.EncodeLeftCrLfHtVt |
+					encoder.EncodeRightSpace |
+					encoder.EncodeRightCrLfHtVt |
+					encoder.EncodeInvalidUtf8),
+			},
+			{
+				Name:     "persist_session",
+				Help:     "Keep the login session in the cache dir and reuse it across invocations",
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "sanitize_paths",
+				Help: `Rewrite names that vault cannot store instead of failing the upload
+
+Characters not allowed in XML become "_", as does leading and trailing
+whitespace; overlong names are shortened and get a short hash suffix. The
+original name is recorded in the metadata of the file, once the server
+assembled the file after finalize. If that fails, the transfer fails.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "encrypt_spool",
+				Help: `Encrypt data spooled to disk before upload
+
+Objects of unknown size are spooled to a temporary file first. With this
+option set, these files are encrypted with a key that only exists in
+memory for the lifetime of the process.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "temp_dir",
+				Help: `Directory for spool files, defaults to the system temp dir
+
+Objects of unknown size are spooled before upload, which may not fit into
+a small /tmp. The directory is checked for free space on startup.`,
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name: "temp_cleanup_age",
+				Help: `Remove leftover spool files older than this on startup
+
+Crashed or killed runs may leave "rclone-vault-transit-*" files in the
+temporary directory. Set to 0 to disable.`,
+				Default:  fs.Duration(0),
+				Advanced: true,
+			},
+			{
+				Name: "cache_ttl",
+				Help: `Keep resolved paths and listings in a cache file for this long
+
+This speeds up repeated listings of large, static collections. The cache
+is kept in the rclone cache dir and cleared on every change done through
+this remote. Set to 0 to disable.`,
+				Default:  fs.Duration(0),
+				Advanced: true,
+			},
+			{
+				Name: "prefetch_listing",
+				Help: `Fetch the whole tree below the root before the first lookup
+
+A sync checks every source file for an existing file in vault. With this
+option set, all treenodes below the root are fetched with a few paginated
+requests up front, and these checks and listings are answered from memory
+until the next change. This needs memory for every file below the root, so
+point the remote at a collection or folder, not the organization.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "hash_wait",
+				Help: `Wait up to this long for the hashes of recently deposited files
+
+Vault computes the hashes of a file only after the deposit has been
+processed, so a "rclone check" or a "--checksum" sync right after an upload
+sees no hashes. With this option set, asking for a missing hash of a file
+uploaded within the last day polls the server until the hash appears or this
+time has passed. Set to 0 to disable.`,
+				Default:  fs.Duration(0),
+				Advanced: true,
+			},
+			{
+				Name: "uniquify_duplicates",
+				Help: `Rename files that would overwrite another file of the same deposit
+
+Different source files can map to the same name in vault, e.g. after
+sanitize_paths or normalization. By default such an upload fails; with
+this option set, a "-1", "-2", ... suffix is added before the extension.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "normalization",
+				Help: `Unicode normalization applied to names on upload and listing
+
+Files from macOS usually use NFD, files from Linux NFC, which can result
+in duplicate-looking entries in vault.`,
+				Default: "none",
+				Examples: []fs.OptionExample{{
+					Value: "none",
+					Help:  "Keep names as they are",
+				}, {
+					Value: "nfc",
+					Help:  "Canonical composition, common on Linux and Windows",
+				}, {
+					Value: "nfd",
+					Help:  "Canonical decomposition, common on macOS",
+				}},
+				Advanced: true,
+			},
+			{
+				Name: "on_finalize_url",
+				Help: `URL to POST a JSON summary to, when a deposit is finalized
+
+The summary contains the deposit id, the number of files and bytes, the
+status and the duration of the deposit. A failed notification is logged,
+but does not fail the transfer.`,
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name: "auto_collection",
+				Help: `Collection to use when copying files to the organization root
+
+Files cannot be stored outside of a collection. Without this, files below
+collections go into a deposit per collection, e.g. when syncing several
+collections to the root. If set, copying to the root uploads into this
+collection instead, which is created if needed. "{source}" is replaced
+with the name of the source directory and "{date}" with the current date,
+e.g. "{source}" or "import-{date}".`,
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name: "ignore_version_mismatch",
+				Help: `Warn about an incompatible Vault API version, instead of failing
+
+Use this during server upgrades, if the API is known to be compatible.
+The server is then treated as if it implemented the supported version.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "suppress_progress_bar",
+				Help: `Do not log the progress of deposits
+
+By default, the number of files and bytes sent to a deposit is logged
+every 10 seconds.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "deposit_title",
+				Help: `Title of deposits made with this remote
+
+The deposit API does not take descriptive metadata, so the title, the
+description and the accession number are stored, together with the
+deposit id, in the metadata of every file of the deposit, once the
+server assembled the files after finalize. This takes extra requests per
+file and waits up to 10 minutes for the files to appear.`,
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name:     "deposit_description",
+				Help:     "Description of deposits made with this remote, see deposit_title",
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name:     "deposit_accession_number",
+				Help:     "Accession number of deposits made with this remote, see deposit_title",
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name: "deposit_tags",
+				Help: `Comma separated list of tags of deposits made with this remote
+
+Tags group deposits, e.g. by project, grant or accession batch. The
+deposit API has no place for tags, so they are recorded with the id of
+the registered deposit in the rclone cache dir, from where
+vault/deposits/list shows and filters deposits by tag.`,
+				Default:  fs.CommaSepList{},
+				Advanced: true,
+			},
+			{
+				Name: "no_quota_check",
+				Help: `Do not check the remaining quota before starting a deposit
+
+Before a deposit is registered, the size of the transfer, as far as known
+from the files queued by rclone and --max-transfer, is compared with the
+remaining quota of the organization and the transfer fails early, if it
+does not fit.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "no_prescan",
+				Help: `Do not validate all paths of the source before the first upload
+
+Before the first upload, the source is listed and every path is checked,
+so that names vault cannot store abort the transfer right away, with a
+list of all offending files, instead of failing one upload at a time.
+This is skipped, if sanitize_paths is set.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "manifest_path",
+				Help: `Local file to write a JSON manifest of the deposited files to
+
+After each finalized deposit, this file is rewritten with a list of all
+deposits finalized in this run, each with the path in vault, the source
+remote, size, checksums and flow identifier of every file.`,
+				Default:  "",
+				Advanced: true,
+			},
+			{
+				Name: "immutable",
+				Help: `Refuse to overwrite existing files
+
+For write-once archival policies: uploading to a path that already
+exists in vault fails, as does updating an existing file.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "update_mode",
+				Help: `What happens to the previous file, when a file is updated
+
+An update uploads the file again, in a new deposit.`,
+				Default: updateModeReplace,
+				Examples: []fs.OptionExample{{
+					Value: updateModeReplace,
+					Help:  "Remove the previous file, once the new one is stored",
+				}, {
+					Value: updateModeVersion,
+					Help:  "Keep the previous file, if vault retains it as a prior version",
+				}},
+				Advanced: true,
+			},
+			{
+				Name: "version_at",
+				Help: `Read files as they were at the specified time
+
+If vault retains previous versions of files, cf. update_mode, read the
+latest version uploaded at or before this time. The parameter should be
+a date, "2006-01-02", datetime "2006-01-02 15:04:05" or a duration for
+that long ago, eg "100d" or "1h". Files cannot be uploaded or deleted in
+this mode. Use the "versions" command to list all versions of a file.`,
+				Default:  fs.Time{},
+				Advanced: true,
+			},
+			{
+				Name: "collection_fixity_frequency",
+				Help: `Fixity check frequency of collections created by rclone
+
+Leave empty to use the default of the plan. Existing collections are
+not changed.`,
+				Default: "",
+				Examples: []fs.OptionExample{{
+					Value: "TWICE_YEARLY",
+					Help:  "Twice a year",
+				}, {
+					Value: "QUARTERLY",
+					Help:  "Every three months",
+				}, {
+					Value: "MONTHLY",
+					Help:  "Every month",
+				}},
+				Advanced: true,
+			},
+			{
+				Name: "collection_target_replication",
+				Help: `Number of copies kept of collections created by rclone
+
+Leave at 0 to use the default of the plan. Existing collections are not
+changed. Target geolocations cannot be set through the API and need to
+be configured in the web interface.`,
+				Default: 0,
+				Examples: []fs.OptionExample{{
+					Value: "2",
+					Help:  "Two copies",
+				}, {
+					Value: "3",
+					Help:  "Three copies",
+				}, {
+					Value: "4",
+					Help:  "Four copies",
+				}},
+				Advanced: true,
+			},
+			{
+				Name: "chunk_timeout",
+				Help: `Maximum time to upload a single chunk, including all retries
+
+Set to 0 for no limit.`,
+				Default:  fs.Duration(UploadChunkTimeout),
+				Advanced: true,
+			},
+			{
+				Name: "chunk_attempt_timeout",
+				Help: `Maximum time of a single attempt to upload a chunk
+
+An attempt taking longer, e.g. on a hung connection, is aborted and retried,
+within chunk_timeout. Set to 0 for no limit.`,
+				Default:  fs.Duration(UploadChunkAttemptTimeout),
+				Advanced: true,
+			},
+			{
+				Name: "shutdown_timeout",
+				Help: `Maximum time to finalize or terminate a deposit on exit
+
+If vault does not respond in time, rclone exits and the deposit stays
+registered; it can be finalized later with "rclone rc --loopback
+vault/deposits/finalize". Set to 0 to wait indefinitely.`,
+				Default:  fs.Duration(5 * time.Minute),
+				Advanced: true,
+			},
+			{
+				Name: "on_interrupt",
+				Help: `What happens to the inflight deposit, when rclone is interrupted
+
+A deposit is finalized on normal exit. When interrupted, e.g. with
+CTRL-C, the deposit is terminated by default and files uploaded so far
+are discarded.`,
+				Default: onInterruptTerminate,
+				Examples: []fs.OptionExample{{
+					Value: onInterruptTerminate,
+					Help:  "Terminate the deposit, discarding uploaded files",
+				}, {
+					Value: onInterruptFinalize,
+					Help:  "Finalize the deposit, keeping the files uploaded completely",
+				}, {
+					Value: onInterruptAsk,
+					Help:  "Ask, if running in a terminal, terminate otherwise",
+				}},
+				Advanced: true,
+			},
+			{
+				Name: "on_disconnect",
+				Help: `What happens to the inflight deposit on "rclone config disconnect"
+
+Logging out invalidates the session, so a deposit left inflight could not
+be finalized later. If finalizing or terminating the deposit fails, the
+user stays logged in.`,
+				Default: onDisconnectFinalize,
+				Examples: []fs.OptionExample{{
+					Value: onDisconnectFinalize,
+					Help:  "Finalize the deposit, keeping the files uploaded completely",
+				}, {
+					Value: onDisconnectTerminate,
+					Help:  "Terminate the deposit, discarding uploaded files",
+				}},
+				Advanced: true,
+			},
+			{
+				Name: "deposit_api",
+				Help: `Version of the deposit API used for uploads
+
+Leave empty to use the latest version supported.`,
+				Default: "",
+				Examples: []fs.OptionExample{{
+					Value: "v2",
+					Help:  "Chunked uploads via /api/deposits/v2/",
+				}},
+				Advanced: true,
+			},
+			{
+				Name: "chunk_retry_budget",
+				Help: `Maximum number of chunk upload retries per file
+
+All chunks of a file share this number of retries, so an upload gives up
+after the budget is used, however the failures are spread. Set to 0 for
+unlimited retries.`,
+				Default:  0,
+				Advanced: true,
+			},
+			{
+				Name: "breaker_threshold",
+				Help: `Number of consecutive server errors pausing all chunk uploads
+
+After this many chunk uploads in a row failed with a server error, chunk
+uploads pause for breaker_cooldown instead of retrying each chunk on its own,
+e.g. during server maintenance. Set to 0 to disable.`,
+				Default:  10,
+				Advanced: true,
+			},
+			{
+				Name:     "breaker_cooldown",
+				Help:     "Time chunk uploads pause after breaker_threshold consecutive server errors.",
+				Default:  fs.Duration(time.Minute),
+				Advanced: true,
+			},
+			{
+				Name: "retry_statuses",
+				Help: `Comma separated list of HTTP statuses of chunk uploads to retry
+
+Chunk uploads failing with a server error (5xx), or with 429 and a
+Retry-After header, are retried, other client errors (4xx) are fatal. Proxies
+and gateways may respond with other statuses during long deposits, e.g.
+408,409,423,429, which can be retried by listing them here.`,
+				Default:  fs.CommaSepList{},
+				Advanced: true,
+			},
+			{
+				Name: "no_retry_statuses",
+				Help: `Comma separated list of HTTP statuses of chunk uploads not to retry
+
+Chunk uploads failing with one of these statuses fail at once, even if the
+status is a server error, e.g. 501.`,
+				Default:  fs.CommaSepList{},
+				Advanced: true,
+			},
+		}, oauthutil.SharedOptions...),
 	})
 }
 
-const flowIdentifierPrefix = "rclone-vault-flow"
+// oauthConfig is empty, as there is no default identity provider for vault;
+// client id, secret, auth and token URL are all taken from the config.
+var oauthConfig = &oauthutil.Config{}
+
+const (
+	flowIdentifierPrefix = "rclone-vault-flow"
+	// maxMemorySpoolSize is the largest object of unknown size we keep in
+	// memory before upload, larger objects are spooled to disk.
+	maxMemorySpoolSize = 16 << 20
+	// maxDepositRegistrations limits the number of new deposits registered
+	// for a single file, if the server completes deposits early.
+	maxDepositRegistrations = 3
+	// on_interrupt values
+	onInterruptTerminate = "terminate"
+	onInterruptFinalize  = "finalize"
+	onInterruptAsk       = "ask"
+	// on_disconnect values
+	onDisconnectFinalize  = "finalize"
+	onDisconnectTerminate = "terminate"
+	// listBatchSize is the maximum number of entries passed to a ListR
+	// callback at once.
+	listBatchSize = 500
+)
 
 var (
 	ErrCannotCopyToRoot         = errors.New("copying files to root is not supported in vault")
 	ErrInvalidPath              = errors.New("invalid path")
 	ErrVersionMismatch          = errors.New("api version mismatch")
+	ErrUploadsUnsupported       = errors.New("uploads are not supported by this vault api version, please upgrade vault")
 	ErrMissingDepositIdentifier = errors.New("missing deposit identifier")
 	ErrInvalidEndpoint          = errors.New("invalid endpoint")
+	ErrDuplicateRemote          = errors.New("duplicate name in deposit")
+	ErrDepositClosed            = errors.New("deposit does not accept uploads anymore")
+	ErrImmutable                = errors.New("refusing to overwrite existing file in immutable mode")
+	ErrCollectionNotRemovable   = errors.New("the vault server does not allow removing this collection")
+	ErrTerminated               = errors.New("deposits were stopped on interrupt")
+	ErrPasswordNotObscured      = errors.New("password in config is not obscured")
+	ErrCommentUnsupported       = errors.New("setting comments is not supported, the vault server treats the comment of a file as immutable")
 
 	VersionMismatchMessage = `
 
@@ -131,9 +708,14 @@ For more information about Vault visit https://webservices.archive.org/pages/vau
 
 `
 
-	UploadChunkTimeout     = 24 * time.Hour         // generous limit for single chunk upload time (should never be hit)
-	UploadChunkBackoffBase = 100 * time.Millisecond // backoff base timeout
-	UploadChunkBackoffCap  = 30 * time.Second       // max backoff interval
+	// spoolCleanupOnce registers the removal of spool files on interrupt.
+	spoolCleanupOnce sync.Once
+
+	UploadChunkTimeout        = 24 * time.Hour         // generous default limit for single chunk upload time (should never be hit)
+	UploadChunkAttemptTimeout = 10 * time.Minute       // default limit for a single attempt of a chunk upload
+	UploadChunkBackoffBase    = 100 * time.Millisecond // backoff base timeout
+	UploadChunkBackoffCap     = 30 * time.Second       // max backoff interval
+	DepositAssemblyWait       = 10 * time.Minute       // limit for waiting for the files of a finalized deposit to appear
 )
 
 // NewFS sets up a new filesystem for vault, with deposits/v2 support.
@@ -143,59 +725,225 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	if err != nil {
 		return nil, err
 	}
-	api, err := oapi.New(opt.EndpointNormalized(), opt.Username, opt.Password)
+	normalization, err := pathutil.ParseNormalization(opt.Normalization)
+	if err != nil {
+		return nil, err
+	}
+	err = checkCollectionSettings(oapi.CollectionSettings{
+		FixityFrequency:   opt.CollectionFixityFrequency,
+		TargetReplication: opt.CollectionTargetReplication,
+	})
 	if err != nil {
 		return nil, err
 	}
-	if err := api.Login(); err != nil {
+	retryStatuses, noRetryStatuses, err := parseRetryStatuses(opt.RetryStatuses, opt.NoRetryStatuses)
+	if err != nil {
 		return nil, err
 	}
-	if v := api.Version(ctx); v != "" && v != api.VersionSupported {
-		fmt.Fprintf(os.Stderr, VersionMismatchMessage, api.Version(ctx), api.VersionSupported)
-		return nil, ErrVersionMismatch
+	if err := iotemp.CheckDir(opt.TempDir, maxMemorySpoolSize); err != nil {
+		if !errors.Is(err, iotemp.ErrInsufficientSpace) {
+			return nil, fmt.Errorf("invalid temp_dir: %w", err)
+		}
+		fs.Logf(name, "%v", err)
+	}
+	if opt.TempCleanupAge > 0 {
+		removed, err := iotemp.RemoveOrphans(opt.TempDir, time.Duration(opt.TempCleanupAge))
+		if err != nil {
+			fs.Logf(name, "failed to remove leftover spool files: %v", err)
+		}
+		for _, filename := range removed {
+			fs.Infof(name, "removed leftover spool file %v", filename)
+		}
+	}
+	spoolCleanupOnce.Do(func() {
+		atexit.Register(iotemp.RemoveSpoolFiles)
+	})
+	if opt.Password != "" {
+		if opt.Password, err = obscure.Reveal(opt.Password); err != nil {
+			// Older versions stored the password in plain text.
+			return nil, fmt.Errorf("%w (%v): re-enter the password with \"rclone config\" or replace it with the output of \"rclone obscure\"",
+				ErrPasswordNotObscured, err)
+		}
+	}
+	if opt.UseKeyring {
+		if err := credentialsFromKeyring(name, &opt); err != nil {
+			return nil, err
+		}
+	}
+	// Use rclone's HTTP client, so TLS, proxy, timeout and user agent flags
+	// apply to vault as well. The client forces its user agent on every
+	// request, so unless set by flag, it is the vault one.
+	userAgent := oapi.UserAgent(opt.UserAgentSuffix)
+	clientCtx, ci := fs.AddConfig(ctx)
+	if fs.ConfigOptionsInfo.Get("user_agent").IsDefault() {
+		ci.UserAgent = userAgent
+	}
+	apiOpts := []oapi.Option{
+		oapi.WithClient(fshttp.NewClient(clientCtx)),
+		oapi.WithUserAgent(userAgent),
+		oapi.WithPacer(fs.NewPacer(ctx, pacer.NewDefault(
+			pacer.MinSleep(opt.PacerMinSleep),
+			pacer.MaxSleep(maxSleep),
+			pacer.DecayConstant(decayConstant)))),
+	}
+	switch {
+	case opt.APIKey != "":
+		apiOpts = append(apiOpts, oapi.WithAPIKey(opt.APIKey))
+	case opt.TokenURL != "":
+		client, _, err := oauthutil.NewClient(clientCtx, name, m, oauthConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure vault oauth: %w", err)
+		}
+		apiOpts = append(apiOpts, oapi.WithOAuthClient(client))
+	}
+	if opt.Organization != "" {
+		apiOpts = append(apiOpts, oapi.WithOrganization(opt.Organization))
 	}
-	// V2 is the current deposit API: /api/deposits/v2/
-	var depositsV2Client *ClientWithResponses
-	endpoint, err := opt.EndpointNormalizedDepositsV2()
+	if opt.LogRequests {
+		var w io.Writer // nil logs to the debug log
+		if opt.LogRequestsFile != "" {
+			// Kept open for the lifetime of the process.
+			if w, err = os.OpenFile(opt.LogRequestsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+				return nil, fmt.Errorf("cannot open request log: %w", err)
+			}
+		}
+		apiOpts = append(apiOpts, oapi.WithRequestLog(w))
+	}
+	if opt.DumpHTTP != "" {
+		// Kept open for the lifetime of the process.
+		d, err := oapi.NewHTTPDump(opt.DumpHTTP)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open http dump: %w", err)
+		}
+		apiOpts = append(apiOpts, oapi.WithHTTPDump(d))
+	}
+	var persistent *cache.Persistent
+	if opt.CacheTTL > 0 {
+		if persistent, err = cache.OpenPersistent(cacheFile(name), time.Duration(opt.CacheTTL)); err != nil {
+			fs.Logf(name, "persistent cache disabled: %v", err)
+		} else {
+			apiOpts = append(apiOpts, oapi.WithPersistentCache(persistent))
+		}
+	}
+	api, err := oapi.New(opt.EndpointNormalized(), opt.Username, opt.Password, apiOpts...)
 	if err != nil {
 		return nil, err
 	}
-	depositsV2Client, err = NewClientWithResponses(endpoint,
-		WithHTTPClient(api.Client()))
+	if err := login(ctx, name, &opt, api); err != nil {
+		return nil, err
+	}
+	apiFeatures, err := api.Negotiate(ctx)
+	if err != nil {
+		fs.Debugf(name, "%v", err)
+		if !opt.IgnoreVersionMismatch {
+			fmt.Fprintf(os.Stderr, VersionMismatchMessage, api.Version(ctx), api.VersionSupported)
+			return nil, ErrVersionMismatch
+		}
+		// Assume the server speaks the api version we implement.
+		fs.Logf(name, "ignoring api version mismatch, server %v, supported %v: things may break",
+			api.Version(ctx), api.VersionSupported)
+		if apiFeatures, err = oapi.FeaturesForVersion(""); err != nil {
+			return nil, err
+		}
+	}
+	depositor, err := newDepositor(&opt, api)
 	if err != nil {
 		return nil, err
 	}
 	f := &Fs{
-		name:             name,
-		root:             root,
-		opt:              opt,
-		api:              api,
-		depositsV2Client: depositsV2Client, // TODO: remove this doubling of API and then another client for the deposit
-	}
+		name:        name,
+		root:        root,
+		opt:         opt,
+		api:         api,
+		apiFeatures: apiFeatures,
+		norm:        normalization,
+		persistent:  persistent,
+		depositor:   depositor,
+
+		retryStatuses:   retryStatuses,
+		noRetryStatuses: noRetryStatuses,
+	}
+	f.breaker = retry.NewCircuitBreaker(opt.BreakerThreshold, time.Duration(opt.BreakerCooldown),
+		retry.WithStateChange(f.breakerChanged))
 	f.features = (&fs.Features{
 		CanHaveEmptyDirectories: true,
 		ReadMimeType:            true,
+		ReadMetadata:            true,
 		SlowModTime:             true,
 		About:                   f.About,
 		DirMove:                 f.DirMove,
 		Disconnect:              f.Disconnect,
+		ListR:                   f.ListR,
 		PublicLink:              f.PublicLink,
 		Purge:                   f.Purge,
 		PutStream:               f.PutStream,
 		Shutdown:                f.Shutdown,
 		UserInfo:                f.UserInfo,
 	}).Fill(ctx, f)
-	f.atexit = atexit.Register(f.Terminate)
+	if opt.MaxParallelUploads > 0 {
+		f.uploadTokens = pacer.NewTokenDispenser(opt.MaxParallelUploads)
+	}
+	f.registerAtexit()
 	return f, nil
 }
 
 // Options for Vault.
 type Options struct {
-	Username        string `config:"username"`
-	Password        string `config:"password"`
-	Endpoint        string `config:"endpoint"`          // e.g. http://localhost:8000/api
-	ResumeDepositId int64  `config:"resume_deposit_id"` // TODO: can we remove this?
-	ChunkSize       int64  `config:"chunk_size"`
+	Username                    string               `config:"username"`
+	Password                    string               `config:"password"`
+	Endpoint                    string               `config:"endpoint"`          // e.g. http://localhost:8000/api
+	APIKey                      string               `config:"api_key"`           // token auth, bypasses login
+	TokenURL                    string               `config:"token_url"`         // if set, use oauth2
+	ResumeDepositId             int64                `config:"resume_deposit_id"` // TODO: can we remove this?
+	ChunkSize                   int64                `config:"chunk_size"`
+	MaxParallelChunks           int                  `config:"max_parallel_chunks"`
+	ChunkReadAhead              int                  `config:"chunk_read_ahead"`
+	ChunkTimeout                fs.Duration          `config:"chunk_timeout"`
+	ChunkAttemptTimeout         fs.Duration          `config:"chunk_attempt_timeout"`
+	MaxParallelUploads          int                  `config:"max_parallel_uploads"`
+	PersistSession              bool                 `config:"persist_session"`
+	Organization                string               `config:"organization"` // if empty, use organization of user
+	UseKeyring                  bool                 `config:"use_keyring"`
+	PacerMinSleep               fs.Duration          `config:"pacer_min_sleep"`
+	LogRequests                 bool                 `config:"log_requests"`
+	LogRequestsFile             string               `config:"log_requests_file"`
+	DumpHTTP                    string               `config:"dump_http"`
+	UserAgentSuffix             string               `config:"user_agent_suffix"`
+	Enc                         encoder.MultiEncoder `config:"encoding"`
+	SanitizePaths               bool                 `config:"sanitize_paths"`
+	Normalization               string               `config:"normalization"`
+	Uniquify                    bool                 `config:"uniquify_duplicates"`
+	CacheTTL                    fs.Duration          `config:"cache_ttl"`
+	PrefetchListing             bool                 `config:"prefetch_listing"`
+	HashWait                    fs.Duration          `config:"hash_wait"`
+	EncryptSpool                bool                 `config:"encrypt_spool"`
+	TempCleanupAge              fs.Duration          `config:"temp_cleanup_age"`
+	TempDir                     string               `config:"temp_dir"`
+	OnFinalizeURL               string               `config:"on_finalize_url"`
+	AutoCollection              string               `config:"auto_collection"`
+	IgnoreVersionMismatch       bool                 `config:"ignore_version_mismatch"`
+	SuppressProgressBar         bool                 `config:"suppress_progress_bar"`
+	DepositTitle                string               `config:"deposit_title"`
+	DepositDescription          string               `config:"deposit_description"`
+	DepositAccessionNumber      string               `config:"deposit_accession_number"`
+	DepositTags                 fs.CommaSepList      `config:"deposit_tags"`
+	NoQuotaCheck                bool                 `config:"no_quota_check"`
+	NoPrescan                   bool                 `config:"no_prescan"`
+	ManifestPath                string               `config:"manifest_path"`
+	Immutable                   bool                 `config:"immutable"`
+	UpdateMode                  string               `config:"update_mode"`
+	VersionAt                   fs.Time              `config:"version_at"`
+	CollectionFixityFrequency   string               `config:"collection_fixity_frequency"`
+	CollectionTargetReplication int                  `config:"collection_target_replication"`
+	ShutdownTimeout             fs.Duration          `config:"shutdown_timeout"`
+	OnInterrupt                 string               `config:"on_interrupt"`
+	OnDisconnect                string               `config:"on_disconnect"`
+	DepositAPI                  string               `config:"deposit_api"`
+	ChunkRetryBudget            int                  `config:"chunk_retry_budget"`
+	BreakerThreshold            int                  `config:"breaker_threshold"`
+	BreakerCooldown             fs.Duration          `config:"breaker_cooldown"`
+	RetryStatuses               fs.CommaSepList      `config:"retry_statuses"`
+	NoRetryStatuses             fs.CommaSepList      `config:"no_retry_statuses"`
 }
 
 // EndpointNormalized handles trailing slashes.
@@ -215,22 +963,49 @@ func (opt Options) EndpointNormalizedDepositsV2() (string, error) {
 	return u, nil
 }
 
+// DepositURL returns the link to a deposit in the vault web interface, which
+// is served from the same host as the api.
+func (opt Options) DepositURL(id int) string {
+	u, err := opt.EndpointNormalizedDepositsV2()
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/deposits/%d/", u, id)
+}
+
 // Fs is the main Vault filesystem. Most operations are accessed through the
 // api.
 type Fs struct {
-	name     string
-	root     string
-	opt      Options         // vault options
-	api      *oapi.CompatAPI // compat api, wrapper around oapi, exposing legacy methods; TODO: get rid of this
-	features *fs.Features    // optional features
+	name string
+	root string
+	opt  Options         // vault options
+	api  *oapi.CompatAPI // compat api, wrapper around oapi, exposing legacy methods; TODO: get rid of this
+	// apiFeatures of the server, depending on its version
+	apiFeatures *oapi.Features
+	features    *fs.Features // optional features
+	norm        pathutil.Normalization
+	persistent  *cache.Persistent // persistent cache, may be nil
 	// On a first put, we register a deposit to get a deposit id. Any
-	// subsequent upload will be associated with that deposit id. On shutdown,
-	// we send a finalize signal.
-	depositsV2Client  *ClientWithResponses // v2 deposits API
-	mu                sync.Mutex           // locks inflightDepositID
-	inflightDepositID int                  // inflight deposit id, empty if none inflight
-	started           time.Time            // registration time of the deposit
-	atexit            atexit.FnHandle
+	// subsequent upload into the same directory will be associated with that
+	// deposit id. On shutdown, we send a finalize signal.
+	depositor       depositor           // deposit api version
+	mu              sync.Mutex          // locks deposits
+	deposits        map[string]*deposit // inflight deposits by absolute path of the directory deposited to
+	lastDepositID   int                 // last finalized deposit id, locked by mu
+	uploading       int64               // files being uploaded, locked by mu
+	manifests       []*Manifest         // manifests of the deposits finalized so far, locked by mu
+	terminated      bool                // set on interrupt, no deposits are registered afterwards, locked by mu
+	atexitMu        sync.Mutex          // locks atexit, the interrupt handler, nil after a successful shutdown
+	atexit          atexit.FnHandle
+	uploadTokens    *pacer.TokenDispenser // limits parallel uploads, nil if unlimited
+	prescanOnce     sync.Once             // validate source paths before the first upload
+	prescanErr      error                 // result of the path validation
+	prefetchOnce    sync.Once             // fetch the tree below the root before the first lookup
+	breaker         *retry.CircuitBreaker // pauses chunk uploads after a storm of server errors
+	retryStatuses   map[int]bool          // chunk upload statuses to retry, besides server errors
+	noRetryStatuses map[int]bool          // chunk upload statuses never to retry
+	fixity          fixityCache           // fixity status of collections, for metadata
+	autoCollection  string                // collection for files copied to the organization root, locked by mu
 }
 
 // Fs Info
@@ -270,11 +1045,9 @@ func (f *Fs) Features() *fs.Features { return f.features }
 // found.
 func (f *Fs) List(ctx context.Context, dir string) (fs.DirEntries, error) {
 	fs.Debugf(f, "listing directory: %v", dir)
-	var (
-		entries fs.DirEntries
-		absPath = f.absPath(dir)
-	)
-	t, err := f.api.ResolvePath(absPath)
+	var entries fs.DirEntries
+	f.prefetch(ctx)
+	t, err := f.resolvePath(ctx, dir)
 	if err != nil {
 		if err == fs.ErrorObjectNotFound {
 			return nil, fs.ErrorDirNotFound
@@ -285,40 +1058,120 @@ func (f *Fs) List(ctx context.Context, dir string) (fs.DirEntries, error) {
 	case dir == "" && t.NodeType == "FILE":
 		obj := &Object{
 			fs:       f,
-			remote:   path.Join(dir, t.Name),
+			remote:   path.Join(dir, f.standardName(t.Name)),
 			treeNode: t,
 		}
 		entries = append(entries, obj)
 	case t.NodeType == "ORGANIZATION" || t.NodeType == "COLLECTION" || t.NodeType == "FOLDER":
-		nodes, err := f.api.List(t)
+		err := f.forEachEntry(ctx, t, dir, func(e fs.DirEntry) error {
+			entries = append(entries, e)
+			return nil
+		})
 		if err != nil {
 			return nil, err
 		}
-		for _, n := range nodes {
+	default:
+		return nil, fs.ErrorDirNotFound
+	}
+	fs.Debugf(f, "found %d entries for %v", len(entries), dir)
+	return entries, nil
+}
+
+// ListR lists the objects and directories below dir recursively. Entries are
+// passed to callback in batches of at most listBatchSize, as they arrive from
+// the api, so huge folders are never held in memory at once.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) error {
+	t, err := f.resolvePath(ctx, dir)
+	if err != nil {
+		if err == fs.ErrorObjectNotFound {
+			return fs.ErrorDirNotFound
+		}
+		return err
+	}
+	switch {
+	case dir == "" && t.NodeType == "FILE":
+		return callback(fs.DirEntries{&Object{
+			fs:       f,
+			remote:   f.standardName(t.Name),
+			treeNode: t,
+		}})
+	case t.NodeType == "FILE":
+		return fs.ErrorDirNotFound
+	}
+	var (
+		batch fs.DirEntries
+		flush = func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			err := callback(batch)
+			batch = nil
+			return err
+		}
+		list func(t *api.TreeNode, dir string) error
+	)
+	list = func(t *api.TreeNode, dir string) error {
+		var dirs []*Dir
+		err := f.forEachEntry(ctx, t, dir, func(e fs.DirEntry) error {
+			if d, ok := e.(*Dir); ok {
+				dirs = append(dirs, d)
+			}
+			batch = append(batch, e)
+			if len(batch) >= listBatchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, d := range dirs {
+			if err := list(d.treeNode, d.remote); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := list(t, dir); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// forEachEntry calls fn for each entry of the folder t at dir, page by page as
+// they arrive from the api. With version_at, the versions of a file are only
+// known once the whole folder has been seen, so files are passed to fn last.
+func (f *Fs) forEachEntry(ctx context.Context, t *api.TreeNode, dir string, fn func(fs.DirEntry) error) error {
+	var (
+		files []*api.TreeNode // file versions, with version_at
+		add   = func(n *api.TreeNode) error {
+			remote := path.Join(dir, f.standardName(n.Name))
 			switch {
 			case n.NodeType == "COLLECTION" || n.NodeType == "FOLDER":
-				dir := &Dir{
-					fs:       f,
-					remote:   path.Join(dir, n.Name),
-					treeNode: n,
-				}
-				entries = append(entries, dir)
+				return fn(&Dir{fs: f, remote: remote, treeNode: n})
 			case n.NodeType == "FILE":
-				obj := &Object{
-					fs:       f,
-					remote:   path.Join(dir, n.Name),
-					treeNode: n,
-				}
-				entries = append(entries, obj)
+				return fn(&Object{fs: f, remote: remote, treeNode: n})
 			default:
-				return nil, fmt.Errorf("unknown node type: %v", n.NodeType)
+				return fmt.Errorf("unknown node type: %v", n.NodeType)
 			}
 		}
-	default:
-		return nil, fs.ErrorDirNotFound
+	)
+	err := f.api.ForEachChild(ctx, t, func(n *api.TreeNode) error {
+		if f.opt.VersionAt.IsSet() && n.NodeType == "FILE" {
+			files = append(files, n)
+			return nil
+		}
+		return add(n)
+	})
+	if err != nil {
+		return err
 	}
-	fs.Debugf(f, "found %d entries for %v", len(entries), dir)
-	return entries, nil
+	for _, n := range f.selectVersions(files) {
+		if err := add(n); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // NewObject finds the Object at remote.  If it can't be found
@@ -329,8 +1182,23 @@ func (f *Fs) List(ctx context.Context, dir string) (fs.DirEntries, error) {
 // otherwise ErrorObjectNotFound.
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	fs.Debugf(f, "new object at %v (%v)", remote, f.absPath(remote))
-	t, err := f.api.ResolvePath(f.absPath(remote))
+	stored, err := f.storedRemote(remote)
 	if err != nil {
+		// Vault cannot hold a file by that name.
+		fs.Debugf(f, "%v", err)
+		return nil, fs.ErrorObjectNotFound
+	}
+	f.prefetch(ctx)
+	t, err := f.resolvePath(ctx, stored)
+	switch {
+	case errors.Is(err, oapi.ErrAmbiguousQuery) || err == nil && f.opt.VersionAt.IsSet() && t != nil && t.NodeType == "FILE":
+		// There are multiple versions of the file, cf. update_mode.
+		versions, err := f.versions(ctx, remote)
+		if err != nil {
+			return nil, err
+		}
+		t = selectVersion(versions, time.Time(f.opt.VersionAt))
+	case err != nil:
 		return nil, err
 	}
 	switch {
@@ -352,74 +1220,145 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 	return f.Put(ctx, in, src, options...)
 }
 
-// requestDeposit attempts to start a new deposit. If a deposit is already
-// inflight, this function returns immediately, without any error.
-func (f *Fs) requestDeposit(ctx context.Context) error {
+// requestDeposit attempts to start a new deposit into the directory at the
+// absolute path dir and returns the inflight deposit. If a deposit into dir
+// is already inflight, it is returned immediately.
+func (f *Fs) requestDeposit(ctx context.Context, dir string) (*deposit, error) {
+	if !f.apiFeatures.DepositsV2 {
+		return nil, ErrUploadsUnsupported
+	}
+	// Registered again, if the fs is used after a shutdown; not while f.mu
+	// is held, as the handler takes it.
+	f.registerAtexit()
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	if f.inflightDepositID != 0 {
-		return nil
+	if f.terminated {
+		return nil, fserrors.FatalError(ErrTerminated)
 	}
-	fs.Debugf(f, "trying to resolve %s ...", f.root)
+	if d, ok := f.deposits[dir]; ok {
+		return d, nil
+	}
+	fs.Debugf(f, "trying to resolve %s ...", dir)
 	// TODO: when using "rclone mount" f.root will be / and the object will
 	// have the path a/b/c.txt, whereas with regular uploads the root will be
 	// the directory and the object will be the file.
 	//
 	// ...
-	t, err := f.api.ResolvePath(f.root)
+	t, err := f.api.ResolvePath(ctx, dir)
 	if err != nil {
 		if err == fs.ErrorObjectNotFound {
-			fs.Debugf(f, "root not found: %v", f.root)
-			if err = f.mkdir(ctx, f.root); err != nil {
-				return err
+			fs.Debugf(f, "deposit directory not found: %v", dir)
+			if err = f.mkdir(ctx, dir); err != nil {
+				return nil, err
 			}
-			if t, err = f.api.ResolvePath(f.root); err != nil {
-				return err
+			if t, err = f.api.ResolvePath(ctx, dir); err != nil {
+				return nil, err
 			}
 		} else {
-			return err
+			return nil, err
 		}
 	}
-	fs.Debugf(f, "root resolved: %s %v %v %T", f.root, t, err, err)
+	fs.Debugf(f, "deposit directory resolved: %s %v %v %T", dir, t, err, err)
 	var (
 		parent = t
-		body   = VaultDepositApiRegisterDepositJSONRequestBody{}
+		target depositTarget
 	)
 	fs.Debugf(f, "request deposit: parent was %v", parent)
 	switch {
 	case parent.NodeType == "COLLECTION":
-		c, err := f.api.TreeNodeToCollection(parent)
+		c, err := f.api.TreeNodeToCollection(ctx, parent)
 		if err != nil {
-			return fmt.Errorf("failed to resolve treenode to collection: %w", err)
+			return nil, fmt.Errorf("failed to resolve treenode to collection: %w", err)
 		}
-		cid := int(c.Identifier())
-		body.CollectionId = &cid
+		target.CollectionID = int(c.Identifier())
 	case parent.NodeType == "FOLDER":
-		pid := int(parent.ID)
-		body.ParentNodeId = &pid
+		target.ParentNodeID = int(parent.ID)
 	default:
 		// TODO: can we just copy to / now?
 		fs.Debugf(f, "cannot copy to parent: %v", parent)
-		return ErrCannotCopyToRoot
+		return nil, ErrCannotCopyToRoot
 	}
-	resp, err := f.depositsV2Client.VaultDepositApiRegisterDepositWithResponse(ctx, body)
+	id, err := f.depositor.register(ctx, target)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if resp.StatusCode() != 200 {
-		return fmt.Errorf("deposits/v2 registration failed with: %s", resp.HTTPResponse.Status)
+	if f.deposits == nil {
+		f.deposits = make(map[string]*deposit)
 	}
-	if resp.JSON200.DepositId == 0 {
-		return ErrMissingDepositIdentifier
+	f.deposits[dir] = newDeposit(id, dir)
+	trackDeposits(f)
+	if len(f.opt.DepositTags) > 0 {
+		if err := recordDepositTags(f.name, id, f.opt.DepositTags); err != nil {
+			fs.Logf(f, "could not record tags of deposit %d: %v", id, err)
+		}
+	}
+	f.api.InvalidatePersistentCache() // listings will change with this deposit
+	fs.Debugf(f, "successfully registered deposit: %v", id)
+	return f.deposits[dir], nil
+}
+
+// checkImmutable returns ErrImmutable, if there is a file at the stored
+// remote already.
+func (f *Fs) checkImmutable(ctx context.Context, remote string) error {
+	t, err := f.api.ResolvePath(ctx, f.absPath(remote))
+	switch {
+	case errors.Is(err, fs.ErrorObjectNotFound):
+		return nil
+	case err != nil:
+		return err
+	case t != nil:
+		return fserrors.NoRetryError(fmt.Errorf("%w: %v", ErrImmutable, t.Path))
 	}
-	f.inflightDepositID = resp.JSON200.DepositId
-	f.started = time.Now()
-	fs.Debugf(f, "successfully registered deposit: %v", f.inflightDepositID)
 	return nil
 }
 
-// getFlowIdentifier returns a flow identifier for an object.
-func (f *Fs) getFlowIdentifier(src fs.ObjectInfo) (s string, err error) {
+// autoCollectionFor returns the collection named by the auto_collection
+// template, if the root is the organization root, so files copied to the
+// root go into that collection. The name is chosen once, on the first upload,
+// and the collection is created, if it does not exist. The root itself does
+// not change, so listings keep their meaning. Returns the empty string below
+// the organization root.
+func (f *Fs) autoCollectionFor(ctx context.Context, src fs.ObjectInfo) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if strings.Trim(f.root, "/") != "" {
+		return "", nil
+	}
+	if f.autoCollection != "" {
+		return f.autoCollection, nil
+	}
+	name := autoCollectionName(f.opt.AutoCollection, src, time.Now())
+	switch {
+	case name == "" || name == "." || name == "..":
+		return "", ErrCannotCopyToRoot
+	case strings.Contains(name, "/") || !pathutil.IsValidPath(name):
+		return "", fmt.Errorf("%w: auto collection %q", ErrInvalidPath, name)
+	}
+	if err := f.mkdir(ctx, "/"+name); err != nil {
+		return "", err
+	}
+	fs.Logf(f, "copying to root, using collection %q", name)
+	f.autoCollection = name
+	return name, nil
+}
+
+// autoCollectionName expands an auto_collection template: {source} is the
+// name of the source directory and {date} the current date.
+func autoCollectionName(template string, src fs.ObjectInfo, t time.Time) string {
+	var source string
+	if info := src.Fs(); info != nil {
+		if root := strings.TrimRight(strings.ReplaceAll(info.Root(), "\\", "/"), "/"); root != "" {
+			source = path.Base(root)
+		}
+	}
+	r := strings.NewReplacer("{source}", source, "{date}", t.Format("2006-01-02"))
+	return strings.TrimSpace(r.Replace(template))
+}
+
+// getFlowIdentifier returns a flow identifier for an object. The deposit id
+// is part of the identifier, so a restarted transfer, e.g. after CTRL-C,
+// never collides with partial uploads of the previous deposit.
+func (f *Fs) getFlowIdentifier(src fs.ObjectInfo, depositID int) (s string, err error) {
 	var h = md5.New()
 	if _, err = io.WriteString(h, f.root); err != nil {
 		return
@@ -427,6 +1366,9 @@ func (f *Fs) getFlowIdentifier(src fs.ObjectInfo) (s string, err error) {
 	if _, err = io.WriteString(h, src.Remote()); err != nil {
 		return
 	}
+	if _, err = fmt.Fprintf(h, "%d", depositID); err != nil {
+		return
+	}
 	return fmt.Sprintf("%s-%x", flowIdentifierPrefix, h.Sum(nil)), nil
 }
 
@@ -441,13 +1383,21 @@ func getFlowTotalChunks(objectSize int, chunkSize int64) int {
 	}
 }
 
-// Put uploads a new object, using v2 deposits. A new deposit is registered,
-// once. Files are only written to a temporary file, if the remote does not
-// support object size information.
+// Put uploads a new object, using v2 deposits. A new deposit is registered
+// once for each directory deposited to, cf. depositDir. Files are only
+// written to a temporary file, if the remote does not support object size
+// information.
 func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
 	fs.Debugf(f, "put %v [%v]", src.Remote(), src.Size())
+	if f.opt.VersionAt.IsSet() {
+		return nil, ErrVersionAt
+	}
+	if commentRequested(ctx, options) {
+		return nil, ErrCommentUnsupported
+	}
 	var (
 		flowIdentifier string
+		remote         string
 		err            error
 	)
 	// TODO: if src.Remote() is not just a basename, assume we have an "rclone
@@ -455,66 +1405,165 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 	// all path segments, but we would like to shift the path segments from
 	// src.Remote() to f.root
 
-	// (1) Start a deposit, if not already started. TODO: support resuming a deposit.
-	if err := f.requestDeposit(ctx); err != nil {
+	// (0) Determine, whether we can get the size of the object. Some backend
+	// do not support size, then we have to spool the data first (which
+	// should rarely happen); small objects stay in memory. This happens
+	// first, so the quota check sees the actual size.
+	spool, objectSize, err := f.objectSize(in, src)
+	if err != nil {
 		return nil, err
 	}
-	// (2) Get a flow identifier for file.
-	if flowIdentifier, err = f.getFlowIdentifier(src); err != nil {
+	if spool != nil {
+		in = spool // breaks "accounting", does it affect anything?
+		defer func() {
+			// TODO: may be a problem on shutdown, as that will happen
+			// elsewhere; TODO: move this into upload altogether
+			_ = spool.Close()
+		}()
+	}
+	// Files copied to the organization root may go into an auto collection.
+	var collection string
+	if f.opt.AutoCollection != "" {
+		if collection, err = f.autoCollectionFor(ctx, src); err != nil {
+			return nil, err
+		}
+	}
+	if !f.opt.NoPrescan && !f.opt.SanitizePaths {
+		if err := f.prescan(ctx, src); err != nil {
+			return nil, err
+		}
+	}
+	// (1) Start a deposit into the directory of the file, if not already
+	// started. TODO: support resuming a deposit.
+	if remote, err = f.storedRemote(src.Remote()); err != nil {
 		return nil, err
 	}
-	// (3) Determine, whether we can get the size of the object. Some backend
-	// do not support size, then we have to move the data from the backend to a
-	// temporary file first (which should rarely happen).
-	var (
-		tempfile   string
-		objectSize int
-	)
-	if tempfile, objectSize, err = f.objectSize(in, src); err != nil {
+	if collection != "" {
+		remote = path.Join(collection, remote)
+	}
+	dir, _, err := f.depositDir(remote)
+	if err != nil {
 		return nil, err
 	}
-	if tempfile != "" {
-		f, err := os.Open(tempfile)
-		if err != nil {
+	if !f.opt.NoQuotaCheck && !f.hasDeposit(dir) {
+		if err := f.checkQuota(ctx, int64(objectSize)); err != nil {
 			return nil, err
 		}
-		in = f // breaks "accounting", does it affect anything?
-		defer func() {
-			_ = f.Close()
-			// TODO: may be a problem on shutdown, as that will happen
-			// elsewhere; TODO: move this into upload altogether
-			_ = os.Remove(tempfile)
-		}()
+	}
+	d, err := f.requestDeposit(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	// (2) Check the name and get a flow identifier for file.
+	if f.opt.Immutable {
+		if err := f.checkImmutable(ctx, remote); err != nil {
+			return nil, err
+		}
+	}
+	if remote, err = f.claimRemote(d, src.Remote(), remote); err != nil {
+		return nil, err
+	}
+	_, relativePath, err := f.depositDir(remote)
+	if err != nil {
+		return nil, err
+	}
+	depositID := d.id
+	if flowIdentifier, err = f.getFlowIdentifier(src, depositID); err != nil {
+		return nil, err
 	}
 	// (4) Need to get total size, and total number of chunks.
 	var uploadInfo = &UploadInfo{
 		flowTotalSize:   objectSize,
 		flowTotalChunks: getFlowTotalChunks(objectSize, f.opt.ChunkSize),
 		flowIdentifier:  flowIdentifier,
+		depositID:       depositID,
+		remote:          remote,
+		relativePath:    relativePath,
 		in:              in,
+		budget:          retry.NewBudget(uint64(f.opt.ChunkRetryBudget)),
 		src:             src,
 	}
-	// (5) Upload file in chunks. TODO: this can be parallelized as well.
+	// Seekable input, e.g. a spooled file, can be chunked without reading
+	// the whole stream in order.
+	if rs, ok := in.(io.ReadSeeker); ok {
+		if uploadInfo.chunker, err = iotemp.NewSeekerChunker(rs, int64(objectSize), f.opt.ChunkSize); err != nil {
+			return nil, err
+		}
+	}
+	// (5) Upload file in chunks, up to max_parallel_chunks at once.
 	// We're loading a small (order 1M) chunk into memory, so we get the
 	// correct total size of the chunk.
 	//
 	// TODO: if we get interrupted inside this loop, we may not be able to
 	// finalize the deposit, refs WT-2150, potentially related:
 	// https://github.com/rclone/rclone/issues/966
+	if f.uploadTokens != nil {
+		f.uploadTokens.Get()
+		defer f.uploadTokens.Put()
+	}
+	f.mu.Lock()
+	f.uploading++
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.uploading--
+		f.mu.Unlock()
+	}()
 	h, err := f.upload(ctx, uploadInfo)
+	for i := 0; errors.Is(err, ErrDepositClosed) && i < maxDepositRegistrations; i++ {
+		// The server completed the deposit early, we continue with a fresh
+		// deposit; other uploads may have registered one already.
+		fs.Logf(f, "%v, registering a new deposit", err)
+		f.resetDeposit(uploadInfo.depositID)
+		if uploadInfo.chunker == nil {
+			// The input is partially consumed, let rclone retry the
+			// transfer, which then goes into the new deposit.
+			return nil, fserrors.RetryError(err)
+		}
+		if d, err = f.requestDeposit(ctx, dir); err != nil {
+			return nil, err
+		}
+		if _, err = f.claimRemote(d, src.Remote(), remote); err != nil {
+			return nil, err
+		}
+		uploadInfo.depositID, uploadInfo.i = d.id, 0
+		if uploadInfo.flowIdentifier, err = f.getFlowIdentifier(src, uploadInfo.depositID); err != nil {
+			return nil, err
+		}
+		h, err = f.upload(ctx, uploadInfo)
+	}
 	if err != nil {
 		return nil, err
 	}
+	f.mu.Lock()
+	if original := f.norm.Apply(src.Remote()); remote != original && remote != path.Join(collection, original) {
+		d.renamed[f.absPath(remote)] = src.Remote()
+	}
+	d.files++
+	d.bytes += int64(objectSize)
+	f.mu.Unlock()
 	// We do not strictly need the hash sums, but we can compute the on the
 	// fly, so we can augment the TreeNode value.
 	sums := h.Sums()
+	if f.opt.ManifestPath != "" {
+		f.addToManifest(d, &ManifestFile{
+			Remote:         path.Join("/", f.root, remote),
+			Source:         src.Remote(),
+			Size:           int64(objectSize),
+			MD5:            sums[hash.MD5],
+			SHA1:           sums[hash.SHA1],
+			SHA256:         sums[hash.SHA256],
+			FlowIdentifier: uploadInfo.flowIdentifier,
+			DepositID:      uploadInfo.depositID,
+		})
+	}
 	fs.Debugf(f, "chunk upload complete")
 	return &Object{
 		fs:     f,
 		remote: src.Remote(),
 		treeNode: &api.TreeNode{
 			NodeType:   "FILE",
-			ObjectSize: src.Size(),
+			ObjectSize: int64(objectSize),
 			Md5Sum:     sums[hash.MD5],
 			Sha1Sum:    sums[hash.SHA1],
 			Sha256Sum:  sums[hash.SHA256],
@@ -523,31 +1572,47 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 }
 
 // objectSize tries to get the size of an object. If the object does not
-// support reading its size, we spool the data into a temporary file and return
-// the temporary filename. This may be necessary for rare cases, where the
-// other backend does not support getting the size of an object before reading
-// it in full.
-func (f *Fs) objectSize(in io.Reader, src fs.ObjectInfo) (tempfile string, size int, err error) {
-	switch {
-	case src.Size() == -1:
-		var (
-			fi os.FileInfo
-			f  *os.File
-		)
-		// Source does not support size, we stream to a temporary file and
-		// return a reader of that file.
-		if tempfile, err = iotemp.TempFileFromReader(in); err != nil {
-			return "", 0, err
-		}
-		fs.Debugf(f, "object does not support size, spooled to temp file: %v", tempfile)
-		if fi, err = os.Stat(tempfile); err != nil {
-			return "", 0, err
-		}
-		size = int(fi.Size())
-	default:
-		size = int(src.Size()) // most objects will support size
+// support reading its size, we take it from input already spooled or
+// otherwise seekable, or else spool the data, in memory up to
+// maxMemorySpoolSize, and return the spool, which the caller must close.
+// This may be necessary for rare cases, where the other backend does not
+// support getting the size of an object before reading it in full.
+func (f *Fs) objectSize(in io.Reader, src fs.ObjectInfo) (spool *iotemp.Spool, size int, err error) {
+	if src.Size() != -1 {
+		return nil, int(src.Size()), nil // most objects will support size
+	}
+	if s, ok := in.(*iotemp.Spool); ok {
+		return nil, int(s.Size()), nil // spooled by the caller, who closes it
+	}
+	if rs, ok := in.(io.Seeker); ok {
+		if n, err := seekerSize(rs); err == nil {
+			return nil, int(n), nil
+		}
+	}
+	if spool, err = iotemp.NewSpool(in, maxMemorySpoolSize,
+		iotemp.WithDir(f.opt.TempDir),
+		iotemp.WithEncryption(f.opt.EncryptSpool)); err != nil {
+		return nil, 0, err
+	}
+	fs.Debugf(f, "object does not support size, spooled %d bytes (in memory: %v)", spool.Size(), spool.InMemory())
+	return spool, int(spool.Size()), nil
+}
+
+// seekerSize returns the size of a seeker, leaving the offset unchanged.
+// Seekable input is chunked from the start, see iotemp.NewSeekerChunker.
+func seekerSize(rs io.Seeker) (int64, error) {
+	cur, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := rs.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
 	}
-	return "", size, nil
+	return end, nil
 }
 
 // UploadInfo contains all information for a single file upload.
@@ -555,7 +1620,12 @@ type UploadInfo struct {
 	flowTotalChunks int
 	flowTotalSize   int
 	flowIdentifier  string
+	depositID       int    // deposit this file is uploaded to
+	remote          string // remote as stored in vault, may be sanitized
+	relativePath    string // remote relative to the directory deposited to
 	in              io.Reader
+	chunker         *iotemp.Chunker // if set, chunks are read from here instead of in
+	budget          *retry.Budget   // chunk retries left for this file
 	src             fs.ObjectInfo
 	// i is the inflightChunkNumber keeps track of where we are with the
 	// upload, modified during upload and only here, so we may pick up some
@@ -577,180 +1647,411 @@ func (f *Fs) upload(ctx context.Context, info *UploadInfo) (hasher *hash.MultiHa
 	if err != nil {
 		return nil, err
 	}
-	for info.i < info.flowTotalChunks {
-		info.i++
-		fs.Infof(f, "[>>>] uploading file %v chunk %d/%d [%v]", info.src.Remote(), info.i, info.flowTotalChunks, time.Since(f.started))
-		var (
-			buf      bytes.Buffer                               // buffer for file data (we need the actual size at upload time)
-			lr       = io.LimitReader(info.in, f.opt.ChunkSize) // chunk reader over stream
-			wrapIn   = io.TeeReader(lr, hasher)                 // wrap input stream for hashing
-			wbuf     = bytes.Buffer{}                           // buffer for multipart message
-			w        = multipart.NewWriter(&wbuf)               // multipart writer
-			mimeType = "application/octet-stream"               // file mime type
-			n        int64                                      // actual length of this chunk
-			err      error                                      // any error
-			fw       io.Writer                                  // formfile writer
-			resp     *http.Response                             // deposit API response
-		)
-		if n, err = io.Copy(&buf, wrapIn); err != nil { // n <= opt.ChunkSize
-			return nil, err
-		}
-		// (5a) on first chunk, try to find mime type
-		if info.i == 1 {
-			ext := path.Ext(path.Base(info.src.Remote()))
-			mimeType = mime.TypeByExtension(ext)
-			if mimeType == "" {
-				mimeType = http.DetectContentType(buf.Bytes())
+	// Chunks are read and hashed in order, up to chunk_read_ahead chunks
+	// ahead of sending, and sent up to max_parallel_chunks at once. Each
+	// chunk takes a token until it is sent, which limits the chunks in
+	// memory. Reading and sending share a group, so a failure of either
+	// stops the other and is the error returned.
+	var (
+		n       = f.maxParallelChunks() + f.chunkReadAhead()
+		g, gctx = errgroup.WithContext(ctx)
+		chunks  = make(chan *uploadChunk, n) // read chunks
+		tokens  = make(chan struct{}, n)     // chunks in memory
+	)
+	g.SetLimit(f.maxParallelChunks() + 1) // senders and the reader
+	g.Go(func() error {
+		defer close(chunks)
+		for info.i < info.flowTotalChunks {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			select {
+			case tokens <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			c, err := f.readChunk(gctx, info, hasher)
+			if err != nil {
+				return err
+			}
+			select {
+			case chunks <- c:
+			case <-gctx.Done():
+				return gctx.Err()
 			}
 		}
-		// (5b) write multipart fields
-		mfw := &iotemp.MultipartFieldWriter{W: w}
-		mfw.WriteField("depositId", fmt.Sprintf("%v", f.inflightDepositID))
-		mfw.WriteField("flowChunkNumber", fmt.Sprintf("%v", info.i))
-		mfw.WriteField("flowChunkSize", fmt.Sprintf("%v", f.opt.ChunkSize))
-		mfw.WriteField("flowCurrentChunkSize", fmt.Sprintf("%v", n))
-		mfw.WriteField("flowFilename", filepath.Base(info.src.Remote()))
-		mfw.WriteField("flowIdentifier", info.flowIdentifier)
-		mfw.WriteField("flowRelativePath", info.src.Remote())
-		mfw.WriteField("flowTotalChunks", fmt.Sprintf("%v", info.flowTotalChunks))
-		mfw.WriteField("flowTotalSize", fmt.Sprintf("%v", info.flowTotalSize))
-		mfw.WriteField("flowMimetype", mimeType)
-		mfw.WriteField("flowUserMtime", fmt.Sprintf("%v", info.src.ModTime(ctx).Format(time.RFC3339)))
-		if err := mfw.Err(); err != nil {
-			return nil, err
+		return nil
+	})
+	for c := range chunks {
+		if gctx.Err() != nil {
+			break
 		}
-		// (5c) write multipart file
-		formFileName := fmt.Sprintf("%s-%016d", info.flowIdentifier, info.i)
-		if fw, err = w.CreateFormFile("file", formFileName); err != nil { // can we use a random file name?
+		g.Go(func() error {
+			defer func() { <-tokens }()
+			if err := f.sendChunk(gctx, info.depositID, c.contentType, c.body, info.budget); err != nil {
+				return err
+			}
+			f.chunkSent(info.depositID, c.size)
+			return nil
+		})
+	}
+	// When reading or chunk retry failed, we bail out.
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return hasher, nil
+}
+
+// uploadChunk is a multipart encoded chunk of a file, ready to send.
+type uploadChunk struct {
+	size        int64         // size of the file data in this chunk
+	contentType string        // multipart content type, with boundary
+	body        *bytes.Buffer // multipart message
+}
+
+// readChunk reads the next chunk of a file into a multipart message, adding
+// the data to the hasher.
+func (f *Fs) readChunk(ctx context.Context, info *UploadInfo, hasher io.Writer) (*uploadChunk, error) {
+	info.i++
+	fs.Infof(f, "[>>>] uploading file %v chunk %d/%d [%v]", info.src.Remote(), info.i, info.flowTotalChunks, f.depositElapsed(info.depositID))
+	var (
+		lr  = io.LimitReader(info.in, f.opt.ChunkSize) // chunk reader over stream
+		err error
+	)
+	if info.chunker != nil {
+		if lr, err = info.chunker.Chunk(info.i - 1); err != nil {
 			return nil, err
 		}
-		if _, err := io.Copy(fw, &buf); err != nil {
-			return nil, err
+	}
+	var (
+		buf      bytes.Buffer                 // buffer for file data (we need the actual size at upload time)
+		wrapIn   = io.TeeReader(lr, hasher)   // wrap input stream for hashing
+		wbuf     = &bytes.Buffer{}            // buffer for multipart message
+		w        = multipart.NewWriter(wbuf)  // multipart writer
+		mimeType = "application/octet-stream" // file mime type
+		n        int64                        // actual length of this chunk
+		fw       io.Writer                    // formfile writer
+	)
+	if n, err = io.Copy(&buf, wrapIn); err != nil { // n <= opt.ChunkSize
+		return nil, err
+	}
+	// (5a) on first chunk, try to find mime type
+	if info.i == 1 {
+		ext := path.Ext(path.Base(info.remote))
+		mimeType = mime.TypeByExtension(ext)
+		if mimeType == "" {
+			mimeType = http.DetectContentType(buf.Bytes())
 		}
-		// (5d) finalize multipart writer
-		if err := w.Close(); err != nil {
-			return nil, err
+	}
+	// (5b) write multipart fields
+	mfw := &iotemp.MultipartFieldWriter{W: w}
+	mfw.WriteField("depositId", fmt.Sprintf("%v", info.depositID))
+	mfw.WriteField("flowChunkNumber", fmt.Sprintf("%v", info.i))
+	mfw.WriteField("flowChunkSize", fmt.Sprintf("%v", f.opt.ChunkSize))
+	mfw.WriteField("flowCurrentChunkSize", fmt.Sprintf("%v", n))
+	mfw.WriteField("flowFilename", f.opt.Enc.FromStandardName(path.Base(info.remote)))
+	mfw.WriteField("flowIdentifier", info.flowIdentifier)
+	mfw.WriteField("flowRelativePath", f.opt.Enc.FromStandardPath(info.relativePath))
+	mfw.WriteField("flowTotalChunks", fmt.Sprintf("%v", info.flowTotalChunks))
+	mfw.WriteField("flowTotalSize", fmt.Sprintf("%v", info.flowTotalSize))
+	mfw.WriteField("flowMimetype", mimeType)
+	mfw.WriteField("flowUserMtime", fmt.Sprintf("%v", info.src.ModTime(ctx).Format(time.RFC3339)))
+	if err := mfw.Err(); err != nil {
+		return nil, err
+	}
+	// (5c) write multipart file
+	formFileName := fmt.Sprintf("%s-%016d", info.flowIdentifier, info.i)
+	if fw, err = w.CreateFormFile("file", formFileName); err != nil { // can we use a random file name?
+		return nil, err
+	}
+	if _, err := io.Copy(fw, &buf); err != nil {
+		return nil, err
+	}
+	// (5d) finalize multipart writer
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return &uploadChunk{size: n, contentType: w.FormDataContentType(), body: wbuf}, nil
+}
+
+// sendChunk sends a single multipart encoded chunk, retrying on server and
+// network errors, as long as the retry budget of the file lasts. Server
+// errors count towards the circuit breaker shared by all chunks. The retries
+// stop, when ctx is cancelled, e.g. because another chunk of the file failed.
+func (f *Fs) sendChunk(ctx context.Context, depositID int, contentType string, body *bytes.Buffer, budget *retry.Budget) error {
+	// Each chunk gets a timeout of its own (note: this did not seem to have
+	// been the cause of the previously encountered 404).
+	ctx, cancel := withOptionalTimeout(ctx, time.Duration(f.opt.ChunkTimeout))
+	defer cancel()
+	backoff := retry.WithBudget(budget,
+		retry.WithCappedDuration(UploadChunkBackoffCap, retry.NewFibonacci(UploadChunkBackoffBase)))
+	return retry.Do(ctx, backoff, func(ctx context.Context) error {
+		if err := f.breaker.Wait(ctx); err != nil {
+			return err
 		}
-		// (5e) send chunk
-		// The context passed may have a too eager deadline, so we give it a
-		// fresh timeout per chunk upload request (note: this did not seem to
-		// have been the cause of the previously encountered 404).
-		ctx, cancel := context.WithTimeout(context.Background(), UploadChunkTimeout)
+		fs.Debugf(f, "starting upload... (buffer size: %v, [T=%v])", body.Len(), f.depositElapsed(depositID))
+		var apiErr *oapi.APIError
+		// Each attempt reads the whole chunk again, within its own
+		// deadline; an attempt timing out is retried like a network
+		// error below.
+		actx, cancel := withOptionalTimeout(ctx, time.Duration(f.opt.ChunkAttemptTimeout))
 		defer cancel()
-		backoff := retry.WithCappedDuration(UploadChunkBackoffCap, retry.NewFibonacci(UploadChunkBackoffBase))
-		err = retry.Do(ctx, backoff, func(ctx context.Context) error {
-			fs.Debugf(f, "starting upload... (buffer size: %v, [T=%v])", wbuf.Len(), time.Since(f.started))
-			resp, err = f.depositsV2Client.VaultDepositApiSendChunkWithBody(ctx, w.FormDataContentType(), &wbuf)
-			switch {
-			case err != nil:
-				// This may be cause by infrastructure errors, like DNS
-				// failures, etc., so we can retry them as well. It's important
-				// that we check this case first.
-				return retry.RetryableError(err)
-			case resp.StatusCode >= 500: // refs. VLT-518
-				// We may recover from an HTTP 500 likely caused by a rare race
-				// condition in a database trigger, encountered in 05/2023.
-				fs.Debugf(f, "chunk upload retry: %v", resp.Status)
-				return retry.RetryableError(err)
-			case resp.StatusCode >= 400:
-				// TODO: we get a HTTP 404 from prod, with message: {"detail": "Not Found"}
-				// TODO: we get a 404 because deposit switches to "REPLICATED" quickly
-				fs.Debugf(f, "chunk upload failed (deposit id=%v)", f.inflightDepositID)
-				fs.Debugf(f, "got %v -- response dump follows", resp.Status)
-				b, err := httputil.DumpResponse(resp, true)
-				if err != nil {
+		err := f.depositor.sendChunk(actx, contentType, bytes.NewReader(body.Bytes()))
+		switch {
+		case err == nil:
+			f.breaker.Success()
+			return nil
+		case !errors.As(err, &apiErr):
+			// This may be cause by infrastructure errors, like DNS
+			// failures, etc., so we can retry them as well. It's important
+			// that we check this case first.
+			return retry.RetryableError(err)
+		case !f.retryableStatus(apiErr):
+			// We get a HTTP 404 with {"detail": "Not Found"}, if the
+			// deposit is not in "REGISTERED" state anymore, e.g. when it
+			// switched to "REPLICATED" early.
+			fs.Debugf(f, "chunk upload failed (deposit id=%v)", depositID)
+			if apiErr.StatusCode == http.StatusNotFound {
+				if err := f.checkDepositOpen(ctx, depositID); err != nil {
 					return err
 				}
-				fs.Debugf(f, string(b))
-				// TODO: this can be triggered by running "sync", then
-				// "CTRL-C", then without delay rerunning the "sync" command;
-				// if the repeated command is issued after a delay, this issue
-				// does not surface
-				return fmt.Errorf("api responded with an HTTP %v, stopping chunk upload", resp.StatusCode)
-			default:
-				return nil
 			}
-		})
-		// When chunk retry failed, we bail out.
-		if err != nil {
-			return nil, err
+			return err
+		case apiErr.RetryAfter > 0:
+			// The server is throttling us or in maintenance and told us
+			// when to come back. This is no failure of the server, so the
+			// breaker is not involved.
+			fs.Debugf(f, "chunk upload retry in %v: %v", apiErr.RetryAfter, err)
+			return retry.RetryableErrorAfter(err, apiErr.RetryAfter)
+		case apiErr.StatusCode >= 500: // refs. VLT-518
+			// We may recover from an HTTP 500 likely caused by a rare race
+			// condition in a database trigger, encountered in 05/2023.
+			fs.Debugf(f, "chunk upload retry: %v", err)
+			f.breaker.Failure()
+			return retry.RetryableError(err)
+		default:
+			// A status listed in retry_statuses, e.g. from a proxy.
+			fs.Debugf(f, "chunk upload retry: %v", err)
+			return retry.RetryableError(err)
 		}
+	})
+}
+
+// withOptionalTimeout returns a context with a timeout, or without one, if
+// the timeout is not positive.
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// retryableStatus returns true, if a chunk upload failing with the error
+// should be retried. Statuses in no_retry_statuses and retry_statuses take
+// precedence over the default of retrying server errors and throttling with
+// a Retry-After header.
+func (f *Fs) retryableStatus(apiErr *oapi.APIError) bool {
+	switch code := apiErr.StatusCode; {
+	case f.noRetryStatuses[code]:
+		return false
+	case f.retryStatuses[code]:
+		return true
+	case code == http.StatusTooManyRequests:
+		return apiErr.RetryAfter > 0
+	default:
+		return code >= 500
+	}
+}
+
+// parseRetryStatuses parses the retry_statuses and no_retry_statuses
+// options. A status must not be in both lists.
+func parseRetryStatuses(retry, noRetry fs.CommaSepList) (retryStatuses, noRetryStatuses map[int]bool, err error) {
+	parse := func(name string, list fs.CommaSepList) (map[int]bool, error) {
+		statuses := make(map[int]bool)
+		for _, v := range list {
+			code, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || code < 100 || code > 599 {
+				return nil, fmt.Errorf("invalid %s: %q is not an HTTP status", name, v)
+			}
+			statuses[code] = true
+		}
+		return statuses, nil
+	}
+	if retryStatuses, err = parse("retry_statuses", retry); err != nil {
+		return nil, nil, err
+	}
+	if noRetryStatuses, err = parse("no_retry_statuses", noRetry); err != nil {
+		return nil, nil, err
+	}
+	for code := range retryStatuses {
+		if noRetryStatuses[code] {
+			return nil, nil, fmt.Errorf("invalid retry_statuses: %d is also in no_retry_statuses", code)
+		}
+	}
+	return retryStatuses, noRetryStatuses, nil
+}
+
+// breakerChanged logs when chunk uploads pause and resume.
+func (f *Fs) breakerChanged(from, to retry.State) {
+	switch to {
+	case retry.StateOpen:
+		fs.Logf(f, "chunk uploads failing with server errors, pausing for %v", f.opt.BreakerCooldown)
+	case retry.StateHalfOpen:
+		fs.Infof(f, "resuming chunk uploads after pause")
+	case retry.StateClosed:
+		fs.Logf(f, "chunk uploads recovered")
+	}
+}
+
+// addToManifest records a file uploaded to a deposit.
+func (f *Fs) addToManifest(d *deposit, file *ManifestFile) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d.manifest = append(d.manifest, file)
+}
+
+// chunkSent records a chunk sent to a deposit and, unless
+// suppress_progress_bar is set, logs the progress of the deposit at most
+// every progressInterval.
+func (f *Fs) chunkSent(depositID int, n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := f.depositByID(depositID)
+	if d == nil {
+		return
+	}
+	d.sentBytes += n
+	if f.opt.SuppressProgressBar || time.Since(d.progressed) < progressInterval {
+		return
+	}
+	d.progressed = time.Now()
+	elapsed := time.Since(d.started)
+	fs.Logf(f, "deposit %d: %d files done, %v sent, %v/s [%v]", depositID, d.files,
+		fs.SizeSuffix(d.sentBytes), fs.SizeSuffix(float64(d.sentBytes)/math.Max(elapsed.Seconds(), 1)), elapsed.Truncate(time.Second))
+}
+
+// maxParallelChunks returns the number of chunks of a file sent at once.
+func (f *Fs) maxParallelChunks() int {
+	if f.opt.MaxParallelChunks < 1 {
+		return 1
 	}
-	return hasher, nil
+	return f.opt.MaxParallelChunks
+}
+
+// chunkReadAhead returns the number of chunks of a file read ahead of
+// sending.
+func (f *Fs) chunkReadAhead() int {
+	if f.opt.ChunkReadAhead < 0 {
+		return 0
+	}
+	return f.opt.ChunkReadAhead
 }
 
 // Mkdir creates a directory, if it does not exist.
 func (f *Fs) Mkdir(ctx context.Context, dir string) error {
-	return f.mkdir(ctx, f.absPath(dir))
+	stored, err := f.storedRemote(dir)
+	if err != nil {
+		return err
+	}
+	return f.mkdir(ctx, f.absPath(stored))
 }
 
 // mkdir creates a directory, ignores the filesystem root and expects dir to be
 // the absolute path. Will create parent directories if necessary.
 func (f *Fs) mkdir(ctx context.Context, dir string) error {
 	fs.Debugf(f, "mkdir: %v", dir)
-	var t, _ = f.api.ResolvePath(dir)
+	if !strings.HasPrefix(dir, "/") {
+		dir = "/" + dir // root may be relative, e.g. "vault:c/dir"
+	}
+	// Resolve the directory and all its parents at once, instead of walking
+	// the path again for each of them.
+	var (
+		segments = pathSegments(dir, "/")
+		prefixes = []string{dir}
+	)
+	for i := range segments {
+		prefixes = append(prefixes, "/"+path.Join(segments[:i+1]...))
+	}
+	resolved, err := f.api.ResolvePaths(ctx, prefixes)
+	if err != nil {
+		return err
+	}
+	var t = resolved[dir]
 	switch {
 	case t != nil && (t.NodeType == "FOLDER" || t.NodeType == "COLLECTION"):
 		return nil
 	case t != nil:
 		return fmt.Errorf("path already exists: %v [%s]", dir, t.NodeType)
 	case f.root == "/" || strings.Count(dir, "/") == 1:
-		return f.api.CreateCollection(ctx, path.Base(dir))
-	default:
-		segments := pathSegments(dir, "/")
-		if len(segments) == 0 {
-			return fmt.Errorf("broken path: %s", dir)
-		}
-		var (
-			parent  *api.TreeNode
-			current string
-		)
-		for i, s := range segments {
-			fs.Debugf(f, "mkdir: %v %v %v", i, s, parent)
-			current = path.Join(current, s)
-			t, _ := f.api.ResolvePath(current)
-			switch {
-			case t != nil:
-				parent = t
-				continue
-			case t == nil && i == 0:
-				if err := f.api.CreateCollection(ctx, s); err != nil {
-					return err
-				}
-			default:
-				if err := f.api.CreateFolder(ctx, parent, s); err != nil {
-					return err
-				}
+		return f.api.CreateCollectionWithSettings(ctx, path.Base(dir), f.collectionSettings())
+	case len(segments) == 0:
+		return fmt.Errorf("broken path: %s", dir)
+	}
+	var parent *api.TreeNode
+	for i, s := range segments {
+		fs.Debugf(f, "mkdir: %v %v %v", i, s, parent)
+		current := prefixes[i+1]
+		if t := resolved[current]; t != nil {
+			parent = t
+			continue
+		}
+		if i == 0 {
+			if err := f.api.CreateCollectionWithSettings(ctx, s, f.collectionSettings()); err != nil {
+				return err
 			}
-			t, err := f.api.ResolvePath(current)
-			if err != nil {
+		} else {
+			if err := f.api.CreateFolder(ctx, parent, s); err != nil {
 				return err
 			}
-			parent = t
 		}
+		t, err := f.api.ResolvePath(ctx, current)
+		if err != nil {
+			return err
+		}
+		parent = t
 	}
 	return nil
 }
 
-// Rmdir deletes a folder. Collections cannot be removed.
+// Rmdir deletes an empty folder or an empty collection. Removing a
+// collection may be refused by the server, which is reported as
+// ErrCollectionNotRemovable.
 func (f *Fs) Rmdir(ctx context.Context, dir string) error {
 	fs.Debugf(f, "rmdir %v", f.absPath(dir))
-	t, err := f.api.ResolvePath(f.absPath(dir))
+	t, err := f.resolvePath(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if t.NodeType != "FOLDER" && t.NodeType != "COLLECTION" {
+		return fmt.Errorf("cannot delete node type %v", strings.ToLower(t.NodeType))
+	}
+	err = f.api.ForEachChild(ctx, t, func(*api.TreeNode) error {
+		return fs.ErrorDirectoryNotEmpty
+	})
 	if err != nil {
 		return err
 	}
-	if t.NodeType == "FOLDER" || t.NodeType == "COLLECTION" {
-		return f.api.Remove(ctx, t)
+	err = f.api.Remove(ctx, t)
+	var apiErr *oapi.APIError
+	if t.NodeType == "COLLECTION" && errors.As(err, &apiErr) && apiErr.NoRetry() && !errors.Is(err, fs.ErrorObjectNotFound) {
+		return fserrors.NoRetryError(fmt.Errorf("%w: %v: %v", ErrCollectionNotRemovable, t.Name, err))
 	}
-	return fmt.Errorf("cannot delete node type %v", strings.ToLower(t.NodeType))
+	return err
 }
 
 // Fs extra
 // --------
 
-// PublicLink returns the download link, if it exists.
+// PublicLink returns the download link, if it exists. The vault api has no
+// signed or expiring urls, so links cannot expire and cannot be removed.
 func (f *Fs) PublicLink(ctx context.Context, remote string, expire fs.Duration, unlink bool) (link string, err error) {
-	t, err := f.api.ResolvePath(f.absPath(remote))
+	if unlink {
+		return "", fmt.Errorf("vault download links cannot be removed: %w", fs.ErrorNotImplemented)
+	}
+	if expire < fs.DurationOff {
+		fs.Logf(f, "vault download links do not expire, ignoring expire %v", expire)
+	}
+	t, err := f.resolvePath(ctx, remote)
 	if err != nil {
 		return "", err
 	}
@@ -769,13 +2070,16 @@ func (f *Fs) PublicLink(ctx context.Context, remote string, expire fs.Duration,
 	}
 }
 
-// About returns currently only the quota.
+// About returns the quota of the organization. If the root is in a
+// collection, files and bytes used are those of the collection, for tracking
+// usage per project; total and free are always those of the organization,
+// as the quota is shared by all collections.
 func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
-	organization, err := f.api.Organization()
+	organization, err := f.api.Organization(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("api organization failed: %w", err)
 	}
-	stats, err := f.api.GetCollectionStats()
+	stats, err := f.api.GetCollectionStats(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("api collection failed: %w", err)
 	}
@@ -784,6 +2088,21 @@ func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
 		used     = stats.TotalSize()
 		free     = organization.QuotaBytes - used
 	)
+	if name := strings.SplitN(f.root, "/", 2)[0]; name != "" {
+		collections, err := f.api.FindCollections(ctx, url.Values{"name": []string{name}})
+		if err != nil {
+			return nil, fmt.Errorf("api collection failed: %w", err)
+		}
+		// A collection not created yet uses nothing.
+		numFiles, used = 0, 0
+		for _, c := range collections {
+			for _, s := range stats.Collections {
+				if s.ID == c.Identifier() {
+					numFiles, used = s.FileCount, s.TotalSize
+				}
+			}
+		}
+	}
 	return &fs.Usage{
 		Total:   &organization.QuotaBytes,
 		Used:    &used,
@@ -794,11 +2113,11 @@ func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
 
 // UserInfo returns some information about the user, organization and plan.
 func (f *Fs) UserInfo(ctx context.Context) (map[string]string, error) {
-	u, err := f.api.User()
+	u, err := f.api.User(ctx)
 	if err != nil {
 		return nil, err
 	}
-	organization, err := f.api.Organization()
+	organization, err := f.api.Organization(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -812,69 +2131,98 @@ func (f *Fs) UserInfo(ctx context.Context) (map[string]string, error) {
 	}, nil
 }
 
-// Disconnect logs out the current user.
+// Disconnect finalizes or, depending on on_disconnect, terminates the
+// inflight deposits, then logs out the current user and removes any persisted
+// session.
 func (f *Fs) Disconnect(ctx context.Context) error {
 	fs.Debugf(f, "disconnect")
+	if ids := f.inflightDeposits(); len(ids) > 0 {
+		ctx, cancel := f.shutdownContext(ctx)
+		defer cancel()
+		for _, id := range ids {
+			var err error
+			switch f.opt.OnDisconnect {
+			case onDisconnectTerminate:
+				err = f.abortDeposit(ctx, id)
+			default:
+				err = f.finalizeDeposit(ctx, id)
+			}
+			if err != nil {
+				return fmt.Errorf("not logging out, as deposit %d is still inflight: %w", id, err)
+			}
+		}
+	}
+	f.unregisterAtexit()
+	untrackDeposits(f)
 	f.api.Logout()
+	if f.opt.PersistSession {
+		return removeSession(f.name, &f.opt)
+	}
 	return nil
 }
 
 // DirMove implements server side renames and moves.
 func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
 	fs.Debugf(f, "dir move: %v [%v] => %v", src.Root(), srcRemote, f.root)
-	srcNode, err := f.api.ResolvePath(src.Root())
-	if err != nil {
-		return err
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		return fs.ErrorCantDirMove
 	}
-	srcDirParent := path.Dir(src.Root())
-	srcDirParentNode, err := f.api.ResolvePath(srcDirParent)
+	var (
+		srcRoot = srcFs.absPath("")
+		dstRoot = f.absPath("")
+	)
+	var (
+		// The parent of a collection is the organization, at "/".
+		srcDirParent = path.Dir(path.Join("/", srcRoot))
+		dstDirParent = path.Dir(path.Join("/", dstRoot))
+	)
+	// The paths share most of their ancestors, resolve them at once.
+	nodes, err := f.api.ResolvePaths(ctx, []string{srcRoot, srcDirParent, dstDirParent, dstRoot})
 	if err != nil {
 		return err
 	}
-	dstDirParent := path.Dir(f.root)
-	dstDirParentNode, err := f.api.ResolvePath(dstDirParent)
-	if err != nil {
-		return err
+	srcNode, srcDirParentNode, dstDirParentNode := nodes[srcRoot], nodes[srcDirParent], nodes[dstDirParent]
+	if srcNode == nil || srcDirParentNode == nil || dstDirParentNode == nil {
+		return fs.ErrorObjectNotFound
+	}
+	if srcNode.NodeType == "COLLECTION" {
+		return f.renameCollection(ctx, srcNode, dstDirParentNode, nodes[dstRoot], path.Base(dstRoot))
 	}
 	if srcDirParentNode.ID == dstDirParentNode.ID {
 		fs.Debugf(f, "move is a rename")
-		t, err := f.api.ResolvePath(src.Root())
-		if err != nil {
-			return err
-		}
-		return f.api.Rename(ctx, t, path.Base(f.root))
+		return f.api.Rename(ctx, srcNode, path.Base(dstRoot))
 	} else {
 		switch {
 		case srcNode.NodeType == "FILE":
-			// If f.root exists and is a directory, we can move the file in
-			// there; if f.root does not exists, we treat the parent as the dir
+			// If dstRoot exists and is a directory, we can move the file in
+			// there; if dstRoot does not exists, we treat the parent as the dir
 			// and the base as the file to copy to.
-			rootNode, err := f.api.ResolvePath(f.root)
-			if err == nil {
+			if rootNode := nodes[dstRoot]; rootNode != nil {
 				if err := f.api.Move(ctx, srcNode, rootNode); err != nil {
 					return err
 				}
 			} else {
-				dstDir := path.Dir(f.root)
+				dstDir := path.Dir(dstRoot)
 				if err := f.mkdir(ctx, dstDir); err != nil {
 					return err
 				}
-				dstDirNode, err := f.api.ResolvePath(dstDir)
+				dstDirNode, err := f.api.ResolvePath(ctx, dstDir)
 				if err != nil {
 					return err
 				}
 				if err := f.api.Move(ctx, srcNode, dstDirNode); err != nil {
 					return err
 				}
-				if path.Base(f.root) != path.Base(src.Root()) {
-					return f.api.Rename(ctx, srcNode, path.Base(f.root))
+				if path.Base(dstRoot) != path.Base(srcRoot) {
+					return f.api.Rename(ctx, srcNode, path.Base(dstRoot))
 				}
 			}
-		case srcNode.NodeType == "FOLDER" || srcNode.NodeType == "COLLECTION":
-			fs.Debugf(f, "moving dir to %v", f.root)
-			p, err := f.api.ResolvePath(f.root)
-			if err != nil {
-				return err
+		case srcNode.NodeType == "FOLDER":
+			fs.Debugf(f, "moving dir to %v", dstRoot)
+			p := nodes[dstRoot]
+			if p == nil {
+				return fs.ErrorObjectNotFound
 			}
 			return f.api.Move(ctx, srcNode, p)
 		}
@@ -884,7 +2232,7 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 
 // Purge remove a folder.
 func (f *Fs) Purge(ctx context.Context, dir string) error {
-	t, err := f.api.ResolvePath(f.absPath(dir))
+	t, err := f.resolvePath(ctx, dir)
 	if err != nil {
 		return err
 	}
@@ -894,78 +2242,870 @@ func (f *Fs) Purge(ctx context.Context, dir string) error {
 	return f.api.Remove(ctx, t)
 }
 
+// Shutdown finalizes the inflight deposits, waiting at most shutdown_timeout.
 func (f *Fs) Shutdown(ctx context.Context) error {
-	return f.finalize(ctx)
+	ctx, cancel := f.shutdownContext(ctx)
+	defer cancel()
+	var errs []error
+	for _, id := range f.inflightDeposits() {
+		err := f.finalizeDeposit(ctx, id)
+		if errors.Is(err, context.DeadlineExceeded) {
+			fs.Errorf(f, "finalize of deposit %d timed out after %v, finalize it later with: rclone rc --loopback vault/deposits/finalize fs=%s: id=%d",
+				id, f.opt.ShutdownTimeout, f.name, id)
+			// The finalize request may still succeed, do not terminate
+			// the deposit on exit.
+			f.resetDeposit(id)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err := errors.Join(errs...)
+	if err == nil {
+		// Nothing left to terminate on interrupt.
+		f.unregisterAtexit()
+		untrackDeposits(f)
+	}
+	if f.persistent != nil {
+		if cerr := f.persistent.Close(); cerr != nil {
+			fs.Debugf(f, "failed to close persistent cache: %v", cerr)
+		}
+	}
+	return err
 }
 
-// Terminate the currently running deposit.
+// Terminate handles an interrupted transfer, by terminating or, depending on
+// on_interrupt, finalizing the inflight deposits. Only the first call has an
+// effect and no deposits are registered afterwards, so uploads still running
+// cannot start a new deposit while rclone exits.
 func (f *Fs) Terminate() {
-	if f.inflightDepositID == 0 {
+	f.mu.Lock()
+	if f.terminated {
+		f.mu.Unlock()
+		return
+	}
+	f.terminated = true
+	ids := f.inflightIDs()
+	f.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+	ctx, cancel := f.shutdownContext(context.Background())
+	defer cancel()
+	for _, id := range ids {
+		f.interruptDeposit(ctx, id)
+	}
+}
+
+// interruptDeposit terminates or, depending on on_interrupt, finalizes an
+// inflight deposit on interrupt.
+func (f *Fs) interruptDeposit(ctx context.Context, id int) {
+	if f.finalizeOnInterrupt(id) {
+		if err := f.finalizeDeposit(ctx, id); err != nil {
+			fs.LogLevelPrintf(fs.LogLevelWarning, f, "finalize deposit failed: %v", err)
+			return
+		}
+		fs.Logf(f, "finalized deposit %d on user request, keeping files uploaded so far", id)
 		return
 	}
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	body := TerminateDepositRequest{
-		DepositId: f.inflightDepositID,
+	if f.depositByID(id) == nil {
+		// A shutdown finalized the deposit, while we waited for the lock.
+		fs.Logf(f, "deposit %d was finalized before it could be terminated", id)
+		return
 	}
-	ctx := context.Background()
-	resp, err := f.depositsV2Client.VaultDepositApiTerminateDeposit(ctx, body)
-	if err != nil {
+	if err := f.depositor.terminate(ctx, id); err != nil {
 		fs.LogLevelPrintf(fs.LogLevelWarning, f, "terminate deposit failed: %v", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			fs.Logf(f, "deposit %d may still be registered, abort it later with: rclone rc --loopback vault/deposits/abort fs=%s: id=%d",
+				id, f.name, id)
+		}
 		return
 	}
-	if resp.StatusCode != 200 {
-		fs.LogLevelPrintf(fs.LogLevelWarning, f, "terminate deposit failed: %v", resp.StatusCode)
-		return
+	f.forgetDeposit(id)
+	fs.Logf(f, "terminated deposit %d on user request", id)
+}
+
+// registerAtexit registers Terminate to run on interrupt, unless registered
+// already. Must not be called with f.mu held.
+func (f *Fs) registerAtexit() {
+	f.atexitMu.Lock()
+	defer f.atexitMu.Unlock()
+	if f.atexit == nil {
+		f.atexit = atexit.Register(f.Terminate)
 	}
-	fs.Logf(f, "terminated deposit %d on user request", f.inflightDepositID)
 }
 
-// finalize sends finalize signal, only once, called on normal shutdown and on
-// interrupted shutdown.
-func (f *Fs) finalize(ctx context.Context) error {
+// unregisterAtexit removes the interrupt handler, so an fs that is done does
+// not linger in the atexit handlers of a long running process, e.g. rcd.
+func (f *Fs) unregisterAtexit() {
+	f.atexitMu.Lock()
+	defer f.atexitMu.Unlock()
+	if f.atexit != nil {
+		atexit.Unregister(f.atexit)
+		f.atexit = nil
+	}
+}
+
+// finalizeOnInterrupt returns true, if the deposit is to be finalized instead
+// of terminated on interrupt, cf. on_interrupt.
+func (f *Fs) finalizeOnInterrupt(id int) bool {
+	switch f.opt.OnInterrupt {
+	case onInterruptFinalize:
+		return true
+	case onInterruptAsk:
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			fs.Logf(f, "cannot ask without a terminal, terminating deposit %d", id)
+			return false
+		}
+		fmt.Printf("\nFinalize deposit %d, keeping the files uploaded so far? Otherwise, the deposit is terminated.\n", id)
+		return config.Confirm(false)
+	default:
+		return false
+	}
+}
+
+// shutdownContext returns a context bounded by shutdown_timeout, if set.
+func (f *Fs) shutdownContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.opt.ShutdownTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(f.opt.ShutdownTimeout))
+}
+
+// inflightDeposit returns the id of the inflight deposit, 0 if there is none.
+// With several deposits inflight, it is the one registered first.
+func (f *Fs) inflightDeposit() int {
+	if ids := f.inflightDeposits(); len(ids) > 0 {
+		return ids[0]
+	}
+	return 0
+}
+
+// inflightDeposits returns the ids of all inflight deposits, in order.
+func (f *Fs) inflightDeposits() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inflightIDs()
+}
+
+// isInflight returns true, if the deposit with the given id is inflight.
+func (f *Fs) isInflight(id int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.depositByID(id) != nil
+}
+
+// hasDeposit returns true, if a deposit into the directory at the absolute
+// path dir is inflight.
+func (f *Fs) hasDeposit(dir string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.deposits[dir]
+	return ok
+}
+
+// depositElapsed returns the time since a deposit was registered, for log
+// messages, zero if it is not inflight.
+func (f *Fs) depositElapsed(id int) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := f.depositByID(id)
+	if d == nil {
+		return 0
+	}
+	return time.Since(d.started)
+}
+
+// forgetDeposit removes a deposit from the inflight deposits, if it is
+// inflight. Expects f.mu to be held.
+func (f *Fs) forgetDeposit(id int) {
+	if d := f.depositByID(id); d != nil {
+		delete(f.deposits, d.dir)
+	}
+}
+
+// resetDeposit forgets the inflight deposit with the given id, if it is still
+// inflight, so the next upload into its directory registers a new deposit.
+func (f *Fs) resetDeposit(id int) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	if f.inflightDepositID == 0 {
+	f.forgetDeposit(id)
+}
+
+// lastDeposit returns the id of the last finalized deposit, 0 if there is
+// none.
+func (f *Fs) lastDeposit() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastDepositID
+}
+
+// abortDeposit terminates a deposit. If it is an inflight deposit, the next
+// upload into its directory registers a new one.
+func (f *Fs) abortDeposit(ctx context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.depositor.terminate(ctx, id); err != nil {
+		return err
+	}
+	f.forgetDeposit(id)
+	fs.Logf(f, "terminated deposit %d", id)
+	return nil
+}
+
+// finalize sends the finalize signal for all inflight deposits. Deposits are
+// finalized independently; a failure does not keep the others from being
+// finalized.
+func (f *Fs) finalize(ctx context.Context) error {
+	var errs []error
+	for _, id := range f.inflightDeposits() {
+		if err := f.finalizeDeposit(ctx, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// finalizeDeposit sends the finalize signal for an inflight deposit, only
+// once, called on normal shutdown and on interrupted shutdown. A deposit no
+// longer inflight is left alone. The lock is held for the finalize request
+// only; once finalized, the deposit is no longer inflight, so recording its
+// metadata does not stall other deposits or the progress in the stats.
+func (f *Fs) finalizeDeposit(ctx context.Context, id int) error {
+	f.mu.Lock()
+	d := f.depositByID(id)
+	if d == nil {
 		// nothing to be done
+		f.mu.Unlock()
 		return nil
 	}
-	fs.Debugf(f, "finalizing deposit %v", f.inflightDepositID)
-	body := VaultDepositApiFinalizeDepositJSONRequestBody{
-		DepositId: f.inflightDepositID,
+	fs.Debugf(f, "finalizing deposit %v", d.id)
+	err := f.depositor.finalize(ctx, d.id)
+	summary := *d
+	if err == nil {
+		fs.Debugf(f, "finalize done")
+		fs.Logf(f, "deposit %d finalized: %d files, %v in %v, see %v", d.id, d.files,
+			fs.SizeSuffix(d.bytes), time.Since(d.started).Truncate(time.Second), f.opt.DepositURL(d.id))
+		if f.opt.ManifestPath != "" {
+			if err := f.writeManifest(d.id, d.manifest); err != nil {
+				fs.Errorf(f, "could not write manifest of deposit %d: %v", d.id, err)
+			}
+		}
+		f.lastDepositID = d.id
+		delete(f.deposits, d.dir)
+	}
+	f.mu.Unlock()
+	if f.opt.OnFinalizeURL != "" {
+		f.notifyFinalize(ctx, &summary, err)
 	}
-	resp, err := f.depositsV2Client.VaultDepositApiFinalizeDepositWithResponse(ctx, body)
 	if err != nil {
 		return err
 	}
-	if resp.StatusCode() != 200 {
-		fs.Debugf(f, "[finalize] got %v -- response dump follows", resp.StatusCode())
-		b, err := httputil.DumpResponse(resp.HTTPResponse, true)
-		if err != nil {
-			return err
-		}
-		fs.Debugf(f, string(b))
-		return fmt.Errorf("finalize got: %v", resp.StatusCode())
+	f.api.InvalidateCache()
+	err = f.recordMetadata(ctx, d)
+	f.removeSuperseded(ctx, d.superseded)
+	return err
+}
+
+// checkDepositOpen returns ErrDepositClosed, if the deposit is known to no
+// longer accept uploads, e.g. completed by the server early or terminated.
+func (f *Fs) checkDepositOpen(ctx context.Context, id int) error {
+	d, err := f.api.Deposit(ctx, int64(id))
+	if err != nil {
+		fs.Debugf(f, "cannot determine state of deposit %d: %v", id, err)
+		return nil
+	}
+	if d.State != "" && !d.State.IsOpen() {
+		return fmt.Errorf("%w: deposit %d is %s", ErrDepositClosed, id, d.State)
 	}
-	fs.Debugf(f, "finalize done")
-	f.inflightDepositID = 0
 	return nil
 }
 
-// Command allows for custom commands. TODO(martin): We could have a cli dashboard or a deposit status command.
-// func (f *Fs) Command(ctx context.Context, name string, args []string, opt map[string]string) (out interface{}, err error) {
-// 	// TODO: fixity reports, distribution, ...
-// 	switch name {
-// 	default:
-// 		return nil, fmt.Errorf("command not found")
-// 	}
-// }
+// recordMetadata stores the original name of sanitized files and the
+// deposit metadata, if any, in the treenode metadata of the files of a
+// finalized deposit. The server assembles the files after finalize, so we
+// wait for each file to appear, for up to DepositAssemblyWait for all files
+// of the deposit. The original names would be lost otherwise, so failing to
+// record them is an error; other failures are logged only.
+func (f *Fs) recordMetadata(ctx context.Context, d *deposit) error {
+	ctx, cancel := context.WithTimeout(ctx, DepositAssemblyWait)
+	defer cancel()
+	var (
+		meta  = f.depositMetadata(d.id)
+		paths = make(map[string]string) // absolute path to original name, if renamed
+	)
+	if meta != nil {
+		for remote := range d.deposited {
+			paths[f.absPath(remote)] = ""
+		}
+	}
+	for p, remote := range d.renamed {
+		paths[p] = remote
+	}
+	var errs []error
+	for p, remote := range paths {
+		m := make(map[string]interface{}, len(meta)+1)
+		for k, v := range meta {
+			m[k] = v
+		}
+		if remote != "" {
+			m["original_name"] = remote
+		}
+		t, err := f.waitForTreeNode(ctx, p)
+		if err == nil && t != nil {
+			err = f.api.SetMetadata(ctx, t, m)
+		}
+		switch {
+		case err == nil:
+		case remote != "":
+			errs = append(errs, fmt.Errorf("could not record original name %q of %v: %w", remote, p, err))
+		default:
+			fs.Logf(f, "could not record metadata %v of %v: %v", m, p, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// waitForTreeNode resolves the path of a file of a finalized deposit, retrying
+// as long as the file is not found, as it exists only once the server
+// assembled it.
+func (f *Fs) waitForTreeNode(ctx context.Context, p string) (t *api.TreeNode, err error) {
+	backoff := retry.WithCappedDuration(hashPollMaxSleep, retry.NewFibonacci(hashPollMinSleep))
+	err = retry.Do(ctx, backoff, func(ctx context.Context) error {
+		t, err = f.api.ResolvePath(ctx, p)
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			return retry.RetryableError(err)
+		}
+		return err
+	})
+	return t, err
+}
+
+// depositMetadata returns the descriptive metadata of a deposit, as given in
+// the options, or nil if there is none.
+func (f *Fs) depositMetadata(id int) map[string]interface{} {
+	m := make(map[string]interface{})
+	for k, v := range map[string]string{
+		"deposit_title":            f.opt.DepositTitle,
+		"deposit_description":      f.opt.DepositDescription,
+		"deposit_accession_number": f.opt.DepositAccessionNumber,
+	} {
+		if v != "" {
+			m[k] = v
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	m["deposit_id"] = id
+	return m
+}
+
+var commandHelp = []fs.CommandHelp{
+	{
+		Name:  "organizations",
+		Short: "List organizations accessible to the current user.",
+		Long: `This lists the names of all organizations the user can access. Use
+one of these names as the "organization" option to switch organizations.
+
+    rclone backend organizations vault:
+`,
+	},
+	{
+		Name:  "benchmark",
+		Short: "Upload synthetic data to measure throughput per chunk size and concurrency.",
+		Long: `This uploads generated data with every combination of chunk size and
+concurrency and reports the throughput of each configuration, to help
+choosing the chunk_size for a link. Run it against a collection or folder;
+the files are stored in a "rclone-benchmark-*" folder and are kept.
+
+    rclone backend benchmark vault:mycollection -o size=10G -o files=100
+    rclone backend benchmark vault:mycollection -o chunk_sizes=1M,8M -o concurrency=1,2,8
+
+Note, that every configuration uploads the full size.
+`,
+		Opts: map[string]string{
+			"size":        "Total size of the data per configuration (default 1G)",
+			"files":       "Number of files to split the data into (default 10)",
+			"chunk_sizes": "Comma separated list of chunk sizes (default 1M,16M,64M)",
+			"concurrency": "Comma separated list of parallel uploads (default 1,4)",
+		},
+	},
+	{
+		Name:  "calibrate",
+		Short: "Measure a few upload configurations and recommend a chunk size.",
+		Long: `This uploads a short synthetic deposit with several chunk sizes and
+concurrencies and recommends the fastest combination. Run it against a
+scratch collection; the files are stored in a "rclone-calibrate-*" folder and
+are kept. With -o save the recommended chunk size is written into the config
+section of the remote. Concurrency is reported as a value for --transfers and
+is not saved.
+
+    rclone backend calibrate vault:scratch
+    rclone backend calibrate vault:scratch -o save
+    rclone backend calibrate vault:scratch -o chunk_sizes=4M,32M -o concurrency=2,8
+`,
+		Opts: map[string]string{
+			"size":        "Total size of the data per configuration (default 64M)",
+			"files":       "Number of files to split the data into (default 4)",
+			"chunk_sizes": "Comma separated list of chunk sizes (default 1M,4M,16M,64M)",
+			"concurrency": "Comma separated list of parallel uploads (default 1,2,4)",
+			"save":        "Write the recommended chunk size into the config",
+		},
+	},
+	{
+		Name:  "bag",
+		Short: "Deposit a directory as a BagIt bag.",
+		Long: `This uploads a source directory as the payload of a BagIt bag (RFC
+8493) and adds bagit.txt, bag-info.txt and the manifests, generated from
+the checksums computed during upload. The deposit is finalized afterwards.
+Any option other than "name" and "algorithms" is added to bag-info.txt.
+
+    rclone backend bag vault:mycollection /path/to/source
+    rclone backend bag vault:mycollection /path/to/source -o name=bag-2023 -o Source-Organization="Example Library"
+
+Paths must be valid vault paths, as with sanitize_paths the manifests would
+not match the stored names.
+`,
+		Opts: map[string]string{
+			"name":       "Name of the bag directory (default name of the source directory)",
+			"algorithms": "Comma separated list of manifest algorithms: md5, sha1, sha256 (default sha256)",
+		},
+	},
+	{
+		Name:  "export",
+		Short: "Download a collection or folder into a single tar or zip archive.",
+		Long: `This downloads all files below the remote root into a single archive
+in a local directory, e.g. to produce a dissemination package. The archive
+contains a BagIt bag (RFC 8493), with the files below data/ and manifests of
+the checksums computed during download. Checksums stored in vault are
+verified, if available.
+
+    rclone backend export vault:mycollection /path/to/dir
+    rclone backend export vault:mycollection/folder /path/to/dir -o format=zip -o algorithms=md5,sha256
+
+The archive is written to <dir>/<name>.<format>.
+`,
+		Opts: map[string]string{
+			"format":     "Archive format: tar or zip (default tar)",
+			"name":       "Name of the archive and of the bag directory (default name of the root)",
+			"algorithms": "Comma separated list of manifest algorithms: md5, sha1, sha256 (default sha256)",
+		},
+	},
+	{
+		Name:  "mets",
+		Short: "Write a METS document with PREMIS records for a collection or folder.",
+		Long: `This writes a METS document for all files below the remote root, with
+a structural map of the tree, and PREMIS records with size and checksums
+of each file and, as far as known, its deposit: upload time and user from
+vault, deposit id from the manifests, see manifest_path.
+
+    rclone backend mets vault:mycollection/folder
+    rclone backend mets vault:mycollection/folder -o output=mets.xml
+    rclone backend mets vault:mycollection/folder -o upload
+
+With "upload", the document is deposited next to the files, as mets.xml,
+and left out of the document itself when it is written again.
+`,
+		Opts: map[string]string{
+			"output":   "write the document to this local file instead of stdout",
+			"upload":   "deposit the document into the remote root",
+			"name":     "Name of the uploaded document (default mets.xml)",
+			"manifest": "Manifest file to take deposit ids from (default manifest_path)",
+		},
+	},
+	{
+		Name:  "audit",
+		Short: "Compare files in vault with a source by size and checksum.",
+		Long: `This lists the remote and a source, e.g. the source of a finished sync,
+and compares every file by size, MD5 and SHA256, as far as the source
+supports them. The result passes, if all files match; missing, extra and
+mismatched files are listed as failures.
+
+    rclone backend audit vault:mycollection /path/to/source
+    rclone backend audit vault:mycollection /path/to/source -o wait=1h -o deposit=1234
+
+With "wait", the audit waits until all files of the deposit are stored, as
+checksums in vault are only complete afterwards.
+`,
+		Opts: map[string]string{
+			"wait":    "Wait this long for the deposit to be processed, e.g. 30m",
+			"deposit": "Deposit id to wait for (default last deposit of this process)",
+		},
+	},
+	{
+		Name:  "report",
+		Short: "Write a preservation report of collections, fixity checks and files.",
+		Long: `This reports, per collection, the number of files and bytes, the fixity
+settings and the outcome of the latest fixity check. With "files", the
+report lists every file below the remote root with size and checksums
+instead, which may take a while for large collections.
+
+    rclone backend report vault: -o format=csv
+    rclone backend report vault:mycollection -o files -o format=csv -o output=files.csv
+
+A JSON report contains both collections and files.
+`,
+		Opts: map[string]string{
+			"format": "Output format: json or csv (default json)",
+			"files":  "Include all files with size and checksums",
+			"output": "Write the report to this file instead of stdout",
+		},
+	},
+	{
+		Name:  "receipt",
+		Short: "Write a receipt of a finalized deposit.",
+		Long: `This writes a JSON receipt of a deposit for accession records: the
+deposit state with the time each state was reached, the processing status
+and the files with size and checksums. Without an id, the receipt is for the
+last deposit finalized in this run.
+
+    rclone backend receipt vault: 1234 -o manifest=manifest.json
+    rclone backend receipt vault: 1234 -o manifest=manifest.json -o output=receipt-1234.json
+
+Vault does not record which files belong to a deposit, so the file list is
+taken from a manifest written with manifest_path during the deposit.
+Checksums are those computed by vault, if the files have been assembled.
+The receipt is not signed.
+`,
+		Opts: map[string]string{
+			"manifest": "Manifest file written during the deposit (default manifest_path)",
+			"output":   "Write the receipt to this file instead of stdout",
+		},
+	},
+	{
+		Name:  "versions",
+		Short: "List or save the versions of a file.",
+		Long: `This lists all versions of a file, oldest first, if vault retains
+previous versions of a file deposited again, cf. update_mode. With "id"
+and "output", the given version is saved to a local file.
+
+    rclone backend versions vault:mycollection file.txt
+    rclone backend versions vault:mycollection file.txt -o id=123 -o output=file.txt
+
+Use version_at to read all files as they were at a given time.
+`,
+		Opts: map[string]string{
+			"id":     "Version to save",
+			"output": "Local file to save the version to",
+		},
+	},
+	{
+		Name:  "access",
+		Short: "List users and whether they are authorized for a collection.",
+		Long: `This lists all users of the organization with their role and whether
+the collection of the remote is among their authorized collections.
+
+    rclone backend access vault:mycollection
+`,
+	},
+	{
+		Name:  "grant",
+		Short: "Authorize users for a collection.",
+		Long: `This adds the collection of the remote to the authorized collections of
+the given users and, with "role", sets the role of these users for the
+whole organization.
+
+    rclone backend grant vault:mycollection alice bob
+    rclone backend grant vault:mycollection alice -o role=VIEWER
+
+Changing user access requires an admin account.
+`,
+		Opts: map[string]string{
+			"role": "Role to set: ADMIN, USER, VIEWER or READ_ONLY",
+		},
+	},
+	{
+		Name:  "revoke",
+		Short: "Remove the authorization of users for a collection.",
+		Long: `This removes the collection of the remote from the authorized
+collections of the given users.
+
+    rclone backend revoke vault:mycollection alice
+`,
+		Opts: map[string]string{
+			"role": "Role to set: ADMIN, USER, VIEWER or READ_ONLY",
+		},
+	},
+	{
+		Name:  "collection-set",
+		Short: "Change fixity frequency and target replication of a collection.",
+		Long: `This changes the settings of the collection of the remote; settings not
+given are left unchanged.
+
+    rclone backend collection-set vault:mycollection -o fixity_frequency=QUARTERLY -o replication=3
+
+Use collection_fixity_frequency and collection_target_replication to set
+these for new collections.
+`,
+		Opts: map[string]string{
+			"fixity_frequency": "Fixity check frequency: TWICE_YEARLY, QUARTERLY or MONTHLY",
+			"replication":      "Target number of copies: 2, 3 or 4",
+		},
+	},
+	{
+		Name:  "users",
+		Short: "List the users of the organization.",
+		Long: `This lists all users of the organization with their role, last login
+and the collections they are authorized for. Listing other users requires
+an admin account.
+
+    rclone backend users vault:
+`,
+	},
+	{
+		Name:  "usage",
+		Short: "Report the storage used per collection.",
+		Long: `This reports the quota of the organization, the bytes and files used
+in total and per collection, largest first, with the share of each
+collection of the bytes used. Vault does not record usage per user.
+
+    rclone backend usage vault:
+`,
+	},
+	{
+		Name:  "usage-history",
+		Short: "Report the storage used over time.",
+		Long: `This reports the files and bytes used per day, week or month, per
+collection or for the whole organization, e.g. for capacity trend
+dashboards. Vault records the size of a collection with every deposit and
+fixity check, so the usage of a period is that of the latest of these up
+to the end of the period. With a collection as root, only that collection
+is reported.
+
+    rclone backend usage-history vault:
+    rclone backend usage-history vault: -o interval=month -o group=organization
+    rclone backend usage-history vault:/C1 -o since=2024-01-01 -o format=json
+`,
+		Opts: map[string]string{
+			"since":    "start of the report, a date or a duration ago, e.g. 90d; defaults to the first report",
+			"interval": "day (default), week or month",
+			"group":    "collection (default) or organization",
+			"format":   "csv (default) or json",
+			"output":   "write the report to this file instead of stdout",
+		},
+	},
+	{
+		Name:  "geolocations",
+		Short: "Report how copies are distributed across locations.",
+		Long: `This reports, per collection and target location, the number of copies
+kept, the bytes of the collection and the bytes stored at the location,
+e.g. for disaster recovery audits. With a collection as root, only that
+collection is reported, with a folder as root, the bytes of the files
+below the folder.
+
+    rclone backend geolocations vault:
+    rclone backend geolocations vault:/C1/a -o format=json -o output=geo.json
+`,
+		Opts: map[string]string{
+			"format": "csv (default) or json",
+			"output": "write the report to this file instead of stdout",
+		},
+	},
+	{
+		Name:  "warm",
+		Short: "Fetch all files and folders below the root into the cache.",
+		Long: `This fetches all treenodes below the root with a few paginated
+requests and stores the paths and listings in the persistent cache, so a
+subsequent mount or sync starts with hot metadata, e.g. before a time
+critical restore. Requires cache_ttl to be set; the cache is cleared on
+every change done through this remote and expires after cache_ttl.
+
+    rclone backend warm vault:/C1 --vault-cache-ttl 24h
+`,
+	},
+	{
+		Name:  "comment",
+		Short: "Get the comment of a file or folder.",
+		Long: `This prints the comment of a file or folder, relative to the remote.
+
+    rclone backend comment vault:mycollection get a/b.txt
+
+Comments are also part of the metadata, e.g. with "rclone lsjson -M". The
+vault server does not allow changing comments, so there is no "set".
+`,
+	},
+}
+
+// Command allows for custom commands. TODO(martin): We could have a cli
+// dashboard or a deposit status command, fixity reports, distribution, ...
+func (f *Fs) Command(ctx context.Context, name string, args []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "organizations":
+		return f.organizationsCommand(ctx)
+	case "benchmark":
+		return f.benchmarkCommand(ctx, opt)
+	case "calibrate":
+		return f.calibrateCommand(ctx, opt)
+	case "bag":
+		return f.bagCommand(ctx, args, opt)
+	case "export":
+		return f.exportCommand(ctx, args, opt)
+	case "mets":
+		return f.metsCommand(ctx, opt)
+	case "report":
+		return f.reportCommand(ctx, opt)
+	case "receipt":
+		return f.receiptCommand(ctx, args, opt)
+	case "audit":
+		return f.auditCommand(ctx, args, opt)
+	case "versions":
+		return f.versionsCommand(ctx, args, opt)
+	case "access":
+		return f.accessCommand(ctx)
+	case "grant":
+		return f.grantCommand(ctx, args, opt, false)
+	case "revoke":
+		return f.grantCommand(ctx, args, opt, true)
+	case "collection-set":
+		return f.collectionSetCommand(ctx, opt)
+	case "users":
+		return f.usersCommand(ctx)
+	case "usage":
+		return f.usageCommand(ctx)
+	case "usage-history":
+		return f.usageHistoryCommand(ctx, opt)
+	case "geolocations":
+		return f.geolocationsCommand(ctx, opt)
+	case "warm":
+		return f.warmCommand(ctx)
+	case "comment":
+		return f.commentCommand(ctx, args)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// organizationsCommand lists all accessible organizations, marking the
+// currently selected one.
+func (f *Fs) organizationsCommand(ctx context.Context) (out interface{}, err error) {
+	orgs, err := f.api.Organizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current, err := f.api.Organization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]interface{}
+	for _, org := range orgs {
+		result = append(result, map[string]interface{}{
+			"name":       org.Name,
+			"quotaBytes": org.QuotaBytes,
+			"selected":   org.Name == current.Name,
+		})
+	}
+	return result, nil
+}
 
 // Fs helpers
 // ----------
 
+// storedRemote returns the remote as stored in vault. The name is checked
+// after encoding, as the encoding already takes care of e.g. control
+// characters or leading spaces. Names vault cannot store result in
+// ErrInvalidPath, unless sanitize_paths is set.
+func (f *Fs) storedRemote(remote string) (string, error) {
+	remote = f.norm.Apply(remote)
+	encoded := f.opt.Enc.FromStandardPath(remote)
+	err := pathutil.Validate(encoded)
+	if err == nil {
+		return remote, nil
+	}
+	if !f.opt.SanitizePaths {
+		return "", fmt.Errorf("%w %q: %w", ErrInvalidPath, remote, err)
+	}
+	sanitized := f.opt.Enc.ToStandardPath(pathutil.Sanitize(encoded))
+	fs.Debugf(f, "sanitized %q to %q", remote, sanitized)
+	return sanitized, nil
+}
+
+// claimRemote registers remote as the target of source within the deposit
+// d. If another source already claimed remote, this is an
+// ErrDuplicateRemote, unless uniquify_duplicates is set, in which case the
+// next free name is returned. Uploading the same source again, e.g. on retry,
+// is fine.
+func (f *Fs) claimRemote(d *deposit, source, remote string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var (
+		candidate = remote
+		ext       = path.Ext(remote)
+		stem      = strings.TrimSuffix(remote, ext)
+	)
+	for i := 1; ; i++ {
+		other, ok := d.deposited[candidate]
+		if !ok || other == source {
+			break
+		}
+		if !f.opt.Uniquify {
+			return "", fmt.Errorf("%w: %q and %q both map to %q", ErrDuplicateRemote, other, source, remote)
+		}
+		candidate = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	if candidate != remote {
+		fs.Logf(f, "%q conflicts with %q, uploading as %q", source, d.deposited[remote], candidate)
+	}
+	d.deposited[candidate] = source
+	return candidate, nil
+}
+
+// standardName decodes and normalizes a name found in vault.
+func (f *Fs) standardName(name string) string {
+	return f.norm.Apply(f.opt.Enc.ToStandardName(name))
+}
+
+// resolvePath returns the treenode at remote. With normalization, a name
+// stored in another normal form, e.g. uploaded from macOS before
+// normalization was set, is found by comparing the normalized names of the
+// children of its folder.
+func (f *Fs) resolvePath(ctx context.Context, remote string) (*api.TreeNode, error) {
+	t, err := f.api.ResolvePath(ctx, f.absPath(remote))
+	if err != fs.ErrorObjectNotFound || f.norm == pathutil.NormalizationNone || !pathutil.Varies(remote) {
+		return t, err
+	}
+	parent, err := f.resolvePath(ctx, path.Dir(remote))
+	if err != nil {
+		return nil, err
+	}
+	ts, err := f.childrenNamed(ctx, parent, path.Base(remote))
+	switch {
+	case err != nil:
+		return nil, err
+	case len(ts) == 0:
+		return nil, fs.ErrorObjectNotFound
+	case len(ts) > 1:
+		return nil, oapi.ErrAmbiguousQuery
+	}
+	return ts[0], nil
+}
+
+// childrenNamed returns the children of parent with the given name, e.g. the
+// versions of a file. With normalization, children whose name is stored in
+// another normal form are found as well.
+func (f *Fs) childrenNamed(ctx context.Context, parent *api.TreeNode, name string) ([]*api.TreeNode, error) {
+	ts, err := f.api.FindTreeNodes(ctx, url.Values{
+		"parent": []string{fmt.Sprintf("%d", parent.ID)},
+		"name":   []string{f.opt.Enc.FromStandardName(name)},
+	})
+	if err != nil || len(ts) > 0 || f.norm == pathutil.NormalizationNone || !pathutil.Varies(name) {
+		return ts, err
+	}
+	name = f.norm.Apply(name)
+	err = f.api.ForEachChild(ctx, parent, func(t *api.TreeNode) error {
+		if f.standardName(t.Name) == name {
+			ts = append(ts, t)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// absPath returns the absolute path of p, encoded for vault.
 func (f *Fs) absPath(p string) string {
-	return path.Join(f.root, p)
+	return f.opt.Enc.FromStandardPath(path.Join(f.root, p))
 }
 
 func pathSegments(p string, sep string) (result []string) {
@@ -1027,6 +3167,9 @@ func (o *Object) Hash(ctx context.Context, ty hash.Type) (string, error) {
 	if o.treeNode == nil {
 		return "", nil
 	}
+	if ty == hash.MD5 || ty == hash.SHA1 || ty == hash.SHA256 {
+		o.waitForHash(ctx, ty)
+	}
 	switch ty {
 	case hash.MD5:
 		if v, ok := o.treeNode.Md5Sum.(string); ok {
@@ -1073,11 +3216,41 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadClo
 }
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
 	fs.Debugf(o, "updating object contents at %v", o.ID())
-	_, err := o.fs.Put(ctx, in, src, options...)
-	return err
+	if o.fs.opt.Immutable {
+		return fserrors.NoRetryError(fmt.Errorf("%w: %v", ErrImmutable, o.ID()))
+	}
+	obj, err := o.fs.Put(ctx, in, src, options...)
+	if err != nil {
+		return err
+	}
+	if o.fs.opt.UpdateMode == updateModeReplace && o.treeNode != nil {
+		o.fs.supersede(o.absPath(), o.treeNode)
+	}
+	// The object reflects the new contents, which may have been of unknown
+	// size before the upload; the treenode is only replaced on finalize.
+	if uploaded, ok := obj.(*Object); ok {
+		var t api.TreeNode
+		if o.treeNode != nil {
+			t = *o.treeNode
+		}
+		t.NodeType = uploaded.treeNode.NodeType
+		t.ObjectSize = uploaded.treeNode.ObjectSize
+		t.Md5Sum = uploaded.treeNode.Md5Sum
+		t.Sha1Sum = uploaded.treeNode.Sha1Sum
+		t.Sha256Sum = uploaded.treeNode.Sha256Sum
+		t.ModifiedAt = src.ModTime(ctx).UTC().Format("2006-01-02T15:04:05.999999Z")
+		o.treeNode = &t
+	}
+	return nil
 }
+
+// Remove deletes an object. The treenode API has no trash or soft delete, so
+// a removed file cannot be restored.
 func (o *Object) Remove(ctx context.Context) error {
 	fs.Debugf(o, "removing object: %v", o.ID())
+	if o.fs.opt.VersionAt.IsSet() {
+		return ErrVersionAt
+	}
 	return o.fs.api.Remove(ctx, o.treeNode)
 }
 
@@ -1097,7 +3270,7 @@ func (o *Object) ID() string {
 }
 
 func (o *Object) absPath() string {
-	return path.Join(o.fs.Root(), o.remote)
+	return o.fs.absPath(o.remote)
 }
 
 // Dir
@@ -1135,7 +3308,7 @@ func (dir *Dir) Size() int64 { return 0 }
 
 // Items returns the number of entries in this directory.
 func (dir *Dir) Items() int64 {
-	children, err := dir.fs.api.List(dir.treeNode)
+	children, err := dir.fs.api.List(context.Background(), dir.treeNode)
 	if err != nil {
 		return 0
 	}
@@ -1149,15 +3322,13 @@ func (dir *Dir) ID() string { return dir.treeNode.Path }
 // Check if interfaces are satisfied
 // ---------------------------------
 
-// TODO: there is one interesting interface, fs.Commander, that allows to add
-// arbitrary commands to rclone. This could be interesting for fixity status,
-// visualizing geographic distribution of the data, etc.
-
 var (
 	_ fs.Abouter      = (*Fs)(nil)
+	_ fs.Commander    = (*Fs)(nil)
 	_ fs.DirMover     = (*Fs)(nil)
 	_ fs.Disconnecter = (*Fs)(nil)
 	_ fs.Fs           = (*Fs)(nil)
+	_ fs.ListRer      = (*Fs)(nil)
 	_ fs.PublicLinker = (*Fs)(nil)
 	_ fs.PutStreamer  = (*Fs)(nil)
 	_ fs.Shutdowner   = (*Fs)(nil)
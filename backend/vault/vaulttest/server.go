@@ -0,0 +1,1495 @@
+// Package vaulttest implements an in-memory vault server for tests.
+//
+// The server covers login, users, organizations, plans, treenodes,
+// collections and the deposits/v2 upload endpoints, enough to run the vault
+// backend without a vault-site installation. Files deposited are assembled on
+// finalize, synchronously, and can be downloaded again.
+package vaulttest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Version is the api version the server reports.
+	Version = "3"
+	// Organization is the name of the single organization.
+	Organization = "org"
+	// QuotaBytes of the organization.
+	QuotaBytes = 1 << 40
+
+	organizationID = 1
+	rootID         = 1
+	planID         = 1
+	userID         = 1
+	csrfToken      = "vaulttest-csrf-token"
+	sessionCookie  = "sessionid"
+)
+
+// node is a treenode.
+type node struct {
+	id       int
+	name     string
+	nodeType string
+	parent   int // zero for the organization
+	content  []byte
+	metadata map[string]interface{}
+	comment  string
+	modified time.Time
+	hashed   time.Time // hashes are reported from then on
+}
+
+// upload is a file within a deposit.
+type upload struct {
+	relativePath string
+	totalChunks  int
+	chunks       map[int][]byte
+	mtime        time.Time
+}
+
+// deposit collects uploads, until it is finalized.
+type deposit struct {
+	id         int
+	parent     int
+	collection int                // collection id
+	state      string             // REGISTERED, REPLICATED or TERMINATED_BY_USER
+	registered time.Time          // registration time
+	replicated time.Time          // finalization time, zero if not finalized
+	uploads    map[string]*upload // keyed by flow identifier
+	finalized  int                // number of files assembled
+}
+
+// event is a fixity check of a collection.
+type event struct {
+	id         int
+	collection int
+	ended      time.Time
+	files      int
+	errors     int
+}
+
+// report is a deposit or fixity report, with the size of the collection at
+// the time.
+type report struct {
+	id         int
+	typ        string
+	collection int
+	ended      time.Time
+	files      int64
+	bytes      int64
+}
+
+// policy are the preservation settings of a collection.
+type policy struct {
+	fixityFrequency   string
+	targetReplication int
+}
+
+// replicaLocations are the storage locations copies are placed at.
+var replicaLocations = []struct {
+	abbreviation, displayName, physicalLocation string
+}{
+	{"SF", "San Francisco", "San Francisco, CA, US"},
+	{"RI", "Richmond", "Richmond, CA, US"},
+	{"AM", "Amsterdam", "Amsterdam, NL"},
+	{"VA", "Vancouver", "Vancouver, BC, CA"},
+}
+
+// user is an account of the organization.
+type user struct {
+	id          int
+	username    string
+	role        string
+	collections []int // authorized collection ids
+}
+
+// Server is an in-memory vault. Use NewServer to start one.
+type Server struct {
+	*httptest.Server
+	Username string
+	Password string
+	APIKey   string // if set, token authentication is accepted as well
+	// APIVersion is the reported api version, defaults to Version.
+	APIVersion string
+	// KeepVersions keeps a file, if a file with the same name is deposited,
+	// so there are two files with the same name.
+	KeepVersions bool
+	// FinalizeDelay delays the response to finalize requests, e.g. to test
+	// timeouts.
+	FinalizeDelay time.Duration
+	// ChunkDelay delays the handling of chunk uploads, e.g. to test
+	// overlapping reads and uploads.
+	ChunkDelay time.Duration
+	// HashDelay withholds the hashes of deposited files for this long after
+	// finalize, as servers compute them only after processing the deposit.
+	HashDelay time.Duration
+	// AssemblyDelay delays the assembly of the files of a deposit after
+	// finalize, as servers assemble files in the background, so the
+	// treenodes of the files appear only later.
+	AssemblyDelay time.Duration
+	// ProtectCollections rejects removing collections, as servers do,
+	// which do not permit deleting collections.
+	ProtectCollections bool
+
+	mu          sync.Mutex
+	nextID      int
+	nodes       map[int]*node
+	collections map[int]int // collection id to treenode id
+	policies    map[int]*policy
+	users       map[int]*user
+	deposits    map[int]*deposit
+	events      []*event
+	reports     []*report
+	chunkErrors []chunkError // next chunk uploads to fail
+	chunks      int          // chunk uploads received, including failed ones
+	chunkStalls []time.Duration
+	userAgents  map[string]bool
+	sessions    map[string]bool
+}
+
+// NewServer starts a new server with an empty organization. Call Close when
+// done.
+func NewServer(username, password string) *Server {
+	s := &Server{
+		Username:    username,
+		Password:    password,
+		nextID:      rootID + 1,
+		nodes:       make(map[int]*node),
+		collections: make(map[int]int),
+		policies:    make(map[int]*policy),
+		users:       make(map[int]*user),
+		deposits:    make(map[int]*deposit),
+		sessions:    make(map[string]bool),
+	}
+	s.nodes[rootID] = &node{id: rootID, name: Organization, nodeType: "ORGANIZATION", modified: time.Now()}
+	s.users[userID] = &user{id: userID, username: username, role: "ADMIN"}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoint returns the api endpoint, as used in the vault config.
+func (s *Server) Endpoint() string {
+	return s.URL + "/api"
+}
+
+// File returns the content of the file at path p, relative to the
+// organization, e.g. "collection/dir/file.txt".
+func (s *Server) File(p string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.resolve(p)
+	if n == nil || n.nodeType != "FILE" {
+		return nil, false
+	}
+	return n.content, true
+}
+
+// Versions returns the number of files at path p, relative to the
+// organization; more than one only, if KeepVersions is set.
+func (s *Server) Versions(p string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parent := s.resolve(path.Dir(p))
+	if parent == nil {
+		return 0
+	}
+	var count int
+	for _, n := range s.nodes {
+		if n.parent == parent.id && n.name == path.Base(p) {
+			count++
+		}
+	}
+	return count
+}
+
+// Metadata returns the metadata of the treenode at path p, relative to the
+// organization.
+func (s *Server) Metadata(p string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.resolve(p)
+	if n == nil {
+		return nil, false
+	}
+	return n.metadata, true
+}
+
+// Comment returns the comment of the treenode at path p, relative to the
+// organization.
+func (s *Server) Comment(p string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.resolve(p)
+	if n == nil {
+		return "", false
+	}
+	return n.comment, true
+}
+
+// SetComment sets the comment of the treenode at path p, relative to the
+// organization, as the server does, which does not allow clients to change
+// comments. Returns false, if there is no such treenode.
+func (s *Server) SetComment(p, comment string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.resolve(p)
+	if n == nil {
+		return false
+	}
+	n.comment = comment
+	return true
+}
+
+// AddUser adds a user to the organization, with a role like USER or VIEWER.
+func (s *Server) AddUser(username, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[s.nextID] = &user{id: s.nextID, username: username, role: role}
+	s.nextID++
+}
+
+// UserAccess returns the role of a user and the names of the collections
+// the user is authorized for.
+func (s *Server) UserAccess(username string) (role string, collections []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.username != username {
+			continue
+		}
+		for _, id := range u.collections {
+			if n, ok := s.nodes[s.collections[id]]; ok {
+				collections = append(collections, n.name)
+			}
+		}
+		sort.Strings(collections)
+		return u.role, collections
+	}
+	return "", nil
+}
+
+// chunkError is a failure of a chunk upload.
+type chunkError struct {
+	status     int
+	retryAfter time.Duration // sent as Retry-After header, if set
+}
+
+// FailChunks lets the next n chunk uploads fail with the given status.
+func (s *Server) FailChunks(n, status int) {
+	s.ThrottleChunks(n, status, 0)
+}
+
+// ThrottleChunks lets the next n chunk uploads fail with the given status
+// and a Retry-After header with the delay, in whole seconds.
+func (s *Server) ThrottleChunks(n, status int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.chunkErrors = append(s.chunkErrors, chunkError{status: status, retryAfter: retryAfter})
+	}
+}
+
+// StallChunks lets the next n chunk uploads hang for d and then fail with a
+// gateway timeout, like a hung connection through a proxy.
+func (s *Server) StallChunks(n int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.chunkStalls = append(s.chunkStalls, d)
+	}
+}
+
+// UserAgents returns the distinct User-Agent headers of all requests
+// received, sorted.
+func (s *Server) UserAgents() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []string
+	for ua := range s.userAgents {
+		result = append(result, ua)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Chunks returns the number of chunk uploads received, including failed
+// ones.
+func (s *Server) Chunks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chunks
+}
+
+// AddFixityEvent records a completed fixity check of a collection, with the
+// number of files checked and failed. Returns false, if there is no such
+// collection.
+func (s *Server) AddFixityEvent(collection string, files, errors int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, nid := range s.collections {
+		if s.nodes[nid].name == collection {
+			s.events = append(s.events, &event{
+				id:         s.nextID,
+				collection: id,
+				ended:      time.Now(),
+				files:      files,
+				errors:     errors,
+			})
+			s.nextID++
+			return true
+		}
+	}
+	return false
+}
+
+// AddReport records a deposit or fixity report of a collection, which had
+// files and bytes when the report ended. Returns false, if there is no such
+// collection.
+func (s *Server) AddReport(collection, typ string, ended time.Time, files, bytes int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, nid := range s.collections {
+		if s.nodes[nid].name == collection {
+			s.reports = append(s.reports, &report{
+				id:         s.nextID,
+				typ:        typ,
+				collection: id,
+				ended:      ended,
+				files:      files,
+				bytes:      bytes,
+			})
+			s.nextID++
+			return true
+		}
+	}
+	return false
+}
+
+// route is a handler for a path pattern.
+type route struct {
+	method  string
+	pattern *regexp.Regexp
+	handler func(w http.ResponseWriter, r *http.Request, id int)
+}
+
+// routes returns all endpoints, except the api root and login.
+func (s *Server) routes() []route {
+	re := func(p string) *regexp.Regexp {
+		return regexp.MustCompile(`^` + p + `$`)
+	}
+	return []route{
+		{"GET", re(`/api/users/`), s.listUsers},
+		{"PATCH", re(`/api/users/([0-9]+)/`), s.patchUser},
+		{"GET", re(`/api/organizations/`), s.listOrganizations},
+		{"GET", re(`/api/organizations/([0-9]+)/`), s.getOrganization},
+		{"GET", re(`/api/plans/([0-9]+)/`), s.getPlan},
+		{"GET", re(`/api/treenodes/`), s.listTreenodes},
+		{"POST", re(`/api/treenodes/`), s.createTreenode},
+		{"GET", re(`/api/treenodes/([0-9]+)/`), s.getTreenode},
+		{"PATCH", re(`/api/treenodes/([0-9]+)/`), s.patchTreenode},
+		{"DELETE", re(`/api/treenodes/([0-9]+)/`), s.deleteTreenode},
+		{"GET", re(`/api/collections/`), s.listCollections},
+		{"POST", re(`/api/collections/`), s.createCollection},
+		{"PATCH", re(`/api/collections/([0-9]+)/`), s.patchCollection},
+		{"GET", re(`/api/collections_stats`), s.collectionStats},
+		{"GET", re(`/api/collection-summaries/`), s.listCollectionSummaries},
+		{"GET", re(`/api/deposit_status`), s.depositStatus},
+		{"GET", re(`/api/events/`), s.listEvents},
+		{"GET", re(`/api/reports/`), s.listReports},
+		{"GET", re(`/api/deposits/`), s.listDeposits},
+		{"GET", re(`/api/deposits/([0-9]+)/`), s.getDeposit},
+		{"POST", re(`/api/deposits/v2/register`), s.registerDeposit},
+		{"POST", re(`/api/deposits/v2/chunk`), s.sendChunk},
+		{"POST", re(`/api/deposits/v2/finalize`), s.finalizeDeposit},
+		{"POST", re(`/api/deposits/v2/terminate`), s.terminateDeposit},
+		{"GET", re(`/download/([0-9]+)`), s.download},
+		{"GET", re(`/content/([0-9]+)`), s.content},
+	}
+}
+
+// handle dispatches requests.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.userAgents == nil {
+		s.userAgents = make(map[string]bool)
+	}
+	s.userAgents[r.UserAgent()] = true
+	s.mu.Unlock()
+	switch {
+	case r.URL.Path == "/api" || r.URL.Path == "/api/":
+		s.apiRoot(w, r)
+		return
+	case r.URL.Path == "/api/auth/login/" && r.Method == "POST":
+		s.login(w, r)
+		return
+	}
+	var matched bool
+	for _, rt := range s.routes() {
+		matches := rt.pattern.FindStringSubmatch(r.URL.Path)
+		if matches == nil {
+			continue
+		}
+		if rt.method != r.Method {
+			matched = true
+			continue
+		}
+		token, ok := s.authenticate(r)
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"detail": "Authentication credentials were not provided."})
+			return
+		}
+		// Deposit endpoints are exempt from CSRF checks.
+		if !token && !isSafeMethod(r.Method) && !strings.HasPrefix(r.URL.Path, "/api/deposits/") &&
+			r.Header.Get("X-CSRFTOKEN") != csrfToken {
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"detail": "CSRF Failed: CSRF token missing or incorrect."})
+			return
+		}
+		if r.URL.Path == "/api/deposits/v2/finalize" && s.FinalizeDelay > 0 {
+			time.Sleep(s.FinalizeDelay)
+		}
+		if r.URL.Path == "/api/deposits/v2/chunk" {
+			if s.ChunkDelay > 0 {
+				time.Sleep(s.ChunkDelay)
+			}
+			var stall time.Duration
+			s.mu.Lock()
+			if len(s.chunkStalls) > 0 {
+				stall, s.chunkStalls = s.chunkStalls[0], s.chunkStalls[1:]
+			}
+			s.mu.Unlock()
+			if stall > 0 {
+				// With the body read, the server notices, when the
+				// client gives up.
+				_, _ = io.Copy(io.Discard, r.Body)
+				select {
+				case <-time.After(stall):
+					writeJSON(w, http.StatusGatewayTimeout, map[string]string{"detail": "Gateway Timeout"})
+				case <-r.Context().Done():
+				}
+				return
+			}
+		}
+		var id int
+		if len(matches) > 1 {
+			id, _ = strconv.Atoi(matches[1])
+		}
+		s.mu.Lock()
+		rt.handler(w, r, id)
+		s.mu.Unlock()
+		return
+	}
+	if matched {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"detail": fmt.Sprintf("Method \"%s\" not allowed.", r.Method)})
+		return
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+}
+
+// authenticate checks the session cookie or api token; token is true for
+// token authentication.
+func (s *Server) authenticate(r *http.Request) (token, ok bool) {
+	if s.APIKey != "" && r.Header.Get("Authorization") == "Token "+s.APIKey {
+		return true, true
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return false, s.sessions[c.Value]
+}
+
+// apiRoot serves the version header and, for browsers, a page with a CSRF
+// token.
+func (s *Server) apiRoot(w http.ResponseWriter, r *http.Request) {
+	version := s.APIVersion
+	if version == "" {
+		version = Version
+	}
+	w.Header().Set("X-Vault-API-Version", version)
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><script>window.drf = {csrfToken: "%s"};</script></html>`, csrfToken)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"treenodes": s.url("/api/treenodes/")})
+}
+
+// login implements the JSON login endpoint.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	if payload.Username != s.Username || payload.Password != s.Password {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{
+			"non_field_errors": {"Unable to log in with provided credentials."}})
+		return
+	}
+	s.mu.Lock()
+	session := fmt.Sprintf("session-%d", len(s.sessions)+1)
+	s.sessions[session] = true
+	s.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: session, Path: "/"})
+	http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: csrfToken, Path: "/"})
+	writeJSON(w, http.StatusOK, map[string]string{"detail": "ok"})
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request, _ int) {
+	var (
+		results []interface{}
+		ids     []int
+	)
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if v := r.URL.Query().Get("username"); v != "" && v != s.users[id].username {
+			continue
+		}
+		results = append(results, s.userJSON(s.users[id]))
+	}
+	s.writePage(w, r, results)
+}
+
+func (s *Server) patchUser(w http.ResponseWriter, r *http.Request, id int) {
+	u, ok := s.users[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	var payload struct {
+		AuthorizedCollections *[]string `json:"authorized_collections"`
+		Role                  *string   `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	if payload.Role != nil {
+		switch *payload.Role {
+		case "ADMIN", "USER", "VIEWER", "READ_ONLY":
+			u.role = *payload.Role
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string][]string{
+				"role": {fmt.Sprintf("\"%s\" is not a valid choice.", *payload.Role)}})
+			return
+		}
+	}
+	if payload.AuthorizedCollections != nil {
+		var collections []int
+		for _, v := range *payload.AuthorizedCollections {
+			id := idFromURL(v)
+			if _, ok := s.collections[id]; !ok {
+				writeJSON(w, http.StatusBadRequest, map[string][]string{
+					"authorized_collections": {fmt.Sprintf("Invalid hyperlink - Object does not exist: %s", v)}})
+				return
+			}
+			collections = append(collections, id)
+		}
+		u.collections = collections
+	}
+	writeJSON(w, http.StatusOK, s.userJSON(u))
+}
+
+// organization returns the single organization.
+func (s *Server) organization() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        Organization,
+		"plan":        s.url("/api/plans/%d/", planID),
+		"quota_bytes": QuotaBytes,
+		"tree_node":   s.url("/api/treenodes/%d/", rootID),
+		"url":         s.url("/api/organizations/%d/", organizationID),
+	}
+}
+
+func (s *Server) listOrganizations(w http.ResponseWriter, r *http.Request, _ int) {
+	var results []interface{}
+	if name := r.URL.Query().Get("name"); name == "" || name == Organization {
+		results = append(results, s.organization())
+	}
+	s.writePage(w, r, results)
+}
+
+func (s *Server) getOrganization(w http.ResponseWriter, r *http.Request, id int) {
+	if id != organizationID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.organization())
+}
+
+func (s *Server) getPlan(w http.ResponseWriter, r *http.Request, id int) {
+	if id != planID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":                     "Basic",
+		"price_per_terabyte":       "0.00",
+		"default_replication":      2,
+		"default_fixity_frequency": "TWICE_YEARLY",
+		"url":                      s.url("/api/plans/%d/", planID),
+	})
+}
+
+func (s *Server) listTreenodes(w http.ResponseWriter, r *http.Request, _ int) {
+	var (
+		q       = r.URL.Query()
+		results []interface{}
+	)
+	for _, n := range s.sortedNodes() {
+		if v := q.Get("id"); v != "" && v != strconv.Itoa(n.id) {
+			continue
+		}
+		if v := q.Get("parent"); v != "" && v != strconv.Itoa(n.parent) {
+			continue
+		}
+		if v := q.Get("name"); v != "" && v != n.name {
+			continue
+		}
+		if v := q.Get("name__in"); v != "" && !slices.Contains(strings.Split(v, ","), n.name) {
+			continue
+		}
+		if v := q.Get("path__startswith"); v != "" && !strings.HasPrefix(s.nodePath(n), v) {
+			continue
+		}
+		results = append(results, s.nodeJSON(n))
+	}
+	s.writePage(w, r, results)
+}
+
+func (s *Server) getTreenode(w http.ResponseWriter, r *http.Request, id int) {
+	n, ok := s.nodes[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.nodeJSON(n))
+}
+
+func (s *Server) createTreenode(w http.ResponseWriter, r *http.Request, _ int) {
+	var payload struct {
+		Name     string `json:"name"`
+		NodeType string `json:"node_type"`
+		Parent   string `json:"parent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	parent, ok := s.nodes[idFromURL(payload.Parent)]
+	if !ok || payload.NodeType != "FOLDER" {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"parent": {"Invalid parent."}})
+		return
+	}
+	if s.child(parent.id, payload.Name) != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"name": {"Name already exists."}})
+		return
+	}
+	n := s.addNode(payload.Name, "FOLDER", parent.id)
+	writeJSON(w, http.StatusCreated, s.nodeJSON(n))
+}
+
+// immutableFields are the treenode fields the server refuses to update.
+var immutableFields = []string{
+	"pre_deposit_modified_at", "uploaded_at", "size", "file_type", "comment",
+	"md5_sum", "sha1_sum", "sha256_sum",
+}
+
+func (s *Server) patchTreenode(w http.ResponseWriter, r *http.Request, id int) {
+	n, ok := s.nodes[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	var (
+		fields  map[string]json.RawMessage
+		payload struct {
+			Name     *string                 `json:"name"`
+			Parent   *string                 `json:"parent"`
+			Metadata *map[string]interface{} `json:"metadata"`
+		}
+	)
+	if err := json.Unmarshal(b, &fields); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	var immutable []string
+	for _, k := range immutableFields {
+		if _, ok := fields[k]; ok {
+			immutable = append(immutable, "'"+k+"'")
+		}
+	}
+	if len(immutable) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"detail": "Immutable field(s) can not be updated: {" + strings.Join(immutable, ", ") + "}"})
+		return
+	}
+	if err := json.Unmarshal(b, &payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	if payload.Name != nil {
+		n.name = *payload.Name
+	}
+	if payload.Parent != nil {
+		if _, ok := s.nodes[idFromURL(*payload.Parent)]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"parent": {"Invalid parent."}})
+			return
+		}
+		n.parent = idFromURL(*payload.Parent)
+	}
+	if payload.Metadata != nil {
+		n.metadata = *payload.Metadata
+	}
+	n.modified = time.Now()
+	writeJSON(w, http.StatusOK, s.nodeJSON(n))
+}
+
+func (s *Server) deleteTreenode(w http.ResponseWriter, r *http.Request, id int) {
+	n, ok := s.nodes[id]
+	if !ok || id == rootID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	if n.nodeType == "COLLECTION" && s.ProtectCollections {
+		writeJSON(w, http.StatusForbidden, map[string]string{"detail": "Collections cannot be deleted."})
+		return
+	}
+	s.removeNode(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listCollections(w http.ResponseWriter, r *http.Request, _ int) {
+	var (
+		q       = r.URL.Query()
+		results []interface{}
+		ids     []int
+	)
+	for id := range s.collections {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		n := s.nodes[s.collections[id]]
+		if v := q.Get("name"); v != "" && v != n.name {
+			continue
+		}
+		if v := q.Get("tree_node"); v != "" && v != strconv.Itoa(n.id) {
+			continue
+		}
+		results = append(results, s.collectionJSON(id))
+	}
+	s.writePage(w, r, results)
+}
+
+func (s *Server) createCollection(w http.ResponseWriter, r *http.Request, _ int) {
+	var payload struct {
+		Name              string  `json:"name"`
+		FixityFrequency   *string `json:"fixity_frequency"`
+		TargetReplication *int    `json:"target_replication"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"name": {"This field is required."}})
+		return
+	}
+	if s.child(rootID, payload.Name) != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"name": {"Collection already exists."}})
+		return
+	}
+	p := &policy{fixityFrequency: "TWICE_YEARLY", targetReplication: 2}
+	if !s.applyPolicy(w, p, payload.FixityFrequency, payload.TargetReplication) {
+		return
+	}
+	n := s.addNode(payload.Name, "COLLECTION", rootID)
+	s.collections[n.id] = n.id // reuse the treenode id as collection id
+	s.policies[n.id] = p
+	writeJSON(w, http.StatusCreated, s.collectionJSON(n.id))
+}
+
+func (s *Server) patchCollection(w http.ResponseWriter, r *http.Request, id int) {
+	if _, ok := s.collections[id]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	var payload struct {
+		Name              *string `json:"name"`
+		FixityFrequency   *string `json:"fixity_frequency"`
+		TargetReplication *int    `json:"target_replication"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	if payload.Name != nil && s.child(rootID, *payload.Name) != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"name": {"Collection already exists."}})
+		return
+	}
+	p := *s.policies[id]
+	if !s.applyPolicy(w, &p, payload.FixityFrequency, payload.TargetReplication) {
+		return
+	}
+	s.policies[id] = &p
+	if payload.Name != nil {
+		s.nodes[s.collections[id]].name = *payload.Name
+	}
+	writeJSON(w, http.StatusOK, s.collectionJSON(id))
+}
+
+// applyPolicy validates and sets the given settings; on error it writes a
+// response and returns false.
+func (s *Server) applyPolicy(w http.ResponseWriter, p *policy, fixityFrequency *string, targetReplication *int) bool {
+	if fixityFrequency != nil {
+		switch *fixityFrequency {
+		case "TWICE_YEARLY", "QUARTERLY", "MONTHLY":
+			p.fixityFrequency = *fixityFrequency
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string][]string{
+				"fixity_frequency": {fmt.Sprintf("\"%s\" is not a valid choice.", *fixityFrequency)}})
+			return false
+		}
+	}
+	if targetReplication != nil {
+		switch *targetReplication {
+		case 2, 3, 4:
+			p.targetReplication = *targetReplication
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string][]string{
+				"target_replication": {fmt.Sprintf("\"%d\" is not a valid choice.", *targetReplication)}})
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) collectionStats(w http.ResponseWriter, r *http.Request, _ int) {
+	type stats struct {
+		FileCount int64  `json:"fileCount"`
+		ID        int64  `json:"id"`
+		Time      string `json:"time"`
+		TotalSize int64  `json:"totalSize"`
+	}
+	var result []stats
+	for id, nid := range s.collections {
+		st := stats{ID: int64(id), Time: time.Now().Format(time.RFC3339)}
+		for _, n := range s.nodes {
+			if n.nodeType == "FILE" && s.isBelow(n.id, nid) {
+				st.FileCount++
+				st.TotalSize += int64(len(n.content))
+			}
+		}
+		result = append(result, st)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"collections":  result,
+		"latestReport": map[string]interface{}{},
+	})
+}
+
+func (s *Server) listCollectionSummaries(w http.ResponseWriter, r *http.Request, _ int) {
+	var (
+		results []interface{}
+		ids     []int
+	)
+	for id := range s.collections {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		var (
+			nid       = s.collections[id]
+			p         = s.policies[id]
+			size      int64
+			locations = []interface{}{}
+		)
+		for _, n := range s.nodes {
+			if n.nodeType == "FILE" && s.isBelow(n.id, nid) {
+				size += int64(len(n.content))
+			}
+		}
+		// One copy per location, in order.
+		for i := 0; i < p.targetReplication && i < len(replicaLocations); i++ {
+			l := replicaLocations[i]
+			locations = append(locations, map[string]interface{}{
+				"abbreviation":       l.abbreviation,
+				"display_name":       l.displayName,
+				"num_copies":         1,
+				"physical_location":  l.physicalLocation,
+				"system_description": "test storage",
+			})
+		}
+		results = append(results, map[string]interface{}{
+			"name":                     s.nodes[nid].name,
+			"fixity_frequency":         p.fixityFrequency,
+			"size_bytes":               size,
+			"target_replica_locations": locations,
+		})
+	}
+	s.writePage(w, r, results)
+}
+
+func (s *Server) listEvents(w http.ResponseWriter, r *http.Request, _ int) {
+	var results []interface{}
+	if typ := r.URL.Query().Get("type"); typ == "" || typ == "FIXITY" {
+		for _, e := range s.events {
+			t := e.ended.Format(time.RFC3339)
+			results = append(results, map[string]interface{}{
+				"id":           e.id,
+				"type":         "FIXITY",
+				"collection":   s.collectionJSON(e.collection),
+				"upload_state": "REPLICATED",
+				"started_at":   t,
+				"ended_at":     t,
+				"file_count":   e.files,
+				"error_count":  e.errors,
+				"url":          s.url("/api/events/%d/", e.id),
+			})
+		}
+	}
+	s.writePage(w, r, results)
+}
+
+func (s *Server) listReports(w http.ResponseWriter, r *http.Request, _ int) {
+	reports := slices.Clone(s.reports)
+	if r.URL.Query().Get("ordering") == "ended_at" {
+		sort.SliceStable(reports, func(i, j int) bool { return reports[i].ended.Before(reports[j].ended) })
+	}
+	var results []interface{}
+	for _, rp := range reports {
+		t := rp.ended.Format(time.RFC3339)
+		results = append(results, map[string]interface{}{
+			"id":                    rp.id,
+			"report_type":           rp.typ,
+			"collection":            s.collectionJSON(rp.collection),
+			"collection_tree_node":  s.collections[rp.collection],
+			"collection_file_count": rp.files,
+			"collection_total_size": rp.bytes,
+			"started_at":            t,
+			"ended_at":              t,
+			"file_count":            0,
+			"total_size":            0,
+			"error_count":           0,
+			"title":                 fmt.Sprintf("%s report %d", rp.typ, rp.id),
+			"url":                   s.url("/api/reports/%d/", rp.id),
+		})
+	}
+	s.writePage(w, r, results)
+}
+
+func (s *Server) depositStatus(w http.ResponseWriter, r *http.Request, _ int) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("deposit_id"))
+	d, ok := s.deposits[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{
+		"total_files":      len(d.uploads),
+		"in_storage_files": d.finalized,
+		"errored_files":    0,
+	})
+}
+
+func (s *Server) listDeposits(w http.ResponseWriter, r *http.Request, _ int) {
+	var (
+		state   = r.URL.Query().Get("state")
+		results []interface{}
+		ids     []int
+	)
+	for id := range s.deposits {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if d := s.deposits[id]; state == "" || state == d.state {
+			results = append(results, s.depositJSON(d))
+		}
+	}
+	s.writePage(w, r, results)
+}
+
+func (s *Server) getDeposit(w http.ResponseWriter, r *http.Request, id int) {
+	d, ok := s.deposits[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.depositJSON(d))
+}
+
+func (s *Server) registerDeposit(w http.ResponseWriter, r *http.Request, _ int) {
+	var payload struct {
+		CollectionID *int `json:"collection_id"`
+		ParentNodeID *int `json:"parent_node_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	var parent int
+	switch {
+	case payload.CollectionID != nil:
+		parent = s.collections[*payload.CollectionID]
+	case payload.ParentNodeID != nil:
+		if n, ok := s.nodes[*payload.ParentNodeID]; ok && n.nodeType == "FOLDER" {
+			parent = n.id
+		}
+	}
+	if parent == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": "collection or parent required"})
+		return
+	}
+	id := s.nextID
+	s.nextID++
+	s.deposits[id] = &deposit{
+		id:         id,
+		parent:     parent,
+		collection: s.collectionOf(parent),
+		state:      "REGISTERED",
+		registered: time.Now(),
+		uploads:    make(map[string]*upload),
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"deposit_id": id})
+}
+
+func (s *Server) sendChunk(w http.ResponseWriter, r *http.Request, _ int) {
+	s.chunks++
+	if len(s.chunkErrors) > 0 {
+		ce := s.chunkErrors[0]
+		s.chunkErrors = s.chunkErrors[1:]
+		if ce.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(ce.retryAfter/time.Second)))
+		}
+		writeJSON(w, ce.status, map[string]string{"detail": http.StatusText(ce.status)})
+		return
+	}
+	if err := r.ParseMultipartForm(64 << 20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	var (
+		depositID, _   = strconv.Atoi(r.FormValue("depositId"))
+		chunkNumber, _ = strconv.Atoi(r.FormValue("flowChunkNumber"))
+		totalChunks, _ = strconv.Atoi(r.FormValue("flowTotalChunks"))
+		identifier     = r.FormValue("flowIdentifier")
+		mtime, _       = time.Parse(time.RFC3339, r.FormValue("flowUserMtime"))
+	)
+	d, ok := s.deposits[depositID]
+	if !ok || d.state != "REGISTERED" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not Found"})
+		return
+	}
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	defer f.Close() // nolint:errcheck
+	b, err := io.ReadAll(f)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	u, ok := d.uploads[identifier]
+	if !ok {
+		u = &upload{chunks: make(map[int][]byte)}
+		d.uploads[identifier] = u
+	}
+	u.relativePath = r.FormValue("flowRelativePath")
+	u.totalChunks = totalChunks
+	u.mtime = mtime
+	u.chunks[chunkNumber] = b
+	writeJSON(w, http.StatusOK, map[string]string{"detail": "ok"})
+}
+
+func (s *Server) finalizeDeposit(w http.ResponseWriter, r *http.Request, _ int) {
+	var payload struct {
+		DepositID int `json:"depositId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	d, ok := s.deposits[payload.DepositID]
+	if !ok || d.state != "REGISTERED" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not Found"})
+		return
+	}
+	d.state, d.replicated = "REPLICATED", time.Now()
+	if s.AssemblyDelay > 0 {
+		time.AfterFunc(s.AssemblyDelay, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.assemble(d)
+		})
+	} else {
+		s.assemble(d)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"detail": "ok"})
+}
+
+// assemble creates the treenodes of the completely uploaded files of a
+// finalized deposit.
+func (s *Server) assemble(d *deposit) {
+	for _, u := range d.uploads {
+		if len(u.chunks) != u.totalChunks {
+			continue
+		}
+		var content []byte
+		for i := 1; i <= u.totalChunks; i++ {
+			content = append(content, u.chunks[i]...)
+		}
+		// Create intermediate folders, then the file.
+		var (
+			parent = d.parent
+			dir    = strings.Trim(path.Dir(u.relativePath), "/.")
+		)
+		if dir != "" {
+			for _, segment := range strings.Split(dir, "/") {
+				if c := s.child(parent, segment); c != nil {
+					parent = c.id
+				} else {
+					parent = s.addNode(segment, "FOLDER", parent).id
+				}
+			}
+		}
+		name := path.Base(u.relativePath)
+		if existing := s.child(parent, name); existing != nil && !s.KeepVersions {
+			s.removeNode(existing.id)
+		}
+		n := s.addNode(name, "FILE", parent)
+		n.content, n.modified = content, u.mtime
+		n.hashed = time.Now().Add(s.HashDelay)
+		d.finalized++
+	}
+}
+
+func (s *Server) terminateDeposit(w http.ResponseWriter, r *http.Request, _ int) {
+	var payload struct {
+		DepositID int `json:"depositId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	d, ok := s.deposits[payload.DepositID]
+	if !ok || d.state != "REGISTERED" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not Found"})
+		return
+	}
+	d.state = "TERMINATED_BY_USER"
+	writeJSON(w, http.StatusOK, map[string]string{"detail": "ok"})
+}
+
+// download mimics the local vault setup, which redirects to the storage via
+// an X-Accel-Redirect header.
+func (s *Server) download(w http.ResponseWriter, r *http.Request, id int) {
+	if n, ok := s.nodes[id]; !ok || n.nodeType != "FILE" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	w.Header().Set("X-Accel-Redirect", s.url("/content/%d", id))
+}
+
+func (s *Server) content(w http.ResponseWriter, r *http.Request, id int) {
+	n, ok := s.nodes[id]
+	if !ok || n.nodeType != "FILE" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(n.content)
+}
+
+// Helpers, expecting the lock to be held
+// --------------------------------------
+
+// addNode creates a new treenode.
+func (s *Server) addNode(name, nodeType string, parent int) *node {
+	n := &node{id: s.nextID, name: name, nodeType: nodeType, parent: parent, modified: time.Now()}
+	s.nextID++
+	s.nodes[n.id] = n
+	return n
+}
+
+// removeNode removes a treenode and all its descendants.
+func (s *Server) removeNode(id int) {
+	for _, n := range s.nodes {
+		if n.parent == id {
+			s.removeNode(n.id)
+		}
+	}
+	delete(s.nodes, id)
+	delete(s.collections, id)
+	delete(s.policies, id)
+}
+
+// child returns the child of parent with a given name, or nil.
+func (s *Server) child(parent int, name string) *node {
+	for _, n := range s.nodes {
+		if n.parent == parent && n.name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// resolve finds a node by path relative to the organization.
+func (s *Server) resolve(p string) *node {
+	n := s.nodes[rootID]
+	for _, segment := range strings.Split(strings.Trim(p, "/"), "/") {
+		if n = s.child(n.id, segment); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// collectionOf returns the id of the collection containing treenode id.
+func (s *Server) collectionOf(id int) int {
+	for cid, nid := range s.collections {
+		if nid == id || s.isBelow(id, nid) {
+			return cid
+		}
+	}
+	return 0
+}
+
+// isBelow returns true, if node id is a descendant of ancestor.
+func (s *Server) isBelow(id, ancestor int) bool {
+	for n := s.nodes[id]; n != nil && n.parent != 0; n = s.nodes[n.parent] {
+		if n.parent == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedNodes returns all nodes by id.
+func (s *Server) sortedNodes() (result []*node) {
+	for _, n := range s.nodes {
+		result = append(result, n)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result
+}
+
+// nodePath returns the path of a node, starting with the organization.
+func (s *Server) nodePath(n *node) string {
+	var segments []string
+	for ; n != nil; n = s.nodes[n.parent] {
+		segments = append([]string{n.name}, segments...)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// nodeJSON renders a treenode.
+func (s *Server) nodeJSON(n *node) map[string]interface{} {
+	v := map[string]interface{}{
+		"id":                      n.id,
+		"name":                    n.name,
+		"node_type":               n.nodeType,
+		"path":                    s.nodePath(n),
+		"url":                     s.url("/api/treenodes/%d/", n.id),
+		"parent":                  nil,
+		"comment":                 nil,
+		"file_type":               nil,
+		"content_url":             nil,
+		"md5_sum":                 nil,
+		"sha1_sum":                nil,
+		"sha256_sum":              nil,
+		"size":                    nil,
+		"metadata":                n.metadata,
+		"modified_at":             n.modified.Format(time.RFC3339),
+		"pre_deposit_modified_at": n.modified.Format(time.RFC3339),
+		"uploaded_at":             n.modified.Format(time.RFC3339),
+	}
+	if n.parent != 0 {
+		v["parent"] = s.url("/api/treenodes/%d/", n.parent)
+	}
+	if n.comment != "" {
+		v["comment"] = n.comment
+	}
+	if n.nodeType == "FILE" {
+		var (
+			md5sum    = md5.Sum(n.content)
+			sha1sum   = sha1.Sum(n.content)
+			sha256sum = sha256.Sum256(n.content)
+		)
+		v["content_url"] = fmt.Sprintf("/download/%d", n.id)
+		v["size"] = len(n.content)
+		if !time.Now().Before(n.hashed) {
+			v["md5_sum"] = hex.EncodeToString(md5sum[:])
+			v["sha1_sum"] = hex.EncodeToString(sha1sum[:])
+			v["sha256_sum"] = hex.EncodeToString(sha256sum[:])
+		}
+	}
+	return v
+}
+
+// collectionJSON renders a collection.
+func (s *Server) collectionJSON(id int) map[string]interface{} {
+	var (
+		n = s.nodes[s.collections[id]]
+		p = s.policies[id]
+	)
+	return map[string]interface{}{
+		"id":                 id,
+		"name":               n.name,
+		"fixity_frequency":   p.fixityFrequency,
+		"target_replication": p.targetReplication,
+		"organization":       s.url("/api/organizations/%d/", organizationID),
+		"tree_node":          s.url("/api/treenodes/%d/", n.id),
+		"url":                s.url("/api/collections/%d/", id),
+	}
+}
+
+// userJSON renders a user.
+func (s *Server) userJSON(u *user) map[string]interface{} {
+	collections := []string{}
+	for _, id := range u.collections {
+		collections = append(collections, s.url("/api/collections/%d/", id))
+	}
+	return map[string]interface{}{
+		"id":                     u.id,
+		"username":               u.username,
+		"email":                  u.username + "@example.com",
+		"first_name":             "",
+		"last_name":              "",
+		"is_active":              true,
+		"is_staff":               false,
+		"is_superuser":           false,
+		"date_joined":            "2020-01-01T00:00:00Z",
+		"last_login":             "2020-01-01T00:00:00Z",
+		"organization":           s.url("/api/organizations/%d/", organizationID),
+		"role":                   u.role,
+		"authorized_collections": collections,
+		"url":                    s.url("/api/users/%d/", u.id),
+	}
+}
+
+// depositJSON renders a deposit.
+func (s *Server) depositJSON(d *deposit) map[string]interface{} {
+	v := map[string]interface{}{
+		"id":            d.id,
+		"state":         d.state,
+		"collection":    nil,
+		"organization":  s.url("/api/organizations/%d/", organizationID),
+		"parent_node":   s.url("/api/treenodes/%d/", d.parent),
+		"registered_at": d.registered.Format(time.RFC3339),
+		"uploaded_at":   nil,
+		"hashed_at":     nil,
+		"replicated_at": nil,
+		"user": map[string]interface{}{
+			"id":       userID,
+			"username": s.Username,
+			"url":      s.url("/api/users/%d/", userID),
+		},
+	}
+	if n, ok := s.nodes[s.collections[d.collection]]; ok {
+		v["collection"] = map[string]interface{}{
+			"id":   d.collection,
+			"name": n.name,
+			"url":  s.url("/api/collections/%d/", d.collection),
+		}
+	}
+	if !d.replicated.IsZero() {
+		t := d.replicated.Format(time.RFC3339)
+		v["uploaded_at"], v["hashed_at"], v["replicated_at"] = t, t, t
+	}
+	return v
+}
+
+// writePage writes a DRF style paginated response, honoring limit and
+// offset.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, results []interface{}) {
+	var (
+		q         = r.URL.Query()
+		offset, _ = strconv.Atoi(q.Get("offset"))
+		limit, _  = strconv.Atoi(q.Get("limit"))
+		count     = len(results)
+		next      interface{}
+	)
+	if offset > count {
+		offset = count
+	}
+	if limit <= 0 {
+		limit = count
+	}
+	end := offset + limit
+	if end > count {
+		end = count
+	}
+	if end < count {
+		u := *r.URL
+		q.Set("offset", strconv.Itoa(end))
+		u.RawQuery = q.Encode()
+		next = s.URL + u.String()
+	}
+	page := results[offset:end]
+	if page == nil {
+		page = []interface{}{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":    count,
+		"next":     next,
+		"previous": nil,
+		"results":  page,
+	})
+}
+
+// url returns an absolute url for a formatted path.
+func (s *Server) url(format string, a ...interface{}) string {
+	return s.URL + fmt.Sprintf(format, a...)
+}
+
+// idFromURL extracts the trailing numeric id of a resource url.
+func idFromURL(u string) int {
+	id, _ := strconv.Atoi(path.Base(strings.TrimRight(u, "/")))
+	return id
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,182 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/backend/vault/api"
+	"github.com/rclone/rclone/fs"
+)
+
+// ErrVersionAt is returned for write operations, if version_at is set.
+var ErrVersionAt = errors.New("cannot modify files in version_at mode")
+
+// FileVersion is a single version of a file. Vault may retain a file, when a
+// file with the same name is deposited again, cf. update_mode; all files with
+// the same name in a folder are versions of that file.
+type FileVersion struct {
+	ID       int64       `json:"id"`
+	Size     interface{} `json:"size"`
+	Uploaded string      `json:"uploaded_at"`
+	Modified string      `json:"modified_at"`
+	MD5      interface{} `json:"md5"`
+	SHA1     interface{} `json:"sha1"`
+	SHA256   interface{} `json:"sha256"`
+}
+
+// versionsCommand lists the versions of a file, oldest first, or, with the
+// id and output options, saves a version to a local file.
+func (f *Fs) versionsCommand(ctx context.Context, args []string, opt map[string]string) (out interface{}, err error) {
+	if len(args) != 1 {
+		return nil, errors.New("versions requires a single path")
+	}
+	versions, err := f.versions(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	v, ok := opt["id"]
+	if !ok {
+		result := make([]*FileVersion, 0, len(versions))
+		for _, t := range versions {
+			result = append(result, &FileVersion{
+				ID:       t.ID,
+				Size:     t.ObjectSize,
+				Uploaded: t.UploadedAt,
+				Modified: t.ModifiedAt,
+				MD5:      t.Md5Sum,
+				SHA1:     t.Sha1Sum,
+				SHA256:   t.Sha256Sum,
+			})
+		}
+		return result, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version id: %w", err)
+	}
+	filename, ok := opt["output"]
+	if !ok {
+		return nil, errors.New("versions requires an output file to save a version")
+	}
+	for _, t := range versions {
+		if t.ID == id {
+			o := &Object{fs: f, remote: args[0], treeNode: t}
+			return nil, saveObject(ctx, o, filename)
+		}
+	}
+	return nil, fmt.Errorf("no version %d of %v: %w", id, args[0], fs.ErrorObjectNotFound)
+}
+
+// saveObject writes the content of an object to a local file.
+func saveObject(ctx context.Context, o fs.Object, filename string) error {
+	rc, err := o.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close() // nolint:errcheck
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// versions returns all files named like remote in its folder, oldest first.
+func (f *Fs) versions(ctx context.Context, remote string) ([]*api.TreeNode, error) {
+	stored, err := f.storedRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := f.resolvePath(ctx, path.Dir(stored))
+	if err != nil {
+		return nil, err
+	}
+	ts, err := f.childrenNamed(ctx, parent, path.Base(stored))
+	if err != nil {
+		return nil, err
+	}
+	var versions []*api.TreeNode
+	for _, t := range ts {
+		if t.NodeType == "FILE" {
+			versions = append(versions, t)
+		}
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// sortVersions sorts versions of a file oldest first.
+func sortVersions(versions []*api.TreeNode) {
+	sort.Slice(versions, func(i, j int) bool {
+		ti, tj := uploadTime(versions[i]), uploadTime(versions[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return versions[i].ID < versions[j].ID
+	})
+}
+
+// selectVersions reduces the files of a folder listing to one per name, the
+// version selected by version_at; names without a version at that time are
+// dropped. Other nodes are kept, in order. Without version_at, nodes are
+// returned unchanged.
+func (f *Fs) selectVersions(nodes []*api.TreeNode) []*api.TreeNode {
+	if !f.opt.VersionAt.IsSet() {
+		return nodes
+	}
+	var (
+		result []*api.TreeNode
+		names  []string
+		files  = make(map[string][]*api.TreeNode)
+	)
+	for _, n := range nodes {
+		if n.NodeType != "FILE" {
+			result = append(result, n)
+			continue
+		}
+		if _, ok := files[n.Name]; !ok {
+			names = append(names, n.Name)
+		}
+		files[n.Name] = append(files[n.Name], n)
+	}
+	for _, name := range names {
+		versions := files[name]
+		sortVersions(versions)
+		if v := selectVersion(versions, time.Time(f.opt.VersionAt)); v != nil {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// selectVersion returns the latest version uploaded at or before at, or the
+// latest version, if at is zero; nil if there is none. Versions must be
+// sorted oldest first.
+func selectVersion(versions []*api.TreeNode, at time.Time) *api.TreeNode {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if at.IsZero() || !uploadTime(versions[i]).After(at) {
+			return versions[i]
+		}
+	}
+	return nil
+}
+
+// uploadTime returns the upload time of a treenode, zero if unknown.
+func uploadTime(t *api.TreeNode) time.Time {
+	v, err := time.Parse(time.RFC3339, t.UploadedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return v
+}